@@ -0,0 +1,338 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pedersen-commitment-transfer/src/equality"
+	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/rangeproof"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const allowancePrefix = "allowance"
+const allowanceOrgObjectType = "allowanceOrg"
+
+// Transient keys of the opening of the allowance left after TransferFrom
+const allowanceAmountKey = "allowance"
+const allowanceBlindingKey = "allowanceBlinding"
+
+// AllowanceOpening is the opening of what is left of an allowance after TransferFrom
+// It is stored in the implicit private data collection of the owner organization under the allowance key,
+// so that the owner can still open its balance once it revokes the allowance.
+// Units is the amount in base units, as a decimal number.
+type AllowanceOpening struct {
+	Units    string           `json:"units"`
+	Blinding ristretto.Scalar `json:"blinding"`
+}
+
+// CommittedAllowance is the commitment to what spender can still draw from owner
+type CommittedAllowance struct {
+	Owner      string          `json:"owner"`
+	Spender    string          `json:"spender"`
+	Commitment ristretto.Point `json:"commitment"`
+}
+
+type approvalEvent struct {
+	Owner   string `json:"owner"`
+	Spender string `json:"spender"`
+	Message string `json:"message"`
+}
+
+// ApproveAllowance adds committedAmount to the allowance of spender on the client account
+// The amount is moved out of the client balance into the allowance, so that drawing from it cannot
+// overdraw the owner. The proofs are those of Transfer: the client proves that the amount and
+// newBalance are not negative and that newBalance hides the current balance minus the amount.
+// The client gives spender the opening of the allowance off-chain; its organization is recorded so that
+// TransferFrom can hand the opening of what is left back to it.
+// This function triggers an Approval event
+func (s *SmartContract) ApproveAllowance(ctx contractapi.TransactionContextInterface, spender string, committedAmount ristretto.Point, newBalance ristretto.Point, amountProof rangeproof.Proof, balanceProof rangeproof.Proof, equalityProof equality.Proof) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = validateCommitments(&committedAmount, &newBalance)
+	if err != nil {
+		return "", err
+	}
+
+	// Get ID of submitting client identity
+	owner, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+	if spender == "" {
+		return "", errors.New("spender must not be empty")
+	}
+	if spender == owner {
+		return "", errors.New("cannot approve an allowance to oneself")
+	}
+
+	balance, err := getCommittedBalance(ctx, owner)
+	if err != nil {
+		return "", err
+	}
+	err = checkAccountEpoch(ctx, owner)
+	if err != nil {
+		return "", err
+	}
+	err = isValidSpend(ctx, "balance", &balance.Commitment, &committedAmount, &newBalance, amountProof, balanceProof, equalityProof)
+	if err != nil {
+		return "", err
+	}
+
+	allowanceKey, err := getAllowanceKey(ctx, owner, spender)
+	if err != nil {
+		return "", err
+	}
+	err = ctx.GetStub().PutState(owner, newBalance.Bytes())
+	if err != nil {
+		return "", fmt.Errorf("failed to update client account %s: %v", owner, err)
+	}
+	_, _, err = addToBalance(ctx, allowanceKey, &committedAmount)
+	if err != nil {
+		return "", fmt.Errorf("failed to update the allowance: %v", err)
+	}
+	ownerMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get MSPID: %v", err)
+	}
+	orgKey, err := ctx.GetStub().CreateCompositeKey(allowanceOrgObjectType, []string{owner})
+	if err != nil {
+		return "", fmt.Errorf("failed to create the composite key: %v", err)
+	}
+	err = ctx.GetStub().PutState(orgKey, []byte(ownerMSPID))
+	if err != nil {
+		return "", fmt.Errorf("failed to store the owner organization: %v", err)
+	}
+
+	err = emitApprovalEvent(ctx, approvalEvent{owner, spender, "Allowance approved"})
+	if err != nil {
+		return "", err
+	}
+	return ctx.GetStub().GetTxID(), nil
+}
+
+// RevokeAllowance moves what is left of the allowance of spender back to the client account
+// Once spender has drawn from it, the client opens what is left with the AllowanceOpening in the
+// private data collection of its organization.
+// This function triggers an Approval event
+func (s *SmartContract) RevokeAllowance(ctx contractapi.TransactionContextInterface, spender string) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	// Get ID of submitting client identity
+	owner, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+	allowanceKey, err := getAllowanceKey(ctx, owner, spender)
+	if err != nil {
+		return "", err
+	}
+	allowance, err := getCommittedBalance(ctx, allowanceKey)
+	if err != nil {
+		return "", fmt.Errorf("no allowance for spender %s", spender)
+	}
+
+	err = transferHelper(ctx, allowanceKey, owner, allowance.Commitment)
+	if err != nil {
+		return "", fmt.Errorf("failed to transfer: %v", err)
+	}
+
+	err = emitApprovalEvent(ctx, approvalEvent{owner, spender, "Allowance revoked"})
+	if err != nil {
+		return "", err
+	}
+	return ctx.GetStub().GetTxID(), nil
+}
+
+// Allowance returns the commitment to what spender can still draw from owner
+// Without an allowance it is the commitment to zero with a zero blinding factor.
+func (s *SmartContract) Allowance(ctx contractapi.TransactionContextInterface, owner string, spender string) (*CommittedAllowance, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return nil, fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	allowanceKey, err := getAllowanceKey(ctx, owner, spender)
+	if err != nil {
+		return nil, err
+	}
+	allowanceBytes, err := ctx.GetStub().GetState(allowanceKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read allowance for %s from world state: %v", allowanceKey, err)
+	}
+
+	allowance := CommittedAllowance{Owner: owner, Spender: spender}
+	if allowanceBytes == nil {
+		allowance.Commitment.SetZero()
+		return &allowance, nil
+	}
+	err = allowance.Commitment.UnmarshalBinary(allowanceBytes)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling")
+	}
+	return &allowance, nil
+}
+
+// TransferFrom transfers committedAmount from the allowance the client has on from to a temporary account for to
+// The client proves that the amount and newAllowance are not negative and that newAllowance hides
+// the current allowance minus the amount, with the opening of the allowance given by its owner.
+// The opening of newAllowance is passed in the transient map under "allowance" and "allowanceBlinding"
+// and stored as an AllowanceOpening for the owner. to approves the transfer as for Transfer; a rejected
+// or reclaimed transfer goes back to the client, who knows the opening of the amount.
+// This function triggers a Transfer event
+func (s *SmartContract) TransferFrom(ctx contractapi.TransactionContextInterface, from string, to string, committedAmount ristretto.Point, newAllowance ristretto.Point, amountProof rangeproof.Proof, allowanceProof rangeproof.Proof, equalityProof equality.Proof) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = validateCommitments(&committedAmount, &newAllowance)
+	if err != nil {
+		return "", err
+	}
+
+	// Get ID of submitting client identity
+	spender, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+	err = checkRecipient(ctx, spender, to)
+	if err != nil {
+		return "", err
+	}
+	timelock, err := resolveTimelock(ctx, 0)
+	if err != nil {
+		return "", err
+	}
+	allowanceKey, err := getAllowanceKey(ctx, from, spender)
+	if err != nil {
+		return "", err
+	}
+	allowance, err := getCommittedBalance(ctx, allowanceKey)
+	if err != nil {
+		return "", fmt.Errorf("spender %s has no allowance from %s", spender, from)
+	}
+	err = checkAccountEpoch(ctx, allowanceKey)
+	if err != nil {
+		return "", err
+	}
+	err = isValidSpend(ctx, "allowance", &allowance.Commitment, &committedAmount, &newAllowance, amountProof, allowanceProof, equalityProof)
+	if err != nil {
+		return "", err
+	}
+
+	err = storeAllowanceOpening(ctx, from, allowanceKey, &newAllowance)
+	if err != nil {
+		return "", err
+	}
+
+	stub := ctx.GetStub()
+	TxID := stub.GetTxID()
+	err = stub.PutState(allowanceKey, newAllowance.Bytes())
+	if err != nil {
+		return "", fmt.Errorf("failed to update the allowance: %v", err)
+	}
+	stagedAccount, err := stageTransfer(ctx, TxID, spender, to, &committedAmount, timelock)
+	if err != nil {
+		return "", err
+	}
+
+	err = emitTransferEvent(ctx, transferEvent{from, stagedAccount, "Money sent by " + spender})
+	if err != nil {
+		return "", err
+	}
+	return TxID, nil
+}
+
+// storeAllowanceOpening checks the opening of newAllowance in the transient map and stores it
+// in the implicit private data collection of the organization of owner
+func storeAllowanceOpening(ctx contractapi.TransactionContextInterface, owner string, allowanceKey string, newAllowance *ristretto.Point) error {
+	stub := ctx.GetStub()
+	orgKey, err := stub.CreateCompositeKey(allowanceOrgObjectType, []string{owner})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key: %v", err)
+	}
+	ownerMSPID, err := stub.GetState(orgKey)
+	if err != nil {
+		return fmt.Errorf("failed to read the owner organization from world state: %v", err)
+	}
+	if ownerMSPID == nil {
+		return fmt.Errorf("no organization recorded for owner %s", owner)
+	}
+
+	amount, err := getTransientAmount(ctx, allowanceAmountKey)
+	if err != nil {
+		return err
+	}
+	blinding, err := getTransientBlinding(ctx, allowanceBlindingKey)
+	if err != nil {
+		return err
+	}
+	H, err := GetPedersenParams(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch pedersen encryption parameters: %v", err)
+	}
+	expected := pedersen.CommitTo(H, pedersen.NewSecret(&blinding), amount)
+	if !expected.Equals(newAllowance) {
+		return errors.New("allowance opening does not open the new allowance")
+	}
+
+	openingJSON, err := json.Marshal(&AllowanceOpening{Units: amount.Units().String(), Blinding: blinding})
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = stub.PutPrivateData("_implicit_org_"+string(ownerMSPID), allowanceKey, openingJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store the allowance opening: %v", err)
+	}
+	return nil
+}
+
+func getAllowanceKey(ctx contractapi.TransactionContextInterface, owner string, spender string) (string, error) {
+	allowanceKey, err := ctx.GetStub().CreateCompositeKey(allowancePrefix, []string{owner, spender})
+	if err != nil {
+		return "", fmt.Errorf("failed to create the composite key for prefix %s: %v", allowancePrefix, err)
+	}
+	return allowanceKey, nil
+}
+
+func emitApprovalEvent(ctx contractapi.TransactionContextInterface, event approvalEvent) error {
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent("Approval", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+	return nil
+}
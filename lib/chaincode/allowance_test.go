@@ -0,0 +1,121 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/rangeproof"
+	"testing"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllowance(t *testing.T) {
+	ctx, stub, identity, state := newTestContext("alice", "Org2MSP")
+	H, bindingFactor := initTestContract(t, ctx, state)
+	contract := new(SmartContract)
+	balance := commitAmount(&H, &bindingFactor, 100)
+	state["alice"] = balance.Bytes()
+
+	// Alice lets Bob draw 40
+	approved, newBalance, amountProof, balanceProof, equalityProof, rAllowance, rBalance := spendProofs(t, &H, &bindingFactor, 100, 40)
+	_, err := contract.ApproveAllowance(ctx, "alice", approved, newBalance, amountProof, balanceProof, equalityProof)
+	assert.EqualError(t, err, "cannot approve an allowance to oneself")
+	_, err = contract.ApproveAllowance(ctx, "bob", approved, newBalance, amountProof, amountProof, equalityProof)
+	assert.EqualError(t, err, "balance range proof not valid")
+	_, err = contract.ApproveAllowance(ctx, "bob", approved, newBalance, amountProof, balanceProof, equalityProof)
+	assert.NoError(t, err)
+
+	aliceBalance := readPoint(t, state, "alice")
+	assert.True(t, aliceBalance.Equals(&newBalance))
+	allowance, err := contract.Allowance(ctx, "alice", "bob")
+	assert.NoError(t, err)
+	assert.True(t, allowance.Commitment.Equals(&approved))
+
+	var approval approvalEvent
+	assert.Equal(t, "Approval", readEvent(t, stub, 0, &approval))
+	assert.Equal(t, approvalEvent{"alice", "bob", "Allowance approved"}, approval)
+
+	// Bob sends 25 of them to Carol
+	identity.GetIDReturns("bob", nil)
+	drawn, newAllowance, amountProof, allowanceProof, equalityProof, _, rLeft := spendProofs(t, &H, &rAllowance, 40, 25)
+
+	inflated := commitAmount(&H, &rLeft, 20)
+	inflatedProof, err := rangeproof.Prove(&H, testAmount(20), pedersen.NewSecret(&rLeft))
+	assert.NoError(t, err)
+	_, err = contract.TransferFrom(ctx, "alice", "carol", drawn, inflated, amountProof, inflatedProof, equalityProof)
+	assert.EqualError(t, err, "allowance equality proof not valid", "The new allowance must be what is left")
+
+	identity.GetIDReturns("mallory", nil)
+	_, err = contract.TransferFrom(ctx, "alice", "carol", drawn, newAllowance, amountProof, allowanceProof, equalityProof)
+	assert.EqualError(t, err, "spender mallory has no allowance from alice")
+
+	// Bob cannot credit the allowance itself or any other key that is not a client account
+	identity.GetIDReturns("bob", nil)
+	allowanceKey, _ := getAllowanceKey(ctx, "alice", "bob")
+	_, err = contract.TransferFrom(ctx, "alice", allowanceKey, drawn, newAllowance, amountProof, allowanceProof, equalityProof)
+	assert.EqualError(t, err, "recipient "+allowanceKey+" is not a client account")
+	_, err = contract.TransferFrom(ctx, "alice", supplyCommitmentKey, drawn, newAllowance, amountProof, allowanceProof, equalityProof)
+	assert.EqualError(t, err, "recipient supplyCommitment is not a client account")
+
+	// Bob hands Alice the opening of what is left
+	transient := transientAmounts(map[string]int64{allowanceAmountKey: 15})
+	transient[allowanceBlindingKey] = rAllowance.Bytes()
+	stub.GetTransientReturns(transient, nil)
+	_, err = contract.TransferFrom(ctx, "alice", "carol", drawn, newAllowance, amountProof, allowanceProof, equalityProof)
+	assert.EqualError(t, err, "allowance opening does not open the new allowance")
+	transient[allowanceBlindingKey] = rLeft.Bytes()
+	_, err = contract.TransferFrom(ctx, "alice", "carol", drawn, newAllowance, amountProof, allowanceProof, equalityProof)
+	assert.NoError(t, err)
+
+	collection, key, value := stub.PutPrivateDataArgsForCall(0)
+	assert.Equal(t, "_implicit_org_Org2MSP", collection)
+	assert.Equal(t, allowanceKey, key)
+	var opening AllowanceOpening
+	assert.NoError(t, json.Unmarshal(value, &opening))
+	assert.Equal(t, "15", opening.Units)
+
+	allowance, err = contract.Allowance(ctx, "alice", "bob")
+	assert.NoError(t, err)
+	assert.True(t, allowance.Commitment.Equals(&newAllowance))
+
+	// Carol is credited once she approves the transfer
+	assert.Nil(t, state["carol"])
+	var transfer transferEvent
+	assert.Equal(t, "Transfer", readEvent(t, stub, 1, &transfer))
+	assert.Equal(t, transferEvent{"alice", temporaryAccountAddressPrefix + "_TxidTest", "Money sent by bob"}, transfer)
+	txInfo, err := getTxInfo(stub, "TxidTest")
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", txInfo.Sender)
+	identity.GetIDReturns("carol", nil)
+	_, err = contract.Approve(ctx, "TxidTest")
+	assert.NoError(t, err)
+	carolBalance := readPoint(t, state, "carol")
+	assert.True(t, carolBalance.Equals(&drawn))
+
+	// Alice takes the rest back
+	identity.GetIDReturns("alice", nil)
+	_, err = contract.RevokeAllowance(ctx, "bob")
+	assert.NoError(t, err)
+	expectedBalance := pedersen.Add(&newBalance, &newAllowance)
+	aliceBalance = readPoint(t, state, "alice")
+	assert.True(t, aliceBalance.Equals(&expectedBalance))
+
+	// Alice opens her balance with the opening Bob left her
+	var rTotal ristretto.Scalar
+	rTotal.Add(&rBalance, &opening.Blinding)
+	opened := commitAmount(&H, &rTotal, 60+15)
+	assert.True(t, aliceBalance.Equals(&opened))
+
+	var zero ristretto.Point
+	zero.SetZero()
+	allowance, err = contract.Allowance(ctx, "alice", "bob")
+	assert.NoError(t, err)
+	assert.True(t, allowance.Commitment.Equals(&zero))
+	allowance, err = contract.Allowance(ctx, "alice", "carol")
+	assert.NoError(t, err)
+	assert.True(t, allowance.Commitment.Equals(&zero), "No allowance is a zero allowance")
+
+	_, err = contract.RevokeAllowance(ctx, "carol")
+	assert.EqualError(t, err, "no allowance for spender carol")
+}
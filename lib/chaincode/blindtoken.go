@@ -0,0 +1,204 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"pedersen-commitment-transfer/src/blindsig"
+	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/schnorr"
+	"strconv"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Object type for the composite keys of the public keys that sign blind tokens, one per denomination
+const tokenIssuerObjectType = "blindTokenIssuer"
+
+// Object type for the composite keys of the spent-serial registry
+const spentSerialObjectType = "spentSerial"
+
+// BlindTokenMessage is the message the issuer blindly signs for a token
+// The serial of a token is holderKey, a one-time public key chosen by the holder, which stays hidden
+// from the issuer until redemption. Only the holder of its secret key can redeem the token.
+// The issuer cannot see what it signs, so the denomination is given by the signing key, not by the message.
+func BlindTokenMessage(holderKey *ristretto.Point) []byte {
+	return append([]byte("BlindToken"), holderKey.Bytes()...)
+}
+
+// RedeemTokenMessage is the message the holder signs with the token key to redeem it in transaction txID
+// Binding the transaction keeps anyone who sees the redemption from replaying it under their own identity.
+func RedeemTokenMessage(txID string, clientID string) []byte {
+	message := append([]byte("RedeemToken"), txID...)
+	message = append(message, 0)
+	return append(message, clientID...)
+}
+
+// SetTokenIssuer sets the public key whose blind signatures can be redeemed for tokens of denomination
+// Each denomination needs its own key.
+func (s *SmartContract) SetTokenIssuer(ctx contractapi.TransactionContextInterface, denomination int64, publicKey ristretto.Point) (bool, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return false, fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	// Check issuer authorization - this sample assumes Org1 is the central banker with privilege to issue tokens
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return false, fmt.Errorf("failed to get MSPID: %v", err)
+	}
+	if clientMSPID != "Org1MSP" {
+		return false, fmt.Errorf("client is not authorized to set the token issuer")
+	}
+
+	if denomination <= 0 {
+		return false, fmt.Errorf("token denomination must be a positive integer")
+	}
+	err = validatePoints(&publicKey)
+	if err != nil {
+		return false, fmt.Errorf("invalid issuer key: %w", err)
+	}
+	issuerKey, err := getTokenIssuerKey(ctx, denomination)
+	if err != nil {
+		return false, err
+	}
+
+	publicKeyBytes, err := publicKey.MarshalBinary()
+	if err != nil {
+		return false, err
+	}
+	err = ctx.GetStub().PutState(issuerKey, publicKeyBytes)
+	if err != nil {
+		return false, fmt.Errorf("failed to set token issuer: %v", err)
+	}
+
+	return true, nil
+}
+
+// RedeemBlindToken credits the client with the denomination of a blindly signed token
+// The signature must be made with the issuer key of that denomination, and ownership with the secret
+// key of holderKey on RedeemTokenMessage for this transaction and client.
+// The serial is recorded in the spent-serial registry so that each token can only be redeemed once.
+// This function triggers a Transfer event
+func (s *SmartContract) RedeemBlindToken(ctx contractapi.TransactionContextInterface, holderKey ristretto.Point, denomination int64, signature schnorr.Signature, ownership schnorr.Signature) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	if denomination <= 0 {
+		return "", fmt.Errorf("token denomination must be a positive integer")
+	}
+	err = validatePoints(&holderKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid token serial: %w", err)
+	}
+	err = validatePoints(&signature.R, &ownership.R)
+	if err != nil {
+		return "", fmt.Errorf("invalid token signature: %w", err)
+	}
+
+	stub := ctx.GetStub()
+
+	issuerKey, err := getTokenIssuerKey(ctx, denomination)
+	if err != nil {
+		return "", err
+	}
+	issuerBytes, err := stub.GetState(issuerKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token issuer from world state: %v", err)
+	}
+	if issuerBytes == nil {
+		return "", fmt.Errorf("no token issuer for denomination %d, call SetTokenIssuer() first", denomination)
+	}
+	var issuer ristretto.Point
+	err = issuer.UnmarshalBinary(issuerBytes)
+	if err != nil {
+		return "", fmt.Errorf("error unmarshalling")
+	}
+
+	if !blindsig.Verify(&issuer, BlindTokenMessage(&holderKey), signature) {
+		return "", errors.New("token signature not valid")
+	}
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+	if !schnorr.Verify(&holderKey, RedeemTokenMessage(stub.GetTxID(), clientID), ownership) {
+		return "", errors.New("token ownership signature not valid")
+	}
+
+	serial := holderKey.String()
+	serialKey, err := stub.CreateCompositeKey(spentSerialObjectType, []string{serial})
+	if err != nil {
+		return "", fmt.Errorf("failed to create the composite key: %v", err)
+	}
+	spent, err := stub.GetState(serialKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to read spent serial from world state: %v", err)
+	}
+	if spent != nil {
+		return "", fmt.Errorf("token %s already redeemed", serial)
+	}
+	err = stub.PutState(serialKey, []byte(stub.GetTxID()))
+	if err != nil {
+		return "", err
+	}
+
+	// The denomination is public, so it is committed with a zero blinding factor
+	H, err := GetPedersenParams(ctx)
+	if err != nil {
+		return "", fmt.Errorf("redeeming failed: %v", err)
+	}
+	value, err := newAmount(ctx, denomination)
+	if err != nil {
+		return "", fmt.Errorf("redeeming failed: %v", err)
+	}
+	committedAmount := pedersen.CommitTo(H, pedersen.NewSecretFromUint64(0), value)
+
+	currentBalance, updatedBalance, err := addToBalance(ctx, clientID, &committedAmount)
+	if err != nil {
+		return "", err
+	}
+
+	// Redeemed tokens enter the supply
+	err = addToSupply(ctx, value, &committedAmount)
+	if err != nil {
+		return "", err
+	}
+
+	// Emit the Transfer event
+	transferEvent := transferEvent{"0x0", clientID, "Blind token redeemed"}
+	transferEventJSON, err := json.Marshal(transferEvent)
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = stub.SetEvent("Transfer", transferEventJSON)
+	if err != nil {
+		return "", fmt.Errorf("failed to set event: %v", err)
+	}
+
+	log.Printf("client account %s balance updated from %d to %d", clientID, currentBalance, updatedBalance)
+
+	return stub.GetTxID(), nil
+}
+
+func getTokenIssuerKey(ctx contractapi.TransactionContextInterface, denomination int64) (string, error) {
+	issuerKey, err := ctx.GetStub().CreateCompositeKey(tokenIssuerObjectType, []string{strconv.FormatInt(denomination, 10)})
+	if err != nil {
+		return "", fmt.Errorf("failed to create the composite key: %v", err)
+	}
+	return issuerKey, nil
+}
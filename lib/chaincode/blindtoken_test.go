@@ -0,0 +1,98 @@
+package chaincode
+
+import (
+	"pedersen-commitment-transfer/src/blindsig"
+	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/schnorr"
+	"testing"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetTokenIssuer(t *testing.T) {
+	ctx, _, identity, state := newTestContext("issuer", "Org1MSP")
+	initTestContract(t, ctx, state)
+
+	var publicKey ristretto.Point
+	publicKey.Rand()
+	ok, err := new(SmartContract).SetTokenIssuer(ctx, 50, publicKey)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	issuerKey, _ := getTokenIssuerKey(ctx, 50)
+	assert.Equal(t, publicKey.Bytes(), state[issuerKey])
+
+	_, err = new(SmartContract).SetTokenIssuer(ctx, 0, publicKey)
+	assert.EqualError(t, err, "token denomination must be a positive integer")
+
+	var identityKey ristretto.Point
+	identityKey.SetZero()
+	_, err = new(SmartContract).SetTokenIssuer(ctx, 50, identityKey)
+	assert.ErrorIs(t, err, pedersen.ErrIdentityPoint)
+
+	identity.GetMSPIDReturns("Org2MSP", nil)
+	_, err = new(SmartContract).SetTokenIssuer(ctx, 50, publicKey)
+	assert.EqualError(t, err, "client is not authorized to set the token issuer")
+}
+
+func TestRedeemBlindToken(t *testing.T) {
+	ctx, stub, identity, state := newTestContext("alice", "Org2MSP")
+	H, _ := initTestContract(t, ctx, state)
+
+	// One issuer key per denomination
+	var x, y ristretto.Scalar
+	x.Rand()
+	y.Rand()
+	signer := blindsig.NewSigner(&x)
+	issuerKey, _ := getTokenIssuerKey(ctx, 50)
+	state[issuerKey] = signer.X.Bytes()
+	largeSigner := blindsig.NewSigner(&y)
+	largeIssuerKey, _ := getTokenIssuerKey(ctx, 1000000)
+	state[largeIssuerKey] = largeSigner.X.Bytes()
+
+	// Blind issuance happens off-chain, on the holder's one-time key
+	var holderSecret ristretto.Scalar
+	holderSecret.Rand()
+	holderKey := schnorr.PublicKey(&holderSecret)
+	session := signer.NewSession()
+	userSession, challenge := blindsig.Blind(&signer.X, &session.R, BlindTokenMessage(&holderKey))
+	response, err := signer.Sign(session, &challenge)
+	assert.NoError(t, err)
+	signature, err := userSession.Unblind(&response)
+	assert.NoError(t, err)
+	ownership := schnorr.Sign(&holderSecret, RedeemTokenMessage("TxidTest", "alice"))
+
+	// A token signed with the key of 50 cannot be redeemed as a larger denomination
+	_, err = new(SmartContract).RedeemBlindToken(ctx, holderKey, 1000000, signature, ownership)
+	assert.EqualError(t, err, "token signature not valid")
+	_, err = new(SmartContract).RedeemBlindToken(ctx, holderKey, 60, signature, ownership)
+	assert.EqualError(t, err, "no token issuer for denomination 60, call SetTokenIssuer() first")
+
+	// Mallory sees the pending redemption and replays it in her own transaction
+	identity.GetIDReturns("mallory", nil)
+	stub.GetTxIDReturns("TxidMallory")
+	_, err = new(SmartContract).RedeemBlindToken(ctx, holderKey, 50, signature, ownership)
+	assert.EqualError(t, err, "token ownership signature not valid")
+	forged := schnorr.Sign(&y, RedeemTokenMessage("TxidMallory", "mallory"))
+	_, err = new(SmartContract).RedeemBlindToken(ctx, holderKey, 50, signature, forged)
+	assert.EqualError(t, err, "token ownership signature not valid")
+	assert.Nil(t, state["mallory"])
+
+	identity.GetIDReturns("alice", nil)
+	stub.GetTxIDReturns("TxidTest")
+	_, err = new(SmartContract).RedeemBlindToken(ctx, holderKey, 50, signature, ownership)
+	assert.NoError(t, err)
+
+	var zero ristretto.Scalar
+	credit := commitAmount(&H, zero.SetZero(), 50)
+	balance := readPoint(t, state, "alice")
+	assert.True(t, balance.Equals(&credit))
+	assert.Equal(t, "50", string(state[totalSupplyKey]))
+
+	var event transferEvent
+	assert.Equal(t, "Transfer", readEvent(t, stub, 0, &event))
+	assert.Equal(t, "alice", event.To)
+
+	_, err = new(SmartContract).RedeemBlindToken(ctx, holderKey, 50, signature, ownership)
+	assert.EqualError(t, err, "token "+holderKey.String()+" already redeemed")
+}
@@ -0,0 +1,125 @@
+package chaincode
+
+import (
+	"errors"
+	"fmt"
+	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/rangeproof"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Burn destroys committedAmount from the client account and removes it from the total supply
+// The amount is opened in the transient map as for Mint, with its blinding factor under "amountBlinding"
+// once the total supply is confidential. balanceProof is a range proof on what is left of the balance.
+// This function triggers a Transfer event
+func (s *SmartContract) Burn(ctx contractapi.TransactionContextInterface, committedAmount ristretto.Point, balanceProof rangeproof.Proof) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	// Get ID of submitting client identity
+	holder, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+	err = destroyTokens(ctx, holder, &committedAmount, balanceProof)
+	if err != nil {
+		return "", fmt.Errorf("burning failed: %w", err)
+	}
+
+	err = emitTransferEvent(ctx, transferEvent{holder, "0x0", "Token Burn"})
+	if err != nil {
+		return "", err
+	}
+	return ctx.GetStub().GetTxID(), nil
+}
+
+// Redeem destroys committedAmount from account for the issuer, for example when the holder cashes it out
+// The holder gives the issuer the proofs Burn takes. Only the holder knows the opening of the balance,
+// so the range proof on what is left of it also shows the holder agreed to the redemption.
+// This function triggers a Transfer event
+func (s *SmartContract) Redeem(ctx contractapi.TransactionContextInterface, account string, committedAmount ristretto.Point, balanceProof rangeproof.Proof) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	// Check issuer authorization - this sample assumes Org1 is the central banker with privilege to redeem tokens
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get MSPID: %v", err)
+	}
+	if clientMSPID != "Org1MSP" {
+		return "", fmt.Errorf("client is not authorized to redeem tokens")
+	}
+
+	err = destroyTokens(ctx, account, &committedAmount, balanceProof)
+	if err != nil {
+		return "", fmt.Errorf("redeeming failed: %w", err)
+	}
+
+	err = emitTransferEvent(ctx, transferEvent{account, "0x0", "Token Redeem"})
+	if err != nil {
+		return "", err
+	}
+	return ctx.GetStub().GetTxID(), nil
+}
+
+// destroyTokens takes committedAmount out of account and out of the total supply
+func destroyTokens(ctx contractapi.TransactionContextInterface, account string, committedAmount *ristretto.Point, balanceProof rangeproof.Proof) error {
+	err := validateCommitments(committedAmount)
+	if err != nil {
+		return err
+	}
+	amount, err := getTransientAmount(ctx, "amount")
+	if err != nil {
+		return err
+	}
+	if amount.IsZero() {
+		return errors.New("amount must be a positive integer")
+	}
+	amountProof, err := getTransientOpeningProof(ctx, amountProofKey)
+	if err != nil {
+		return err
+	}
+	err = IsValidEncryption(ctx, amount, committedAmount, amountProof)
+	if err != nil {
+		return err
+	}
+
+	balance, err := getCommittedBalance(ctx, account)
+	if err != nil {
+		return err
+	}
+	err = checkAccountEpoch(ctx, account)
+	if err != nil {
+		return err
+	}
+	err = isValidRemainder(ctx, "balance", &balance.Commitment, committedAmount, balanceProof)
+	if err != nil {
+		return err
+	}
+	remaining := pedersen.Sub(&balance.Commitment, committedAmount)
+	err = removeFromSupply(ctx, amount, committedAmount)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().PutState(account, remaining.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to update client account %s: %v", account, err)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package chaincode
+
+import (
+	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/rangeproof"
+	"testing"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBurn(t *testing.T) {
+	ctx, stub, _, state := newTestContext("alice", "Org2MSP")
+	H, bindingFactor := initTestContract(t, ctx, state)
+	balance := commitAmount(&H, &bindingFactor, 100)
+	state["alice"] = balance.Bytes()
+	state[totalSupplyKey] = []byte("500")
+
+	var rBurn, rLeft ristretto.Scalar
+	rBurn.Rand()
+	rLeft.Sub(&bindingFactor, &rBurn)
+	burned := commitAmount(&H, &rBurn, 30)
+	balanceProof, err := rangeproof.Prove(&H, testAmount(70), pedersen.NewSecret(&rLeft))
+	assert.NoError(t, err)
+
+	stub.GetTransientReturns(transientOpening(&H, &rBurn, 30), nil)
+	_, err = new(SmartContract).Burn(ctx, burned, rangeproof.Proof{})
+	assert.EqualError(t, err, "burning failed: balance range proof not valid")
+
+	_, err = new(SmartContract).Burn(ctx, burned, balanceProof)
+	assert.NoError(t, err)
+
+	expectedBalance := pedersen.Sub(&balance, &burned)
+	aliceBalance := readPoint(t, state, "alice")
+	assert.True(t, aliceBalance.Equals(&expectedBalance))
+	assert.Equal(t, "470", string(state[totalSupplyKey]))
+
+	var event transferEvent
+	assert.Equal(t, "Transfer", readEvent(t, stub, 0, &event))
+	assert.Equal(t, transferEvent{"alice", "0x0", "Token Burn"}, event)
+
+	// The balance proof was for the previous balance
+	_, err = new(SmartContract).Burn(ctx, burned, balanceProof)
+	assert.EqualError(t, err, "burning failed: balance range proof not valid")
+}
+
+func TestRedeem(t *testing.T) {
+	ctx, stub, identity, state := newTestContext("alice", "Org2MSP")
+	H, bindingFactor := initTestContract(t, ctx, state)
+	balance := commitAmount(&H, &bindingFactor, 100)
+	state["alice"] = balance.Bytes()
+	state[totalSupplyKey] = []byte("100")
+
+	// Alice cashes out everything
+	var rLeft ristretto.Scalar
+	rLeft.SetZero()
+	balanceProof, err := rangeproof.Prove(&H, testAmount(0), pedersen.NewSecret(&rLeft))
+	assert.NoError(t, err)
+	stub.GetTransientReturns(transientOpening(&H, &bindingFactor, 100), nil)
+
+	_, err = new(SmartContract).Redeem(ctx, "alice", balance, balanceProof)
+	assert.EqualError(t, err, "client is not authorized to redeem tokens")
+
+	identity.GetIDReturns("issuer", nil)
+	identity.GetMSPIDReturns("Org1MSP", nil)
+	_, err = new(SmartContract).Redeem(ctx, "bob", balance, balanceProof)
+	assert.EqualError(t, err, "redeeming failed: the account bob does not exist")
+
+	_, err = new(SmartContract).Redeem(ctx, "alice", balance, balanceProof)
+	assert.NoError(t, err)
+
+	var zero ristretto.Point
+	zero.SetZero()
+	aliceBalance := readPoint(t, state, "alice")
+	assert.True(t, aliceBalance.Equals(&zero))
+	assert.Equal(t, "0", string(state[totalSupplyKey]))
+
+	var event transferEvent
+	assert.Equal(t, "Transfer", readEvent(t, stub, 0, &event))
+	assert.Equal(t, transferEvent{"alice", "0x0", "Token Redeem"}, event)
+}
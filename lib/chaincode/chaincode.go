@@ -1,13 +1,15 @@
 package chaincode
 
 import (
-	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"pedersen-commitment-transfer/src/equality"
 	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/rangeproof"
 	"strconv"
+	"strings"
 
 	"github.com/bwesterb/go-ristretto"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
@@ -20,9 +22,11 @@ const decimalsKey = "decimals"
 const totalSupplyKey = "totalSupply"
 const temporaryAccountAddressPrefix = "Staged"
 
-const TIMELOCK = 1000 //number of blocks we wait for the tx to be approved or rejected
-// Define objectType names for prefix
-// const allowancePrefix = "allowance"
+// Composite keys start with this byte, which client IDs never do
+const compositeKeyNamespace = "\x00"
+
+// A committed balance is stored as a 32 byte point
+const commitmentSize = 32
 
 // Define key names for options
 
@@ -31,6 +35,11 @@ type SmartContract struct {
 	contractapi.Contract
 }
 
+// GetEvaluateTransactions lists the read-only queries, which clients evaluate rather than submit
+func (s *SmartContract) GetEvaluateTransactions() []string {
+	return []string{"BalanceOf", "ClientAccountBalance", "ClientAccountID", "TotalSupply", "GetDisclosedTotal", "GetJointAccount", "GetSwap", "GetTransferStatus", "Allowance", "SupplyCommitment", "GetSupplyBound"}
+}
+
 // event provides an organized struct for emitting events
 type transferEvent struct {
 	From    string `json:"from"`
@@ -50,6 +59,20 @@ type rejectEvent struct {
 	Message string `json:"message"`
 }
 
+type reclaimEvent struct {
+	TxID    string `json:"txId"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Message string `json:"message"`
+}
+
+// CommittedBalance is the commitment to the balance of an account and the parameter epoch it is committed in
+type CommittedBalance struct {
+	Account    string          `json:"account"`
+	Commitment ristretto.Point `json:"commitment"`
+	Epoch      uint64          `json:"epoch"`
+}
+
 type TransferDetails struct {
 	Sender    string `json:"sender"`
 	Recipient string `json:"recipient"`
@@ -58,6 +81,7 @@ type TransferDetails struct {
 
 // Pass amount as transient map -> check Mirek's public repo for blidning signatures for implementation
 // Mint creates new tokens and adds them to minter's account balance
+// The amount is opened in the transient map, see the package documentation.
 // This function triggers a Transfer event
 func (s *SmartContract) Mint(ctx contractapi.TransactionContextInterface, committedAmount ristretto.Point) (string, error) {
 
@@ -70,31 +94,25 @@ func (s *SmartContract) Mint(ctx contractapi.TransactionContextInterface, commit
 		return "", fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
 	}
 
-	//ContractAPI doesn't support transient map....
-	//We must use transient map so that private key is not revealed
-	tr, err := ctx.GetStub().GetTransient()
+	err = validateCommitments(&committedAmount)
 	if err != nil {
-		return "", fmt.Errorf("failed to get Transient field: %v", err)
-	}
-	transientAmount, ok := tr["amount"]
-	if !ok {
-		return "", errors.New("key not found")
+		return "", err
 	}
 
-	//Convert transient data from bytes to int64
-	var amount int64
-	binary.BigEndian.PutUint64(transientAmount, uint64(amount))
-
 	//Check if the encryption is valid
-	err = IsValidEncryption(ctx, amount, &committedAmount)
+	amount, err := getTransientAmount(ctx, "amount")
 	if err != nil {
-		return "", fmt.Errorf("minting failed: %v", err)
+		return "", err
 	}
-
-	_, _, zeroCommitted, err := GetPedersenParams(ctx)
+	amountProof, err := getTransientOpeningProof(ctx, amountProofKey)
+	if err != nil {
+		return "", err
+	}
+	err = IsValidEncryption(ctx, amount, &committedAmount, amountProof)
 	if err != nil {
 		return "", fmt.Errorf("minting failed: %v", err)
 	}
+
 	// Check minter authorization - this sample assumes Org1 is the central banker with privilege to mint new tokens
 	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
 	if err != nil {
@@ -110,62 +128,17 @@ func (s *SmartContract) Mint(ctx contractapi.TransactionContextInterface, commit
 		return "", fmt.Errorf("failed to get client id: %v", err)
 	}
 
-	if amount <= 0 {
+	if amount.IsZero() {
 		return "", fmt.Errorf("mint amount must be a positive integer")
 	}
 
-	currentBalanceBytes, err := ctx.GetStub().GetState(minter)
-	if err != nil {
-		return "", fmt.Errorf("failed to read minter account %s from world state: %v", minter, err)
-	}
-
-	var currentBalance ristretto.Point
-	var updatedBalance ristretto.Point
-
-	// If minter current balance doesn't yet exist, we'll create it with a current balance of 0
-	if currentBalanceBytes == nil {
-		currentBalance = *zeroCommitted
-	} else {
-		err = currentBalance.UnmarshalBinary(currentBalanceBytes) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
-	}
-
-	if err != nil {
-		return "", err
-	}
-
-	updatedBalance = pedersen.Add(&currentBalance, &committedAmount)
-
-	updatedBalanceBytes, err := updatedBalance.MarshalBinary()
+	currentBalance, updatedBalance, err := addToBalance(ctx, minter, &committedAmount)
 	if err != nil {
 		return "", err
 	}
 
-	err = ctx.GetStub().PutState(minter, updatedBalanceBytes)
-	if err != nil {
-		return "", err
-	}
-
-	// Update the totalSupply
-	totalSupplyBytes, err := ctx.GetStub().GetState(totalSupplyKey)
-	if err != nil {
-		return "", fmt.Errorf("failed to retrieve total token supply: %v", err)
-	}
-
-	var totalSupply int
-
-	// If no tokens have been minted, initialize the totalSupply
-	if totalSupplyBytes == nil {
-		totalSupply = 0
-	} else {
-		totalSupply, _ = strconv.Atoi(string(totalSupplyBytes)) // Error handling not needed since Itoa() was used when setting the totalSupply, guaranteeing it was an integer.
-	}
-
-	// Add the mint amount to the total supply and update the state
-	totalSupply, err = add(totalSupply, int(amount)) //TODO: convert all to int64
-	if err != nil {
-		return "", err
-	}
-	err = ctx.GetStub().PutState(totalSupplyKey, []byte(strconv.Itoa(totalSupply)))
+	// Add the mint amount to the total supply
+	err = addToSupply(ctx, amount, &committedAmount)
 	if err != nil {
 		return "", err
 	}
@@ -186,39 +159,14 @@ func (s *SmartContract) Mint(ctx contractapi.TransactionContextInterface, commit
 
 }
 
-// Transfer transfers tokens from client account to recipient account
-// recipient account must be a valid clientID as returned by the ClientID() function
+// Transfer transfers tokens from client account to a temporary account, to be approved by recipient
+// recipient account must be a valid clientID as returned by the ClientAccountID() function
+// No amount reaches the peer in the clear. The client sends the commitment to the amount and
+// the commitment to its balance after the transfer, range proofs that neither is negative and
+// an equality proof that newBalance hides the current balance minus the amount.
+// timelock is the time in seconds the recipient has to approve the transfer, 0 for the default.
 // This function triggers a Transfer event
-func (s *SmartContract) Transfer(ctx contractapi.TransactionContextInterface, committedAmount ristretto.Point) (string, error) {
-	stub := ctx.GetStub()
-	//ContractAPI doesn't support transient map....
-	//We must use transient map so that private key is not revealed
-	tr, err := stub.GetTransient()
-	if err != nil {
-		return "", fmt.Errorf("failed to get Transient field: %v", err)
-	}
-	transientAmount, ok := tr["amount"]
-	if !ok {
-		return "", errors.New("key not found")
-	}
-
-	transientCurrentBalance, ok := tr["balance"]
-	if !ok {
-		return "", errors.New("key not found")
-	}
-
-	//Convert transient data from bytes to int64
-	var amount int64
-	var currentBalance int64
-	binary.BigEndian.PutUint64(transientAmount, uint64(amount))
-	binary.BigEndian.PutUint64(transientCurrentBalance, uint64(currentBalance))
-
-	if amount > currentBalance {
-		return "", fmt.Errorf("you cannot send less than 0")
-	}
-	if amount > currentBalance {
-		return "", fmt.Errorf("you cannot send more money that what you have available")
-	}
+func (s *SmartContract) Transfer(ctx contractapi.TransactionContextInterface, recipient string, timelock int64, committedAmount ristretto.Point, newBalance ristretto.Point, amountProof rangeproof.Proof, balanceProof rangeproof.Proof, equalityProof equality.Proof) (string, error) {
 
 	// Check if contract has been intilized first
 	initialized, err := checkInitialized(ctx)
@@ -229,10 +177,9 @@ func (s *SmartContract) Transfer(ctx contractapi.TransactionContextInterface, co
 		return "", fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
 	}
 
-	//Check if the encryption is valid
-	err = IsValidEncryption(ctx, amount, &committedAmount)
+	err = validateCommitments(&committedAmount, &newBalance)
 	if err != nil {
-		return "", fmt.Errorf("minting failed: %v", err)
+		return "", err
 	}
 
 	// Get ID of submitting client identity
@@ -240,17 +187,43 @@ func (s *SmartContract) Transfer(ctx contractapi.TransactionContextInterface, co
 	if err != nil {
 		return "", fmt.Errorf("failed to get client id: %v", err)
 	}
+	err = checkRecipient(ctx, clientID, recipient)
+	if err != nil {
+		return "", err
+	}
+	timelock, err = resolveTimelock(ctx, timelock)
+	if err != nil {
+		return "", err
+	}
+	balance, err := getCommittedBalance(ctx, clientID)
+	if err != nil {
+		return "", err
+	}
+	err = checkAccountEpoch(ctx, clientID)
+	if err != nil {
+		return "", err
+	}
 
+	err = isValidSpend(ctx, "balance", &balance.Commitment, &committedAmount, &newBalance, amountProof, balanceProof, equalityProof)
+	if err != nil {
+		return "", err
+	}
+
+	stub := ctx.GetStub()
 	TxID := stub.GetTxID()
-	recipient := temporaryAccountAddressPrefix + "_" + TxID
 
-	err = transferHelper(ctx, clientID, recipient, committedAmount)
+	// The new balance replaces the remaining one, they only differ in their blinding factor
+	err = stub.PutState(clientID, newBalance.Bytes())
 	if err != nil {
-		return "", fmt.Errorf("failed to transfer: %v", err)
+		return "", fmt.Errorf("failed to update client account %s: %v", clientID, err)
+	}
+	stagedAccount, err := stageTransfer(ctx, TxID, clientID, recipient, &committedAmount, timelock)
+	if err != nil {
+		return "", err
 	}
 
 	// Emit the Transfer event
-	transferEvent := transferEvent{clientID, recipient, "Money sent"}
+	transferEvent := transferEvent{clientID, stagedAccount, "Money sent"}
 	transferEventJSON, err := json.Marshal(transferEvent)
 	if err != nil {
 		return "", fmt.Errorf("failed to obtain JSON encoding: %v", err)
@@ -259,16 +232,10 @@ func (s *SmartContract) Transfer(ctx contractapi.TransactionContextInterface, co
 	if err != nil {
 		return "", fmt.Errorf("failed to set event: %v", err)
 	}
-
-	err = storeTxInfo(stub, clientID, committedAmount)
-	if err != nil {
-		return "", fmt.Errorf("failed to store transaction info: %v", err)
-	}
 	return TxID, nil
 }
 
-// Transfer transfers tokens from client account to recipient account
-// recipient account must be a valid clientID as returned by the ClientID() function
+// Approve credits a pending transfer to its recipient, who must be the caller, before its deadline
 // This function triggers a Transfer event
 func (s *SmartContract) Approve(ctx contractapi.TransactionContextInterface, TxId string) (string, error) {
 	// Check if contract has been intilized first
@@ -293,17 +260,22 @@ func (s *SmartContract) Approve(ctx contractapi.TransactionContextInterface, TxI
 	txInfo, err := getTxInfo(stub, TxId)
 	if err != nil {
 		return "", fmt.Errorf("failed to get transaction info: %v", err)
-	} else if !txInfo.isValid {
-		return "", fmt.Errorf("the transaction is not valid anymore")
+	}
+	if txInfo.Recipient != clientID {
+		return "", fmt.Errorf("only the recipient can approve transfer %s", TxId)
 	}
 
-	currentBlockNumber, err := GetBlockNumber(stub)
+	// From the deadline on the transfer has expired and can no longer be approved
+	txTimestamp, err := stub.GetTxTimestamp()
 	if err != nil {
-		return "", fmt.Errorf("failed to get the block number: %v", err)
+		return "", fmt.Errorf("failed to get transaction timestamp: %v", err)
 	}
-	if currentBlockNumber-txInfo.ProposalBlockNumber <= TIMELOCK*BLOCK_GENERATION_TIME {
-		return "", fmt.Errorf("contract has expired")
+	expireIfDue(&txInfo, txTimestamp.GetSeconds())
+	err = setTransferStatus(stub, TxId, &txInfo, TransferApproved)
+	if err != nil {
+		return "", err
 	}
+
 	var committedAmount ristretto.Point                  //variable to store the current committed balance of sender
 	err = committedAmount.UnmarshalBinary(txInfo.Amount) //recipient should be clientId
 	if err != nil {
@@ -329,6 +301,9 @@ func (s *SmartContract) Approve(ctx contractapi.TransactionContextInterface, TxI
 	return stub.GetTxID(), nil
 }
 
+// Reject sends a pending transfer back to its sender
+// Only the recipient can reject it, before its deadline
+// This function triggers a Transfer event
 func (s *SmartContract) Reject(ctx contractapi.TransactionContextInterface, TxId string) (string, error) {
 
 	// Check if contract has been intilized first
@@ -354,31 +329,38 @@ func (s *SmartContract) Reject(ctx contractapi.TransactionContextInterface, TxId
 	txInfo, err := getTxInfo(stub, TxId)
 	if err != nil {
 		return "", fmt.Errorf("failed to get transaction info: %v", err)
-	} else if !txInfo.isValid {
-		return "", fmt.Errorf("the transaction is not valid anymore")
 	}
-	//
+	if txInfo.Recipient != clientID {
+		return "", fmt.Errorf("only the recipient can reject transfer %s", TxId)
+	}
+	// Ring transfers have nowhere to go back to
+	if txInfo.Sender == "" {
+		return "", fmt.Errorf("transfer %s has no known sender", TxId)
+	}
 
-	currentBlockNumber, err := GetBlockNumber(stub)
+	txTimestamp, err := stub.GetTxTimestamp()
 	if err != nil {
-		return "", fmt.Errorf("failed to get the block number: %v", err)
+		return "", fmt.Errorf("failed to get transaction timestamp: %v", err)
 	}
-	if currentBlockNumber-txInfo.ProposalBlockNumber > TIMELOCK*BLOCK_GENERATION_TIME {
-		return "", fmt.Errorf("contract has not expired")
+	expireIfDue(&txInfo, txTimestamp.GetSeconds())
+	err = setTransferStatus(stub, TxId, &txInfo, TransferRejected)
+	if err != nil {
+		return "", err
 	}
-	var committedAmount ristretto.Point                  //variable to store the current committed balance of sender
-	err = committedAmount.UnmarshalBinary(txInfo.Amount) //recipient should be clientId
+
+	var committedAmount ristretto.Point
+	err = committedAmount.UnmarshalBinary(txInfo.Amount)
 	if err != nil {
 		return "", fmt.Errorf("error unmarshalling")
 	}
 
-	err = transferHelper(ctx, temporaryAccountAddress, clientID, committedAmount)
+	err = transferHelper(ctx, temporaryAccountAddress, txInfo.Sender, committedAmount)
 	if err != nil {
 		return "", fmt.Errorf("failed to transfer: %v", err)
 	}
 
 	// Emit the Transfer event
-	transferEvent := rejectEvent{temporaryAccountAddress, clientID, "Contract rejected!"}
+	transferEvent := rejectEvent{temporaryAccountAddress, txInfo.Sender, "Contract rejected!"}
 	transferEventJSON, err := json.Marshal(transferEvent)
 	if err != nil {
 		return "", fmt.Errorf("failed to obtain JSON encoding: %v", err)
@@ -391,275 +373,177 @@ func (s *SmartContract) Reject(ctx contractapi.TransactionContextInterface, TxId
 	return stub.GetTxID(), nil
 }
 
-//TODO: return balanceof needed to know committed amount in blockchain -> probably in utils, used for testing
-// // BalanceOf returns the balance of the given account
-// func (s *SmartContract) BalanceOf(ctx contractapi.TransactionContextInterface, account string) (int, error) {
+// Reclaim returns an expired pending transfer to its sender, who must be the caller
+// The committed amount is added back to the sender's balance commitment.
+// This function triggers a Reclaim event
+func (s *SmartContract) Reclaim(ctx contractapi.TransactionContextInterface, TxId string) (string, error) {
 
-// 	// Check if contract has been intilized first
-// 	initialized, err := checkInitialized(ctx)
-// 	if err != nil {
-// 		return 0, fmt.Errorf("failed to check if contract is already initialized: %v", err)
-// 	}
-// 	if !initialized {
-// 		return 0, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
-// 	}
-
-// 	balanceBytes, err := ctx.GetStub().GetState(account)
-// 	if err != nil {
-// 		return 0, fmt.Errorf("failed to read from world state: %v", err)
-// 	}
-// 	if balanceBytes == nil {
-// 		return 0, fmt.Errorf("the account %s does not exist", account)
-// 	}
-
-// 	balance, _ := strconv.Atoi(string(balanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
-
-// 	return balance, nil
-// }
-
-// // ClientAccountBalance returns the balance of the requesting client's account
-// func (s *SmartContract) ClientAccountBalance(ctx contractapi.TransactionContextInterface) (int, error) {
-
-// 	// Check if contract has been intilized first
-// 	initialized, err := checkInitialized(ctx)
-// 	if err != nil {
-// 		return 0, fmt.Errorf("failed to check if contract is already initialized: %v", err)
-// 	}
-// 	if !initialized {
-// 		return 0, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
-// 	}
-
-// 	// Get ID of submitting client identity
-// 	clientID, err := ctx.GetClientIdentity().GetID()
-// 	if err != nil {
-// 		return 0, fmt.Errorf("failed to get client id: %v", err)
-// 	}
-
-// 	balanceBytes, err := ctx.GetStub().GetState(clientID)
-// 	if err != nil {
-// 		return 0, fmt.Errorf("failed to read from world state: %v", err)
-// 	}
-// 	if balanceBytes == nil {
-// 		return 0, fmt.Errorf("the account %s does not exist", clientID)
-// 	}
-
-// 	balance, _ := strconv.Atoi(string(balanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
-
-// 	return balance, nil
-// }
-
-// // ClientAccountID returns the id of the requesting client's account
-// // In this implementation, the client account ID is the clientId itself
-// // Users can use this function to get their own account id, which they can then give to others as the payment address
-// func (s *SmartContract) ClientAccountID(ctx contractapi.TransactionContextInterface) (string, error) {
-
-// 	// Check if contract has been intilized first
-// 	initialized, err := checkInitialized(ctx)
-// 	if err != nil {
-// 		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
-// 	}
-// 	if !initialized {
-// 		return "", fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
-// 	}
-
-// 	// Get ID of submitting client identity
-// 	clientAccountID, err := ctx.GetClientIdentity().GetID()
-// 	if err != nil {
-// 		return "", fmt.Errorf("failed to get client id: %v", err)
-// 	}
-
-// 	return clientAccountID, nil
-// }
-
-// // TotalSupply returns the total token supply
-// func (s *SmartContract) TotalSupply(ctx contractapi.TransactionContextInterface) (int, error) {
-
-// 	// Check if contract has been intilized first
-// 	initialized, err := checkInitialized(ctx)
-// 	if err != nil {
-// 		return 0, fmt.Errorf("failed to check if contract is already initialized: %v", err)
-// 	}
-// 	if !initialized {
-// 		return 0, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
-// 	}
-
-// 	// Retrieve total supply of tokens from state of smart contract
-// 	totalSupplyBytes, err := ctx.GetStub().GetState(totalSupplyKey)
-// 	if err != nil {
-// 		return 0, fmt.Errorf("failed to retrieve total token supply: %v", err)
-// 	}
-
-// 	var totalSupply int
-
-// 	// If no tokens have been minted, return 0
-// 	if totalSupplyBytes == nil {
-// 		totalSupply = 0
-// 	} else {
-// 		totalSupply, _ = strconv.Atoi(string(totalSupplyBytes)) // Error handling not needed since Itoa() was used when setting the totalSupply, guaranteeing it was an integer.
-// 	}
-
-// 	log.Printf("TotalSupply: %d tokens", totalSupply)
-
-// 	return totalSupply, nil
-// }
-
-// // Approve allows the spender to withdraw from the calling client's token account
-// // The spender can withdraw multiple times if necessary, up to the value amount
-// // This function triggers an Approval event
-// func (s *SmartContract) Approve(ctx contractapi.TransactionContextInterface, spender string, value int) error {
-
-// 	// Check if contract has been intilized first
-// 	initialized, err := checkInitialized(ctx)
-// 	if err != nil {
-// 		return fmt.Errorf("failed to check if contract is already initialized: %v", err)
-// 	}
-// 	if !initialized {
-// 		return fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
-// 	}
-
-// 	// Get ID of submitting client identity
-// 	owner, err := ctx.GetClientIdentity().GetID()
-// 	if err != nil {
-// 		return fmt.Errorf("failed to get client id: %v", err)
-// 	}
-
-// 	// Create allowanceKey
-// 	allowanceKey, err := ctx.GetStub().CreateCompositeKey(allowancePrefix, []string{owner, spender})
-// 	if err != nil {
-// 		return fmt.Errorf("failed to create the composite key for prefix %s: %v", allowancePrefix, err)
-// 	}
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
 
-// 	// Update the state of the smart contract by adding the allowanceKey and value
-// 	err = ctx.GetStub().PutState(allowanceKey, []byte(strconv.Itoa(value)))
-// 	if err != nil {
-// 		return fmt.Errorf("failed to update state of smart contract for key %s: %v", allowanceKey, err)
-// 	}
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+	return reclaimTransfer(ctx, TxId, clientID)
+}
 
-// 	// Emit the Approval event
-// 	approvalEvent := event{owner, spender, value}
-// 	approvalEventJSON, err := json.Marshal(approvalEvent)
-// 	if err != nil {
-// 		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
-// 	}
-// 	err = ctx.GetStub().SetEvent("Approval", approvalEventJSON)
-// 	if err != nil {
-// 		return fmt.Errorf("failed to set event: %v", err)
-// 	}
+// reclaimTransfer returns the expired pending transfer TxId to sender, which must be the one it was staged by
+func reclaimTransfer(ctx contractapi.TransactionContextInterface, TxId string, sender string) (string, error) {
+	stub := ctx.GetStub()
+	temporaryAccountAddress := temporaryAccountAddressPrefix + "_" + TxId
 
-// 	log.Printf("client %s approved a withdrawal allowance of %d for spender %s", owner, value, spender)
+	// Get Transaction Information
+	txInfo, err := getTxInfo(stub, TxId)
+	if err != nil {
+		return "", fmt.Errorf("failed to get transaction info: %v", err)
+	}
+	if txInfo.Sender == "" || txInfo.Sender != sender {
+		return "", fmt.Errorf("only the sender can reclaim transfer %s", TxId)
+	}
 
-// 	return nil
-// }
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return "", fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	err = expireTransfer(stub, TxId, &txInfo, txTimestamp.GetSeconds())
+	if err != nil {
+		return "", err
+	}
+	if txInfo.Status == TransferPending {
+		return "", fmt.Errorf("transfer %s can only be reclaimed from %s", TxId, formatDeadline(txInfo.Deadline))
+	}
+	err = setTransferStatus(stub, TxId, &txInfo, TransferReclaimed)
+	if err != nil {
+		return "", err
+	}
 
-// // Allowance returns the amount still available for the spender to withdraw from the owner
-// func (s *SmartContract) Allowance(ctx contractapi.TransactionContextInterface, owner string, spender string) (int, error) {
+	var committedAmount ristretto.Point
+	err = committedAmount.UnmarshalBinary(txInfo.Amount)
+	if err != nil {
+		return "", fmt.Errorf("error unmarshalling")
+	}
 
-// 	// Check if contract has been intilized first
-// 	initialized, err := checkInitialized(ctx)
-// 	if err != nil {
-// 		return 0, fmt.Errorf("failed to check if contract is already initialized: %v", err)
-// 	}
-// 	if !initialized {
-// 		return 0, fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
-// 	}
+	err = transferHelper(ctx, temporaryAccountAddress, sender, committedAmount)
+	if err != nil {
+		return "", fmt.Errorf("failed to transfer: %v", err)
+	}
 
-// 	// Create allowanceKey
-// 	allowanceKey, err := ctx.GetStub().CreateCompositeKey(allowancePrefix, []string{owner, spender})
-// 	if err != nil {
-// 		return 0, fmt.Errorf("failed to create the composite key for prefix %s: %v", allowancePrefix, err)
-// 	}
+	reclaimEventJSON, err := json.Marshal(reclaimEvent{TxId, temporaryAccountAddress, sender, "Contract reclaimed!"})
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = stub.SetEvent("Reclaim", reclaimEventJSON)
+	if err != nil {
+		return "", fmt.Errorf("failed to set event: %v", err)
+	}
 
-// 	// Read the allowance amount from the world state
-// 	allowanceBytes, err := ctx.GetStub().GetState(allowanceKey)
-// 	if err != nil {
-// 		return 0, fmt.Errorf("failed to read allowance for %s from world state: %v", allowanceKey, err)
-// 	}
+	return stub.GetTxID(), nil
+}
 
-// 	var allowance int
+// BalanceOf returns the committed balance of the given account
+func (s *SmartContract) BalanceOf(ctx contractapi.TransactionContextInterface, account string) (*CommittedBalance, error) {
 
-// 	// If no current allowance, set allowance to 0
-// 	if allowanceBytes == nil {
-// 		allowance = 0
-// 	} else {
-// 		allowance, err = strconv.Atoi(string(allowanceBytes)) // Error handling not needed since Itoa() was used when setting the totalSupply, guaranteeing it was an integer.
-// 	}
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return nil, fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
 
-// 	log.Printf("The allowance left for spender %s to withdraw from owner %s: %d", spender, owner, allowance)
+	return getCommittedBalance(ctx, account)
+}
 
-// 	return allowance, nil
-// }
+// ClientAccountBalance returns the committed balance of the requesting client's account
+func (s *SmartContract) ClientAccountBalance(ctx contractapi.TransactionContextInterface) (*CommittedBalance, error) {
 
-// // TransferFrom transfers the value amount from the "from" address to the "to" address
-// // This function triggers a Transfer event
-// func (s *SmartContract) TransferFrom(ctx contractapi.TransactionContextInterface, from string, to string, value int) error {
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return nil, fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
 
-// 	// Check if contract has been intilized first
-// 	initialized, err := checkInitialized(ctx)
-// 	if err != nil {
-// 		return fmt.Errorf("failed to check if contract is already initialized: %v", err)
-// 	}
-// 	if !initialized {
-// 		return fmt.Errorf("Contract options need to be set before calling any function, call Initialize() to initialize contract")
-// 	}
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client id: %v", err)
+	}
 
-// 	// Get ID of submitting client identity
-// 	spender, err := ctx.GetClientIdentity().GetID()
-// 	if err != nil {
-// 		return fmt.Errorf("failed to get client id: %v", err)
-// 	}
+	return getCommittedBalance(ctx, clientID)
+}
 
-// 	// Create allowanceKey
-// 	allowanceKey, err := ctx.GetStub().CreateCompositeKey(allowancePrefix, []string{from, spender})
-// 	if err != nil {
-// 		return fmt.Errorf("failed to create the composite key for prefix %s: %v", allowancePrefix, err)
-// 	}
+// ClientAccountID returns the id of the requesting client's account
+// In this implementation, the client account ID is the clientId itself
+// Users can use this function to get their own account id, which they can then give to others as the payment address
+func (s *SmartContract) ClientAccountID(ctx contractapi.TransactionContextInterface) (string, error) {
 
-// 	// Retrieve the allowance of the spender
-// 	currentAllowanceBytes, err := ctx.GetStub().GetState(allowanceKey)
-// 	if err != nil {
-// 		return fmt.Errorf("failed to retrieve the allowance for %s from world state: %v", allowanceKey, err)
-// 	}
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
 
-// 	var currentAllowance int
-// 	currentAllowance, _ = strconv.Atoi(string(currentAllowanceBytes)) // Error handling not needed since Itoa() was used when setting the totalSupply, guaranteeing it was an integer.
+	// Get ID of submitting client identity
+	clientAccountID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
 
-// 	// Check if transferred value is less than allowance
-// 	if currentAllowance < value {
-// 		return fmt.Errorf("spender does not have enough allowance for transfer")
-// 	}
+	return clientAccountID, nil
+}
 
-// 	// Initiate the transfer
-// 	err = transferHelper(ctx, from, to, value)
-// 	if err != nil {
-// 		return fmt.Errorf("failed to transfer: %v", err)
-// 	}
+// TotalSupply returns the total token supply in base units
+func (s *SmartContract) TotalSupply(ctx contractapi.TransactionContextInterface) (int, error) {
 
-// 	// Decrease the allowance
-// 	updatedAllowance, err := sub(currentAllowance, value)
-// 	if err != nil {
-// 		return err
-// 	}
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return 0, fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
 
-// 	err = ctx.GetStub().PutState(allowanceKey, []byte(strconv.Itoa(updatedAllowance)))
-// 	if err != nil {
-// 		return err
-// 	}
+	confidential, err := isSupplyConfidential(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if confidential {
+		return 0, errors.New("total supply is confidential, call SupplyCommitment()")
+	}
 
-// 	// Emit the Transfer event
-// 	transferEvent := event{from, to, value}
-// 	transferEventJSON, err := json.Marshal(transferEvent)
-// 	if err != nil {
-// 		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
-// 	}
-// 	err = ctx.GetStub().SetEvent("Transfer", transferEventJSON)
-// 	if err != nil {
-// 		return fmt.Errorf("failed to set event: %v", err)
-// 	}
+	// Retrieve total supply of tokens from state of smart contract
+	totalSupplyBytes, err := ctx.GetStub().GetState(totalSupplyKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve total token supply: %v", err)
+	}
 
-// 	log.Printf("spender %s allowance updated from %d to %d", spender, currentAllowance, updatedAllowance)
+	// If no tokens have been minted, return 0
+	if totalSupplyBytes == nil {
+		return 0, nil
+	}
+	totalSupply, err := strconv.Atoi(string(totalSupplyBytes))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse total token supply: %v", err)
+	}
 
-// 	return nil
-// }
+	return totalSupply, nil
+}
 
 // // Name returns a descriptive name for fungible tokens in this contract
 // // returns {String} Returns the name of the token
@@ -709,9 +593,19 @@ func (s *SmartContract) Reject(ctx contractapi.TransactionContextInterface, TxId
 // param {String} name The name of the token
 // param {String} symbol The symbol of the token
 // param {String} decimals The decimals used for the token operations
-func (s *SmartContract) Initialize(ctx contractapi.TransactionContextInterface, name string, symbol string, decimals string, H ristretto.Point, bindingFactor ristretto.Scalar) (bool, error) {
+// param {TimelockConfig} timelock The time recipients have to approve pending transfers
+func (s *SmartContract) Initialize(ctx contractapi.TransactionContextInterface, name string, symbol string, decimals string, H ristretto.Point, timelock TimelockConfig) (bool, error) {
 
-	err := InitPedersen(ctx, H, bindingFactor)
+	_, err := parseDenomination([]byte(decimals))
+	if err != nil {
+		return false, err
+	}
+	err = timelock.Validate()
+	if err != nil {
+		return false, err
+	}
+
+	err = InitPedersen(ctx, H)
 	if err != nil {
 		return false, fmt.Errorf("failed to init Pedersen Params: %v", err)
 	}
@@ -748,6 +642,11 @@ func (s *SmartContract) Initialize(ctx contractapi.TransactionContextInterface,
 		return false, fmt.Errorf("failed to set token name: %v", err)
 	}
 
+	err = putTimelockConfig(ctx, timelock)
+	if err != nil {
+		return false, err
+	}
+
 	return true, nil
 }
 
@@ -761,62 +660,105 @@ func transferHelper(ctx contractapi.TransactionContextInterface, from string, to
 		return fmt.Errorf("cannot transfer to and from same client account")
 	}
 
-	fromCurrentBalanceBytes, err := ctx.GetStub().GetState(from)
+	//Remove funds from committed amount of sender
+	fromCurrentBalance, updatedFromBalance, err := subtractFromBalance(ctx, from, &committedAmount)
 	if err != nil {
-		return fmt.Errorf("failed to read client account %s from world state: %v", from, err)
-	}
-	if fromCurrentBalanceBytes == nil {
-		return fmt.Errorf("client account %s has no balance", from)
+		return err
 	}
 
-	var fromCurrentBalance ristretto.Point //variable to store the current committed balance of sender
-	err = fromCurrentBalance.UnmarshalBinary(fromCurrentBalanceBytes)
+	//add funds to recipient
+	toCurrentBalance, updatedToBalance, err := addToBalance(ctx, to, &committedAmount)
 	if err != nil {
-		return fmt.Errorf("error unmarshalling")
+		return err
 	}
-	//Remove funds from committed amount of sender
-	updatedFromBalance := pedersen.Sub(&fromCurrentBalance, &committedAmount)
-	//
 
-	toCurrentBalanceBytes, err := ctx.GetStub().GetState(from)
+	log.Printf("client %s balance updated from %d to %d", from, fromCurrentBalance, updatedFromBalance)
+	log.Printf("recipient %s balance updated from %d to %d", to, toCurrentBalance, updatedToBalance)
+
+	return nil
+}
+
+// subtractFromBalance removes committedAmount from the committed balance of account.
+// The account must already have a balance.
+func subtractFromBalance(ctx contractapi.TransactionContextInterface, account string, committedAmount *ristretto.Point) (ristretto.Point, ristretto.Point, error) {
+	currentBalanceBytes, err := ctx.GetStub().GetState(account)
 	if err != nil {
-		return fmt.Errorf("failed to read target account %s from world state: %v", from, err)
+		return ristretto.Point{}, ristretto.Point{}, fmt.Errorf("failed to read client account %s from world state: %v", account, err)
 	}
-
-	var toCurrentBalance ristretto.Point //variable to store the current committed balance of sender
-	err = toCurrentBalance.UnmarshalBinary(toCurrentBalanceBytes)
+	if currentBalanceBytes == nil {
+		return ristretto.Point{}, ristretto.Point{}, fmt.Errorf("client account %s has no balance", account)
+	}
+	err = checkAccountEpoch(ctx, account)
 	if err != nil {
-		return fmt.Errorf("error unmarshalling")
+		return ristretto.Point{}, ristretto.Point{}, err
 	}
 
-	//add funds to recipient
-	updatedToBalance := pedersen.Add(&toCurrentBalance, &committedAmount)
-	//
+	var currentBalance ristretto.Point //variable to store the current committed balance of sender
+	err = currentBalance.UnmarshalBinary(currentBalanceBytes)
+	if err != nil {
+		return ristretto.Point{}, ristretto.Point{}, fmt.Errorf("error unmarshalling")
+	}
 
-	updatedFromBalanceBytes, err := fromCurrentBalance.MarshalBinary()
+	updatedBalance := pedersen.Sub(&currentBalance, committedAmount)
+	updatedBalanceBytes, err := updatedBalance.MarshalBinary()
 	if err != nil {
-		return err
+		return ristretto.Point{}, ristretto.Point{}, err
 	}
 
-	err = ctx.GetStub().PutState(from, updatedFromBalanceBytes)
+	err = ctx.GetStub().PutState(account, updatedBalanceBytes)
 	if err != nil {
-		return err
+		return ristretto.Point{}, ristretto.Point{}, err
 	}
 
-	updatedToBalanceBytes, err := toCurrentBalance.MarshalBinary()
+	return currentBalance, updatedBalance, nil
+}
+
+// addToBalance adds committedAmount to the committed balance of account.
+// An account without a balance starts from zero committed with a zero blinding factor,
+// so its owner knows the blinding factor of the balance from those of the amounts received.
+func addToBalance(ctx contractapi.TransactionContextInterface, account string, committedAmount *ristretto.Point) (ristretto.Point, ristretto.Point, error) {
+	currentBalanceBytes, err := ctx.GetStub().GetState(account)
 	if err != nil {
-		return err
+		return ristretto.Point{}, ristretto.Point{}, fmt.Errorf("failed to read target account %s from world state: %v", account, err)
 	}
 
-	err = ctx.GetStub().PutState(to, updatedToBalanceBytes)
+	var currentBalance ristretto.Point
+	if currentBalanceBytes == nil {
+		currentBalance.SetZero()
+
+		epoch, err := getPedersenEpoch(ctx)
+		if err != nil {
+			return ristretto.Point{}, ristretto.Point{}, err
+		}
+		if epoch != 0 {
+			err = setAccountEpoch(ctx, account, epoch)
+			if err != nil {
+				return ristretto.Point{}, ristretto.Point{}, err
+			}
+		}
+	} else {
+		err = currentBalance.UnmarshalBinary(currentBalanceBytes)
+		if err != nil {
+			return ristretto.Point{}, ristretto.Point{}, fmt.Errorf("error unmarshalling")
+		}
+		err = checkAccountEpoch(ctx, account)
+		if err != nil {
+			return ristretto.Point{}, ristretto.Point{}, err
+		}
+	}
+
+	updatedBalance := pedersen.Add(&currentBalance, committedAmount)
+	updatedBalanceBytes, err := updatedBalance.MarshalBinary()
 	if err != nil {
-		return err
+		return ristretto.Point{}, ristretto.Point{}, err
 	}
 
-	log.Printf("client %s balance updated from %d to %d", from, fromCurrentBalance, updatedFromBalance)
-	log.Printf("recipient %s balance updated from %d to %d", to, toCurrentBalance, updatedToBalance)
+	err = ctx.GetStub().PutState(account, updatedBalanceBytes)
+	if err != nil {
+		return ristretto.Point{}, ristretto.Point{}, err
+	}
 
-	return nil
+	return currentBalance, updatedBalance, nil
 }
 
 // add two number checking for overflow
@@ -832,6 +774,126 @@ func add(b int, q int) (int, error) {
 	return sum, nil
 }
 
+// supplyUnits returns the base units of amount, which must fit the total supply
+func supplyUnits(amount pedersen.Amount) (int, error) {
+	units := amount.Units()
+	if !units.IsInt64() || int64(int(units.Int64())) != units.Int64() {
+		return 0, fmt.Errorf("amount %s does not fit the total supply", amount)
+	}
+	return int(units.Int64()), nil
+}
+
+// updateTotalSupply adds delta base units to the total supply, a negative delta removes them
+func updateTotalSupply(ctx contractapi.TransactionContextInterface, delta int) error {
+	totalSupplyBytes, err := ctx.GetStub().GetState(totalSupplyKey)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve total token supply: %v", err)
+	}
+
+	var totalSupply int
+
+	// If no tokens have been minted, initialize the totalSupply
+	if totalSupplyBytes == nil {
+		totalSupply = 0
+	} else {
+		totalSupply, _ = strconv.Atoi(string(totalSupplyBytes)) // Error handling not needed since Itoa() was used when setting the totalSupply, guaranteeing it was an integer.
+	}
+
+	totalSupply, err = add(totalSupply, delta)
+	if err != nil {
+		return err
+	}
+	if totalSupply < 0 {
+		return fmt.Errorf("total supply cannot go below zero")
+	}
+	err = ctx.GetStub().PutState(totalSupplyKey, []byte(strconv.Itoa(totalSupply)))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// getCommittedBalance reads the balance of account; it fails for accounts that have never held tokens
+func getCommittedBalance(ctx contractapi.TransactionContextInterface, account string) (*CommittedBalance, error) {
+	balanceBytes, err := ctx.GetStub().GetState(account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if balanceBytes == nil {
+		return nil, fmt.Errorf("the account %s does not exist", account)
+	}
+
+	balance := CommittedBalance{Account: account}
+	err = balance.Commitment.UnmarshalBinary(balanceBytes)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling")
+	}
+	balance.Epoch, err = getAccountEpoch(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+	return &balance, nil
+}
+
+// stageTransfer moves committedAmount into the staged account of transferID, for recipient to approve
+// sender gets it back on Reject or Reclaim, so sender must know its opening. It returns the staged account.
+func stageTransfer(ctx contractapi.TransactionContextInterface, transferID string, sender string, recipient string, committedAmount *ristretto.Point, timelock int64) (string, error) {
+	stagedAccount := temporaryAccountAddressPrefix + "_" + transferID
+	_, _, err := addToBalance(ctx, stagedAccount, committedAmount)
+	if err != nil {
+		return "", fmt.Errorf("failed to transfer: %v", err)
+	}
+
+	stub := ctx.GetStub()
+	txInfo, err := createTxInfo(stub, sender, recipient, *committedAmount, timelock)
+	if err != nil {
+		return "", fmt.Errorf("failed to store transaction info: %v", err)
+	}
+	err = putTxInfo(stub, transferID, txInfo)
+	if err != nil {
+		return "", fmt.Errorf("failed to store transaction info: %v", err)
+	}
+	return stagedAccount, nil
+}
+
+// reservedKeys are the plain keys of the world state that hold contract data rather than a balance
+var reservedKeys = map[string]bool{
+	nameKey:             true,
+	symbolKey:           true,
+	decimalsKey:         true,
+	totalSupplyKey:      true,
+	PEDERSEN_ID:         true,
+	PEDERSEN_H_ID:       true,
+	pedersenEpochKey:    true,
+	timelockKey:         true,
+	feeConfigKey:        true,
+	noteTreeKey:         true,
+	supplyCommitmentKey: true,
+}
+
+// checkRecipient checks that a transfer from sender to recipient can be staged
+// recipient must be a client account: not a reserved key, a composite key or a staged account,
+// and not a key that already holds something other than a balance, such as transaction info.
+func checkRecipient(ctx contractapi.TransactionContextInterface, sender string, recipient string) error {
+	if recipient == "" {
+		return errors.New("recipient must not be empty")
+	}
+	if recipient == sender {
+		return errors.New("cannot transfer to and from same client account")
+	}
+	if reservedKeys[recipient] || strings.HasPrefix(recipient, compositeKeyNamespace) || strings.HasPrefix(recipient, temporaryAccountAddressPrefix+"_") {
+		return fmt.Errorf("recipient %s is not a client account", recipient)
+	}
+	recipientBytes, err := ctx.GetStub().GetState(recipient)
+	if err != nil {
+		return fmt.Errorf("failed to read recipient account %s from world state: %v", recipient, err)
+	}
+	if recipientBytes != nil && len(recipientBytes) != commitmentSize {
+		return fmt.Errorf("recipient %s is not a client account", recipient)
+	}
+	return nil
+}
+
 // Checks that contract options have been already initialized
 func checkInitialized(ctx contractapi.TransactionContextInterface) (bool, error) {
 	tokenName, err := ctx.GetStub().GetState(nameKey)
@@ -3,9 +3,14 @@ package chaincode
 import (
 	"encoding/json"
 	"pedersen-commitment-transfer/lib/tests/testsfakes"
+	"pedersen-commitment-transfer/src/equality"
+	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/rangeproof"
 	"testing"
 
+	"github.com/bwesterb/go-ristretto"
 	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/stretchr/testify/assert"
 )
 
 var _TestInit = []struct {
@@ -59,3 +64,219 @@ func TestCheckInit(t *testing.T) {
 		})
 	}
 }
+
+func TestTransferHelper(t *testing.T) {
+	ctx, _, _, state := newTestContext("alice", "Org2MSP")
+	H, bindingFactor := initTestContract(t, ctx, state)
+	balance := commitAmount(&H, &bindingFactor, 100)
+	state["alice"] = balance.Bytes()
+	var r ristretto.Scalar
+	r.Rand()
+	committedAmount := commitAmount(&H, &r, 30)
+
+	// Accounts without a balance start from the commitment to zero with a zero blinding factor
+	var zeroCommitted ristretto.Point
+	zeroCommitted.SetZero()
+
+	// Transfer moves the amount from the sender to a temporary account
+	staged := temporaryAccountAddressPrefix + "_TxidTest"
+	assert.NoError(t, transferHelper(ctx, "alice", staged, committedAmount))
+	expectedBalance := pedersen.Sub(&balance, &committedAmount)
+	aliceBalance := readPoint(t, state, "alice")
+	assert.True(t, aliceBalance.Equals(&expectedBalance))
+	expectedBalance = pedersen.Add(&zeroCommitted, &committedAmount)
+	stagedBalance := readPoint(t, state, staged)
+	assert.True(t, stagedBalance.Equals(&expectedBalance))
+
+	// Approve moves it on to the recipient
+	assert.NoError(t, transferHelper(ctx, staged, "bob", committedAmount))
+	bobBalance := readPoint(t, state, "bob")
+	assert.True(t, bobBalance.Equals(&expectedBalance))
+	stagedBalance = readPoint(t, state, staged)
+	assert.True(t, stagedBalance.Equals(&zeroCommitted))
+
+	assert.EqualError(t, transferHelper(ctx, "bob", "bob", committedAmount), "cannot transfer to and from same client account")
+	assert.EqualError(t, transferHelper(ctx, "carol", "bob", committedAmount), "client account carol has no balance")
+}
+
+func TestInitializeRejectsInvalidDecimals(t *testing.T) {
+	for _, decimals := range []string{"", "abc", "-1", "256"} {
+		ctx, _, _, state := newTestContext("minter", "Org1MSP")
+		H := pedersen.GenerateH()
+		_, err := new(SmartContract).Initialize(ctx, "Token", "TKN", decimals, H, defaultTimelockConfig)
+		assert.Error(t, err, "Decimals %q should be rejected", decimals)
+		assert.Empty(t, state, "Nothing should be stored")
+	}
+
+	ctx, _, _, state := newTestContext("minter", "Org1MSP")
+	H := pedersen.GenerateH()
+	_, err := new(SmartContract).Initialize(ctx, "Token", "TKN", "2", H, TimelockConfig{Default: 60, Min: 120, Max: 3600})
+	assert.EqualError(t, err, "timelocks must satisfy 0 < min <= default <= max, got min 120, default 60 and max 3600")
+	assert.Empty(t, state, "Nothing should be stored")
+
+	ok, err := new(SmartContract).Initialize(ctx, "Token", "TKN", "2", H, defaultTimelockConfig)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	denomination, err := getDenomination(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, pedersen.Denomination{Decimals: 2, Bits: amountBits}, denomination)
+	assert.Equal(t, []byte("2"), state[decimalsKey])
+}
+
+func TestBalanceQueries(t *testing.T) {
+	ctx, _, _, state := newTestContext("alice", "Org1MSP")
+	_, err := new(SmartContract).BalanceOf(ctx, "alice")
+	assert.EqualError(t, err, "contract options need to be set before calling any function, call Initialize() to initialize contract")
+
+	H, bindingFactor := initTestContract(t, ctx, state)
+	balance := commitAmount(&H, &bindingFactor, 100)
+	state["alice"] = balance.Bytes()
+
+	committed, err := new(SmartContract).BalanceOf(ctx, "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", committed.Account)
+	assert.True(t, committed.Commitment.Equals(&balance))
+	assert.Equal(t, uint64(0), committed.Epoch)
+
+	_, err = new(SmartContract).BalanceOf(ctx, "bob")
+	assert.EqualError(t, err, "the account bob does not exist")
+
+	clientBalance, err := new(SmartContract).ClientAccountBalance(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, committed, clientBalance)
+
+	// The epoch follows the account once the parameters are rotated
+	newH, _, _ := generateRandomCommitment(0)
+	_, err = new(SmartContract).RotatePedersenParams(ctx, newH)
+	assert.NoError(t, err)
+	_, _, err = addToBalance(ctx, "bob", &balance)
+	assert.NoError(t, err)
+	committed, err = new(SmartContract).BalanceOf(ctx, "bob")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), committed.Epoch)
+
+	id, err := new(SmartContract).ClientAccountID(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", id)
+
+	supply, err := new(SmartContract).TotalSupply(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, supply)
+	state[totalSupplyKey] = []byte("150")
+	supply, err = new(SmartContract).TotalSupply(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 150, supply)
+}
+
+func TestMint(t *testing.T) {
+	ctx, stub, _, state := newTestContext("minter", "Org1MSP")
+	H, bindingFactor := initTestContract(t, ctx, state)
+	committedAmount := commitAmount(&H, &bindingFactor, 500)
+
+	stub.GetTransientReturns(transientOpening(&H, &bindingFactor, 500), nil)
+	_, err := new(SmartContract).Mint(ctx, committedAmount)
+	assert.NoError(t, err)
+
+	minterBalance := readPoint(t, state, "minter")
+	assert.True(t, minterBalance.Equals(&committedAmount))
+	assert.Equal(t, "500", string(state[totalSupplyKey]))
+
+	// The proof opens the commitment to 500, not to the claimed 5000
+	transient := transientOpening(&H, &bindingFactor, 500)
+	transient["amount"] = transientAmounts(map[string]int64{"amount": 5000})["amount"]
+	stub.GetTransientReturns(transient, nil)
+	_, err = new(SmartContract).Mint(ctx, committedAmount)
+	assert.EqualError(t, err, "minting failed: encryption not valid")
+}
+
+func TestTransfer(t *testing.T) {
+	ctx, stub, _, state := newTestContext("alice", "Org2MSP")
+	H, bindingFactor := initTestContract(t, ctx, state)
+	balance := commitAmount(&H, &bindingFactor, 100)
+	state["alice"] = balance.Bytes()
+
+	// Send 30 and re-blind the remaining 70
+	var rAmount, rRemaining, rNew ristretto.Scalar
+	rAmount.Rand()
+	rNew.Rand()
+	rRemaining.Sub(&bindingFactor, &rAmount)
+	committedAmount := commitAmount(&H, &rAmount, 30)
+	newBalance := commitAmount(&H, &rNew, 70)
+	amountProof, err := rangeproof.Prove(&H, testAmount(30), pedersen.NewSecret(&rAmount))
+	assert.NoError(t, err)
+	balanceProof, err := rangeproof.Prove(&H, testAmount(70), pedersen.NewSecret(&rNew))
+	assert.NoError(t, err)
+	equalityProof := equality.Prove(&H, &H, testAmount(70), pedersen.NewSecret(&rRemaining), pedersen.NewSecret(&rNew))
+
+	_, err = new(SmartContract).Transfer(ctx, "", 0, committedAmount, newBalance, amountProof, balanceProof, equalityProof)
+	assert.EqualError(t, err, "recipient must not be empty")
+	_, err = new(SmartContract).Transfer(ctx, "alice", 0, committedAmount, newBalance, amountProof, balanceProof, equalityProof)
+	assert.EqualError(t, err, "cannot transfer to and from same client account")
+	state["TxidOld"] = []byte(`{"Sender":"carol"}`)
+	allowanceKey, _ := getAllowanceKey(ctx, "carol", "dave")
+	for _, recipient := range []string{totalSupplyKey, supplyCommitmentKey, temporaryAccountAddressPrefix + "_TxidOld", allowanceKey, "TxidOld"} {
+		_, err = new(SmartContract).Transfer(ctx, recipient, 0, committedAmount, newBalance, amountProof, balanceProof, equalityProof)
+		assert.EqualError(t, err, "recipient "+recipient+" is not a client account")
+	}
+
+	// Keeping 80 out of 100 after sending 30 does not add up
+	inflated := commitAmount(&H, &rNew, 80)
+	inflatedProof, err := rangeproof.Prove(&H, testAmount(80), pedersen.NewSecret(&rNew))
+	assert.NoError(t, err)
+	inflatedEquality := equality.Prove(&H, &H, testAmount(80), pedersen.NewSecret(&rRemaining), pedersen.NewSecret(&rNew))
+	_, err = new(SmartContract).Transfer(ctx, "bob", 0, committedAmount, inflated, amountProof, inflatedProof, inflatedEquality)
+	assert.EqualError(t, err, "balance equality proof not valid")
+
+	_, err = new(SmartContract).Transfer(ctx, "bob", 0, committedAmount, newBalance, amountProof, amountProof, equalityProof)
+	assert.EqualError(t, err, "balance range proof not valid")
+	_, err = new(SmartContract).Transfer(ctx, "bob", 0, committedAmount, newBalance, balanceProof, balanceProof, equalityProof)
+	assert.EqualError(t, err, "amount range proof not valid")
+
+	_, err = new(SmartContract).Transfer(ctx, "bob", 60, committedAmount, newBalance, amountProof, balanceProof, equalityProof)
+	assert.EqualError(t, err, "timelock must be between 3600 and 2592000 seconds, got 60")
+
+	txID, err := new(SmartContract).Transfer(ctx, "bob", 7200, committedAmount, newBalance, amountProof, balanceProof, equalityProof)
+	assert.NoError(t, err)
+	txInfo, err := getTxInfo(stub, txID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(123456789+7200), txInfo.Deadline)
+	assert.Equal(t, 0, stub.GetTransientCallCount(), "No transient data is needed")
+
+	staged := readPoint(t, state, temporaryAccountAddressPrefix+"_"+txID)
+	assert.True(t, staged.Equals(&committedAmount))
+	aliceBalance := readPoint(t, state, "alice")
+	assert.True(t, aliceBalance.Equals(&newBalance))
+
+	var event transferEvent
+	assert.Equal(t, "Transfer", readEvent(t, stub, 0, &event))
+	assert.Equal(t, "alice", event.From)
+
+	_, err = new(SmartContract).Transfer(ctx, "bob", 0, committedAmount, newBalance, amountProof, balanceProof, equalityProof)
+	assert.EqualError(t, err, "balance equality proof not valid", "The proofs are bound to the spent balance")
+}
+
+func TestPendingTransferParties(t *testing.T) {
+	ctx, stub, identity, state := newTestContext("alice", "Org2MSP")
+	H, bindingFactor := initTestContract(t, ctx, state)
+	committedAmount := commitAmount(&H, &bindingFactor, 30)
+	state[temporaryAccountAddressPrefix+"_TxidTest"] = committedAmount.Bytes()
+	assert.NoError(t, storeTxInfo(stub, "alice", "bob", committedAmount, 3600))
+
+	_, err := new(SmartContract).Approve(ctx, "TxidTest")
+	assert.EqualError(t, err, "only the recipient can approve transfer TxidTest")
+	_, err = new(SmartContract).Reject(ctx, "TxidTest")
+	assert.EqualError(t, err, "only the recipient can reject transfer TxidTest")
+	identity.GetIDReturns("bob", nil)
+	_, err = new(SmartContract).Reclaim(ctx, "TxidTest")
+	assert.EqualError(t, err, "only the sender can reclaim transfer TxidTest")
+
+	// Nobody can take back a ring transfer
+	stub.GetTxIDReturns("TxidRing")
+	assert.NoError(t, storeTxInfo(stub, "", "bob", committedAmount, 3600))
+	_, err = new(SmartContract).Reject(ctx, "TxidRing")
+	assert.EqualError(t, err, "transfer TxidRing has no known sender")
+	identity.GetIDReturns("", nil)
+	_, err = new(SmartContract).Reclaim(ctx, "TxidRing")
+	assert.EqualError(t, err, "only the sender can reclaim transfer TxidRing")
+}
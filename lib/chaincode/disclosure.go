@@ -0,0 +1,138 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/sumproof"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Object type for the composite keys of disclosed totals
+const disclosedTotalObjectType = "disclosedTotal"
+
+// DisclosedTotal is a public total of the commitments stored under Keys
+// Commitments are the values of the keys when the total was disclosed; balances may have moved since.
+type DisclosedTotal struct {
+	Keys        []string          `json:"keys"`
+	Commitments []ristretto.Point `json:"commitments"`
+	Total       string            `json:"total"`
+	DisclosedBy string            `json:"disclosedBy"`
+}
+
+// DiscloseTotal records that the commitments stored under keys add up to total,
+// a decimal amount in display units, without revealing the individual amounts
+// The proof shows knowledge of the blinding factor of the sum minus total H.
+// This function triggers a TotalDisclosed event
+func (s *SmartContract) DiscloseTotal(ctx contractapi.TransactionContextInterface, keys []string, total string, proof sumproof.Proof) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	if len(keys) == 0 {
+		return "", errors.New("a disclosed total needs at least one commitment")
+	}
+	err = validatePoints(&proof.R)
+	if err != nil {
+		return "", fmt.Errorf("invalid sum proof: %w", err)
+	}
+
+	denomination, err := getDenomination(ctx)
+	if err != nil {
+		return "", err
+	}
+	// The sum of many amounts may not fit in the width of a single one
+	denomination.Bits = pedersen.MaxAmountBits
+	totalAmount, err := denomination.Parse(total)
+	if err != nil {
+		return "", err
+	}
+
+	stub := ctx.GetStub()
+	commitments := make([]ristretto.Point, len(keys))
+	seen := make(map[string]bool, len(keys))
+	for i, key := range keys {
+		if seen[key] {
+			return "", fmt.Errorf("commitment %s is listed twice", key)
+		}
+		seen[key] = true
+
+		commitmentBytes, err := stub.GetState(key)
+		if err != nil {
+			return "", fmt.Errorf("failed to read commitment %s from world state: %v", key, err)
+		}
+		if commitmentBytes == nil {
+			return "", fmt.Errorf("commitment %s does not exist", key)
+		}
+		commitments[i], err = pedersen.DecodePoint(commitmentBytes)
+		if err != nil {
+			return "", fmt.Errorf("%s does not hold a commitment: %v", key, err)
+		}
+	}
+
+	H, err := GetPedersenParams(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch pedersen encryption parameters: %v", err)
+	}
+	if !sumproof.Verify(H, commitments, totalAmount, proof) {
+		return "", errors.New("sum proof not valid")
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+	record := DisclosedTotal{Keys: keys, Commitments: commitments, Total: totalAmount.String(), DisclosedBy: clientID}
+	recordJSON, err := json.Marshal(&record)
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	TxID := stub.GetTxID()
+	recordKey, err := stub.CreateCompositeKey(disclosedTotalObjectType, []string{TxID})
+	if err != nil {
+		return "", fmt.Errorf("failed to create the composite key: %v", err)
+	}
+	err = stub.PutState(recordKey, recordJSON)
+	if err != nil {
+		return "", fmt.Errorf("failed to put to world state. %v", err)
+	}
+
+	err = stub.SetEvent("TotalDisclosed", recordJSON)
+	if err != nil {
+		return "", fmt.Errorf("failed to set event: %v", err)
+	}
+
+	return TxID, nil
+}
+
+// GetDisclosedTotal returns the total disclosed in transaction TxId
+func (s *SmartContract) GetDisclosedTotal(ctx contractapi.TransactionContextInterface, TxId string) (*DisclosedTotal, error) {
+	stub := ctx.GetStub()
+	recordKey, err := stub.CreateCompositeKey(disclosedTotalObjectType, []string{TxId})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key: %v", err)
+	}
+	recordJSON, err := stub.GetState(recordKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read disclosed total from world state: %v", err)
+	}
+	if recordJSON == nil {
+		return nil, fmt.Errorf("no total disclosed in transaction %s", TxId)
+	}
+	var record DisclosedTotal
+	err = json.Unmarshal(recordJSON, &record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal: %v", err)
+	}
+	return &record, nil
+}
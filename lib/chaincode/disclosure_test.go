@@ -0,0 +1,52 @@
+package chaincode
+
+import (
+	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/sumproof"
+	"testing"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscloseTotal(t *testing.T) {
+	ctx, stub, _, state := newTestContext("treasurer", "Org1MSP")
+	H, _ := initTestContract(t, ctx, state)
+
+	var r1, r2, sum ristretto.Scalar
+	r1.Rand()
+	r2.Rand()
+	alice := commitAmount(&H, &r1, 1200)
+	bob := commitAmount(&H, &r2, 3400)
+	state["alice"] = alice.Bytes()
+	state["bob"] = bob.Bytes()
+
+	commitments := []ristretto.Point{alice, bob}
+	total := testAmount(4600)
+	proof, err := sumproof.Prove(&H, commitments, total, pedersen.NewSecret(sum.Add(&r1, &r2)))
+	assert.NoError(t, err)
+
+	_, err = new(SmartContract).DiscloseTotal(ctx, []string{"alice", "bob"}, "46.01", proof)
+	assert.EqualError(t, err, "sum proof not valid")
+	_, err = new(SmartContract).DiscloseTotal(ctx, []string{"alice", "alice"}, "46.00", proof)
+	assert.EqualError(t, err, "commitment alice is listed twice")
+	_, err = new(SmartContract).DiscloseTotal(ctx, []string{"alice", "carol"}, "46.00", proof)
+	assert.EqualError(t, err, "commitment carol does not exist")
+
+	txID, err := new(SmartContract).DiscloseTotal(ctx, []string{"alice", "bob"}, "46", proof)
+	assert.NoError(t, err)
+
+	record, err := new(SmartContract).GetDisclosedTotal(ctx, txID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"alice", "bob"}, record.Keys)
+	assert.Equal(t, "46.00", record.Total)
+	assert.Equal(t, "treasurer", record.DisclosedBy)
+	assert.True(t, record.Commitments[1].Equals(&bob))
+
+	var event DisclosedTotal
+	assert.Equal(t, "TotalDisclosed", readEvent(t, stub, 0, &event))
+	assert.Equal(t, record.Total, event.Total)
+
+	_, err = new(SmartContract).GetDisclosedTotal(ctx, "unknown")
+	assert.EqualError(t, err, "no total disclosed in transaction unknown")
+}
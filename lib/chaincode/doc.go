@@ -0,0 +1,13 @@
+// Package chaincode implements a token whose balances are Pedersen commitments.
+//
+// Amounts reach the peer in the clear only where the public total supply needs them.
+// Mint and Burn take the amount in the transient map: its base units as 8 big-endian bytes
+// under "amount", and the proof that the committed amount opens to it under "amountProof".
+//
+// Other debits prove the amount instead. Transfer and the functions modelled on it re-blind
+// what is left of the balance and prove it with a range proof and an equality proof.
+// Debits that leave the rest of the balance as is, such as DepositNote, LockSwap,
+// RegisterRingAccount and DepositToJointAccount, take two range proofs: amountProof on the
+// committed amount and balanceProof on the balance minus it, made with the difference of the
+// blinding factors.
+package chaincode
@@ -0,0 +1,302 @@
+package chaincode
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pedersen-commitment-transfer/src/equality"
+	"strconv"
+	"strings"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Key of the current parameter epoch. The parameters set by Initialize are epoch 0.
+const pedersenEpochKey = "pedersenEpoch"
+
+// Object types for the composite keys of retired parameters and of account epochs
+// An account without an epoch was created in epoch 0.
+const pedersenParamsObjectType = "pedersenParams"
+const accountEpochObjectType = "accountEpoch"
+
+// migrationEvent reports an account moved to the current parameter epoch
+type migrationEvent struct {
+	Account   string `json:"account"`
+	FromEpoch uint64 `json:"fromEpoch"`
+	ToEpoch   uint64 `json:"toEpoch"`
+}
+
+// RotatePedersenParams replaces H and starts a new parameter epoch
+// Balances committed under the previous parameters can no longer be used until they are moved,
+// client accounts with MigrateBalance and shared ones, like the staged account of a pending transfer
+// or the supply commitment, with MigrateAccount. Notes are moved with MigrateNote.
+func (s *SmartContract) RotatePedersenParams(ctx contractapi.TransactionContextInterface, H ristretto.Point) (uint64, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return 0, fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	// Check authorization - this sample assumes Org1 is the central banker with privilege to rotate the parameters
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get MSPID: %v", err)
+	}
+	if clientMSPID != "Org1MSP" {
+		return 0, fmt.Errorf("client is not authorized to rotate the pedersen parameters")
+	}
+
+	stub := ctx.GetStub()
+	epoch, err := getPedersenEpoch(ctx)
+	if err != nil {
+		return 0, err
+	}
+	currentH, err := GetPedersenParams(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch pedersen encryption parameters: %v", err)
+	}
+	if currentH.Equals(&H) {
+		return 0, errors.New("the new H must differ from the current one")
+	}
+
+	// Keep the retiring parameters so that balances of this epoch can still be migrated
+	currentParams, err := stub.GetState(PEDERSEN_ID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	paramsKey, err := stub.CreateCompositeKey(pedersenParamsObjectType, []string{strconv.FormatUint(epoch, 10)})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create the composite key: %v", err)
+	}
+	err = stub.PutState(paramsKey, currentParams)
+	if err != nil {
+		return 0, fmt.Errorf("failed to put to world state. %v", err)
+	}
+
+	err = InitPedersen(ctx, H)
+	if err != nil {
+		return 0, fmt.Errorf("failed to init Pedersen Params: %v", err)
+	}
+	epoch++
+	err = stub.PutState(pedersenEpochKey, []byte(strconv.FormatUint(epoch, 10)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to put to world state. %v", err)
+	}
+	return epoch, nil
+}
+
+// MigrateBalance moves the client balance to the current parameter epoch
+// newCommitment commits to the same value as the current balance under the new H,
+// which the equality proof shows without revealing the value.
+// This function triggers a BalanceMigrated event
+func (s *SmartContract) MigrateBalance(ctx contractapi.TransactionContextInterface, newCommitment ristretto.Point, proof equality.Proof) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = validateCommitments(&newCommitment)
+	if err != nil {
+		return "", err
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	_, err = migrateAccount(ctx, clientID, &newCommitment, proof, equality.Verify)
+	if err != nil {
+		return "", err
+	}
+	return ctx.GetStub().GetTxID(), nil
+}
+
+// MigrateAccount moves a shared account to the current parameter epoch
+// It is meant for the accounts no single client owns: staged transfers, swaps, allowances,
+// joint and ring accounts, and the supply commitment in confidential supply mode. The proof must come from equality.ProveSameBlinding, so that
+// newCommitment is the only possible result and every party that could open the account
+// can still open it. Anyone who knows the opening may therefore migrate it.
+// Migrating the staged account of a pending transfer also migrates the recorded amount.
+// Notes are not accounts: their owners move them with MigrateNote.
+// This function triggers a BalanceMigrated event
+func (s *SmartContract) MigrateAccount(ctx contractapi.TransactionContextInterface, account string, newCommitment ristretto.Point, proof equality.Proof) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = validateCommitments(&newCommitment)
+	if err != nil {
+		return "", err
+	}
+
+	balance, err := migrateAccount(ctx, account, &newCommitment, proof, equality.VerifySameBlinding)
+	if err != nil {
+		return "", err
+	}
+
+	// Approve, Reject and Reclaim move the recorded amount out of the staged account
+	stub := ctx.GetStub()
+	TxId, staged := strings.CutPrefix(account, temporaryAccountAddressPrefix+"_")
+	if staged {
+		txInfo, err := getTxInfo(stub, TxId)
+		if err == nil && bytes.Equal(txInfo.Amount, balance.Bytes()) {
+			txInfo.Amount = newCommitment.Bytes()
+			err = putTxInfo(stub, TxId, &txInfo)
+			if err != nil {
+				return "", fmt.Errorf("failed to update transaction info: %v", err)
+			}
+		}
+	}
+	return stub.GetTxID(), nil
+}
+
+// migrateAccount replaces the balance of account by newCommitment, committed under the current H
+// verify checks the proof that both hide the same value. Returns the replaced balance.
+func migrateAccount(ctx contractapi.TransactionContextInterface, account string, newCommitment *ristretto.Point, proof equality.Proof, verify func(H1, H2, C1, C2 *ristretto.Point, proof equality.Proof) bool) (*ristretto.Point, error) {
+	stub := ctx.GetStub()
+	balanceBytes, err := stub.GetState(account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client account %s from world state: %v", account, err)
+	}
+	if balanceBytes == nil {
+		return nil, fmt.Errorf("client account %s has no balance", account)
+	}
+	var balance ristretto.Point
+	err = balance.UnmarshalBinary(balanceBytes)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling")
+	}
+
+	epoch, err := getPedersenEpoch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	accountEpoch, err := getAccountEpoch(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+	if accountEpoch == epoch {
+		return nil, fmt.Errorf("client account %s is already in epoch %d", account, epoch)
+	}
+
+	oldH, err := getRetiredH(ctx, accountEpoch)
+	if err != nil {
+		return nil, err
+	}
+	newH, err := GetPedersenParams(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch pedersen encryption parameters: %v", err)
+	}
+	if !verify(oldH, newH, &balance, newCommitment, proof) {
+		return nil, errors.New("migration proof not valid")
+	}
+
+	err = stub.PutState(account, newCommitment.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	err = setAccountEpoch(ctx, account, epoch)
+	if err != nil {
+		return nil, err
+	}
+
+	eventJSON, err := json.Marshal(migrationEvent{Account: account, FromEpoch: accountEpoch, ToEpoch: epoch})
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = stub.SetEvent("BalanceMigrated", eventJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set event: %v", err)
+	}
+	return &balance, nil
+}
+
+// getPedersenEpoch returns the current parameter epoch
+func getPedersenEpoch(ctx contractapi.TransactionContextInterface) (uint64, error) {
+	epochBytes, err := ctx.GetStub().GetState(pedersenEpochKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the parameter epoch from world state: %v", err)
+	}
+	if epochBytes == nil {
+		return 0, nil
+	}
+	return strconv.ParseUint(string(epochBytes), 10, 64)
+}
+
+// getAccountEpoch returns the parameter epoch the balance of account is committed in
+func getAccountEpoch(ctx contractapi.TransactionContextInterface, account string) (uint64, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(accountEpochObjectType, []string{account})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create the composite key: %v", err)
+	}
+	epochBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the epoch of account %s from world state: %v", account, err)
+	}
+	if epochBytes == nil {
+		return 0, nil
+	}
+	return strconv.ParseUint(string(epochBytes), 10, 64)
+}
+
+func setAccountEpoch(ctx contractapi.TransactionContextInterface, account string, epoch uint64) error {
+	key, err := ctx.GetStub().CreateCompositeKey(accountEpochObjectType, []string{account})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key: %v", err)
+	}
+	return ctx.GetStub().PutState(key, []byte(strconv.FormatUint(epoch, 10)))
+}
+
+// checkAccountEpoch fails if the balance of account was committed under retired parameters
+func checkAccountEpoch(ctx contractapi.TransactionContextInterface, account string) error {
+	epoch, err := getPedersenEpoch(ctx)
+	if err != nil {
+		return err
+	}
+	accountEpoch, err := getAccountEpoch(ctx, account)
+	if err != nil {
+		return err
+	}
+	if accountEpoch != epoch {
+		return fmt.Errorf("client account %s is in epoch %d, call MigrateBalance() or MigrateAccount() to move it to epoch %d", account, accountEpoch, epoch)
+	}
+	return nil
+}
+
+// getRetiredH returns the H of a past parameter epoch
+func getRetiredH(ctx contractapi.TransactionContextInterface, epoch uint64) (*ristretto.Point, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(pedersenParamsObjectType, []string{strconv.FormatUint(epoch, 10)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key: %v", err)
+	}
+	paramsJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if paramsJSON == nil {
+		return nil, fmt.Errorf("no pedersen parameters for epoch %d", epoch)
+	}
+	H, err := parsePedersenVariables(paramsJSON)
+	if err != nil {
+		return nil, err
+	}
+	return H, nil
+}
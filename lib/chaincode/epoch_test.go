@@ -0,0 +1,122 @@
+package chaincode
+
+import (
+	"pedersen-commitment-transfer/src/equality"
+	"pedersen-commitment-transfer/src/pedersen"
+	"testing"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotateAndMigrate(t *testing.T) {
+	ctx, stub, identity, state := newTestContext("alice", "Org1MSP")
+	H, bindingFactor := initTestContract(t, ctx, state)
+
+	balance := commitAmount(&H, &bindingFactor, 300)
+	state["alice"] = balance.Bytes()
+
+	newH, _, _ := generateRandomCommitment(0)
+	_, err := new(SmartContract).RotatePedersenParams(ctx, H)
+	assert.EqualError(t, err, "the new H must differ from the current one")
+
+	epoch, err := new(SmartContract).RotatePedersenParams(ctx, newH)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), epoch)
+	currentH, _ := GetPedersenParams(ctx)
+	assert.True(t, currentH.Equals(&newH))
+
+	// The old balance is stranded until migrated
+	var amount ristretto.Point
+	amount.Rand()
+	_, _, err = subtractFromBalance(ctx, "alice", &amount)
+	assert.EqualError(t, err, "client account alice is in epoch 0, call MigrateBalance() or MigrateAccount() to move it to epoch 1")
+
+	var rNew ristretto.Scalar
+	rNew.Rand()
+	value := testAmount(300)
+	newCommitment := commitAmount(&newH, &rNew, 300)
+
+	wrongCommitment := commitAmount(&newH, &rNew, 301)
+	proof := equality.Prove(&H, &newH, value, pedersen.NewSecret(&bindingFactor), pedersen.NewSecret(&rNew))
+	_, err = new(SmartContract).MigrateBalance(ctx, wrongCommitment, proof)
+	assert.EqualError(t, err, "migration proof not valid")
+
+	_, err = new(SmartContract).MigrateBalance(ctx, newCommitment, proof)
+	assert.NoError(t, err)
+	migrated := readPoint(t, state, "alice")
+	assert.True(t, migrated.Equals(&newCommitment))
+
+	var event migrationEvent
+	assert.Equal(t, "BalanceMigrated", readEvent(t, stub, 0, &event))
+	assert.Equal(t, migrationEvent{Account: "alice", FromEpoch: 0, ToEpoch: 1}, event)
+
+	_, err = new(SmartContract).MigrateBalance(ctx, newCommitment, proof)
+	assert.EqualError(t, err, "client account alice is already in epoch 1")
+
+	_, _, err = subtractFromBalance(ctx, "alice", &amount)
+	assert.NoError(t, err)
+
+	// Accounts created after the rotation start in the new epoch
+	_, _, err = addToBalance(ctx, "bob", &amount)
+	assert.NoError(t, err)
+	bobEpoch, err := getAccountEpoch(ctx, "bob")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), bobEpoch)
+
+	identity.GetMSPIDReturns("Org2MSP", nil)
+	_, err = new(SmartContract).RotatePedersenParams(ctx, H)
+	assert.EqualError(t, err, "client is not authorized to rotate the pedersen parameters")
+}
+
+func TestRotateWithPendingTransfer(t *testing.T) {
+	ctx, stub, identity, state := newTestContext("issuer", "Org1MSP")
+	H, _ := initTestContract(t, ctx, state)
+
+	// alice has staged 70 for bob
+	var rAmount ristretto.Scalar
+	rAmount.Rand()
+	amount := commitAmount(&H, &rAmount, 70)
+	staged := temporaryAccountAddressPrefix + "_TxidPending"
+	state[staged] = amount.Bytes()
+	txInfo, err := createTxInfo(stub, "alice", "bob", amount, 100)
+	assert.NoError(t, err)
+	assert.NoError(t, putTxInfo(stub, "TxidPending", txInfo))
+
+	newH, _, _ := generateRandomCommitment(0)
+	_, err = new(SmartContract).RotatePedersenParams(ctx, newH)
+	assert.NoError(t, err)
+
+	identity.GetIDReturns("bob", nil)
+	identity.GetMSPIDReturns("Org2MSP", nil)
+	err = checkAccountEpoch(ctx, staged)
+	assert.EqualError(t, err, "client account Staged_TxidPending is in epoch 0, call MigrateBalance() or MigrateAccount() to move it to epoch 1")
+
+	// Re-blinding the staged account would lock alice out of a reclaim
+	var rOther ristretto.Scalar
+	rOther.Rand()
+	reblinded := commitAmount(&newH, &rOther, 70)
+	proof := equality.Prove(&H, &newH, testAmount(70), pedersen.NewSecret(&rAmount), pedersen.NewSecret(&rOther))
+	_, err = new(SmartContract).MigrateAccount(ctx, staged, reblinded, proof)
+	assert.EqualError(t, err, "migration proof not valid")
+
+	migrated := commitAmount(&newH, &rAmount, 70)
+	proof = equality.ProveSameBlinding(&H, &newH, testAmount(70), pedersen.NewSecret(&rAmount))
+	_, err = new(SmartContract).MigrateAccount(ctx, staged, migrated, proof)
+	assert.NoError(t, err)
+	pending, err := getTxInfo(stub, "TxidPending")
+	assert.NoError(t, err)
+	assert.Equal(t, migrated.Bytes(), pending.Amount)
+	var event migrationEvent
+	assert.Equal(t, "BalanceMigrated", readEvent(t, stub, 0, &event))
+	assert.Equal(t, migrationEvent{Account: staged, FromEpoch: 0, ToEpoch: 1}, event)
+
+	_, err = new(SmartContract).Approve(ctx, "TxidPending")
+	assert.NoError(t, err)
+	received := readPoint(t, state, "bob")
+	assert.True(t, received.Equals(&migrated))
+	left := readPoint(t, state, staged)
+	var zero ristretto.Point
+	zero.SetZero()
+	assert.True(t, left.Equals(&zero))
+}
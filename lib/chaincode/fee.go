@@ -0,0 +1,178 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pedersen-commitment-transfer/src/equality"
+	"pedersen-commitment-transfer/src/feeproof"
+	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/rangeproof"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Key of the fee configuration
+const feeConfigKey = "feeConfig"
+
+// The fee of a transfer is staged under the transfer ID with this suffix
+const feeTransferSuffix = "_fee"
+
+// FeeConfig is the rate charged by TransferWithFee and the account the fees are credited to
+type FeeConfig struct {
+	Collector string        `json:"collector"`
+	Rate      feeproof.Rate `json:"rate"`
+}
+
+// SetTransferFee sets the fee rate of TransferWithFee and the fee-collector account
+func (s *SmartContract) SetTransferFee(ctx contractapi.TransactionContextInterface, collector string, rate feeproof.Rate) (bool, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return false, fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	// Check authorization - this sample assumes Org1 is the central banker with privilege to set the fees
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return false, fmt.Errorf("failed to get MSPID: %v", err)
+	}
+	if clientMSPID != "Org1MSP" {
+		return false, fmt.Errorf("client is not authorized to set the transfer fee")
+	}
+
+	if collector == "" {
+		return false, errors.New("fee collector must not be empty")
+	}
+	err = rate.Validate()
+	if err != nil {
+		return false, err
+	}
+
+	configJSON, err := json.Marshal(FeeConfig{Collector: collector, Rate: rate})
+	if err != nil {
+		return false, fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().PutState(feeConfigKey, configJSON)
+	if err != nil {
+		return false, fmt.Errorf("failed to set the transfer fee: %v", err)
+	}
+	return true, nil
+}
+
+// TransferWithFee transfers tokens from client account to a temporary account for recipient, as Transfer does,
+// and pays the fee on the amount to the fee collector
+// The amount stays hidden: the range proof shows it is not negative and the fee proof
+// shows that committedFee is the configured rate applied to it. As for Transfer, newBalance
+// re-blinds what is left of the balance, here once both the amount and the fee are taken out.
+// The fee is staged for the collector as a transfer of its own, whose ID is the returned one followed
+// by "_fee": the client hands the collector its opening off-chain and the collector approves it.
+// This function triggers a Transfer event
+func (s *SmartContract) TransferWithFee(ctx contractapi.TransactionContextInterface, recipient string, timelock int64, committedAmount ristretto.Point, committedFee ristretto.Point, newBalance ristretto.Point, amountProof rangeproof.Proof, feeProof feeproof.Proof, balanceProof rangeproof.Proof, equalityProof equality.Proof) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = validateCommitments(&committedAmount, &committedFee, &newBalance)
+	if err != nil {
+		return "", err
+	}
+
+	config, err := getFeeConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+	H, err := GetPedersenParams(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch pedersen encryption parameters: %v", err)
+	}
+	if !rangeproof.Verify(H, &committedAmount, amountBits, amountProof) {
+		return "", errors.New("amount range proof not valid")
+	}
+	if !feeproof.Verify(H, config.Rate, &committedAmount, &committedFee, amountBits, feeProof) {
+		return "", errors.New("fee proof not valid")
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+	err = checkRecipient(ctx, clientID, recipient)
+	if err != nil {
+		return "", err
+	}
+	timelock, err = resolveTimelock(ctx, timelock)
+	if err != nil {
+		return "", err
+	}
+
+	balance, err := getCommittedBalance(ctx, clientID)
+	if err != nil {
+		return "", err
+	}
+	err = checkAccountEpoch(ctx, clientID)
+	if err != nil {
+		return "", err
+	}
+	debit := pedersen.Add(&committedAmount, &committedFee)
+	err = isValidRemainderCommitment(ctx, "balance", &balance.Commitment, &debit, &newBalance, balanceProof, equalityProof)
+	if err != nil {
+		return "", err
+	}
+
+	stub := ctx.GetStub()
+	TxID := stub.GetTxID()
+
+	err = stub.PutState(clientID, newBalance.Bytes())
+	if err != nil {
+		return "", fmt.Errorf("failed to update client account %s: %v", clientID, err)
+	}
+	stagedAccount, err := stageTransfer(ctx, TxID, clientID, recipient, &committedAmount, timelock)
+	if err != nil {
+		return "", err
+	}
+	_, err = stageTransfer(ctx, TxID+feeTransferSuffix, clientID, config.Collector, &committedFee, timelock)
+	if err != nil {
+		return "", fmt.Errorf("failed to pay the fee: %v", err)
+	}
+
+	// Emit the Transfer event
+	transferEvent := transferEvent{clientID, stagedAccount, "Money sent"}
+	transferEventJSON, err := json.Marshal(transferEvent)
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = stub.SetEvent("Transfer", transferEventJSON)
+	if err != nil {
+		return "", fmt.Errorf("failed to set event: %v", err)
+	}
+	return TxID, nil
+}
+
+// getFeeConfig reads the configuration set by SetTransferFee
+func getFeeConfig(ctx contractapi.TransactionContextInterface) (FeeConfig, error) {
+	configJSON, err := ctx.GetStub().GetState(feeConfigKey)
+	if err != nil {
+		return FeeConfig{}, fmt.Errorf("failed to read the transfer fee from world state: %v", err)
+	}
+	if configJSON == nil {
+		return FeeConfig{}, errors.New("transfer fee is not configured, call SetTransferFee() first")
+	}
+	var config FeeConfig
+	err = json.Unmarshal(configJSON, &config)
+	if err != nil {
+		return FeeConfig{}, fmt.Errorf("failed to unmarshal the transfer fee: %v", err)
+	}
+	return config, nil
+}
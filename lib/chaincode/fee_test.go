@@ -0,0 +1,115 @@
+package chaincode
+
+import (
+	"pedersen-commitment-transfer/src/equality"
+	"pedersen-commitment-transfer/src/feeproof"
+	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/rangeproof"
+	"testing"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetTransferFee(t *testing.T) {
+	ctx, _, identity, state := newTestContext("admin", "Org1MSP")
+	initTestContract(t, ctx, state)
+
+	rate := feeproof.Rate{Numerator: 25, Decimals: 3}
+	ok, err := new(SmartContract).SetTransferFee(ctx, "collector", rate)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	config, err := getFeeConfig(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, FeeConfig{Collector: "collector", Rate: rate}, config)
+
+	_, err = new(SmartContract).SetTransferFee(ctx, "collector", feeproof.Rate{Numerator: 2, Decimals: 0})
+	assert.EqualError(t, err, "rate must not be more than 100%")
+
+	identity.GetMSPIDReturns("Org2MSP", nil)
+	_, err = new(SmartContract).SetTransferFee(ctx, "collector", rate)
+	assert.EqualError(t, err, "client is not authorized to set the transfer fee")
+}
+
+func TestTransferWithFee(t *testing.T) {
+	ctx, stub, identity, state := newTestContext("alice", "Org1MSP")
+	H, bindingFactor := initTestContract(t, ctx, state)
+
+	_, err := new(SmartContract).TransferWithFee(ctx, "bob", 0, commitAmount(&H, &bindingFactor, 1), commitAmount(&H, &bindingFactor, 1), commitAmount(&H, &bindingFactor, 1), rangeproof.Proof{}, feeproof.Proof{}, rangeproof.Proof{}, equality.Proof{})
+	assert.EqualError(t, err, "transfer fee is not configured, call SetTransferFee() first")
+
+	// 2.5% fee
+	rate := feeproof.Rate{Numerator: 25, Decimals: 3}
+	_, err = new(SmartContract).SetTransferFee(ctx, "collector", rate)
+	assert.NoError(t, err)
+
+	balance := commitAmount(&H, &bindingFactor, 1000)
+	state["alice"] = balance.Bytes()
+
+	var rAmount, rFee ristretto.Scalar
+	rAmount.Rand()
+	rFee.Rand()
+	amount := testAmount(400)
+	committedAmount := commitAmount(&H, &rAmount, 400)
+	amountProof, err := rangeproof.Prove(&H, amount, pedersen.NewSecret(&rAmount))
+	assert.NoError(t, err)
+	fee, feeProof, err := feeproof.Prove(&H, rate, amount, pedersen.NewSecret(&rAmount), pedersen.NewSecret(&rFee))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), fee.Units().Int64())
+	committedFee := commitAmount(&H, &rFee, 10)
+
+	// 590 is left once the amount and the fee are taken out, re-blinded with rNew
+	var rRemaining, rNew ristretto.Scalar
+	rNew.Rand()
+	rRemaining.Sub(&bindingFactor, &rAmount)
+	rRemaining.Sub(&rRemaining, &rFee)
+	newBalance := commitAmount(&H, &rNew, 590)
+	balanceProof, err := rangeproof.Prove(&H, testAmount(590), pedersen.NewSecret(&rNew))
+	assert.NoError(t, err)
+	equalityProof := equality.Prove(&H, &H, testAmount(590), pedersen.NewSecret(&rRemaining), pedersen.NewSecret(&rNew))
+
+	// A fee below the rate is rejected
+	lowerFee := commitAmount(&H, &rFee, 9)
+	_, err = new(SmartContract).TransferWithFee(ctx, "bob", 0, committedAmount, lowerFee, newBalance, amountProof, feeProof, balanceProof, equalityProof)
+	assert.EqualError(t, err, "fee proof not valid")
+
+	// Alice cannot send 400 and pay 10 out of a balance of 300
+	smallBalance := commitAmount(&H, &bindingFactor, 300)
+	state["alice"] = smallBalance.Bytes()
+	_, err = new(SmartContract).TransferWithFee(ctx, "bob", 0, committedAmount, committedFee, newBalance, amountProof, feeProof, balanceProof, equalityProof)
+	assert.EqualError(t, err, "balance equality proof not valid")
+	state["alice"] = balance.Bytes()
+
+	txID, err := new(SmartContract).TransferWithFee(ctx, "bob", 0, committedAmount, committedFee, newBalance, amountProof, feeProof, balanceProof, equalityProof)
+	assert.NoError(t, err)
+
+	staged := readPoint(t, state, temporaryAccountAddressPrefix+"_"+txID)
+	assert.True(t, staged.Equals(&committedAmount))
+
+	stagedFee := readPoint(t, state, temporaryAccountAddressPrefix+"_"+txID+feeTransferSuffix)
+	assert.True(t, stagedFee.Equals(&committedFee))
+	assert.Nil(t, state["collector"], "The collector is only credited once it approves the fee")
+
+	aliceBalance := readPoint(t, state, "alice")
+	assert.True(t, aliceBalance.Equals(&newBalance))
+
+	var event transferEvent
+	assert.Equal(t, "Transfer", readEvent(t, stub, 0, &event))
+	assert.Equal(t, "alice", event.From)
+
+	// The collector approves the fee and spends it with the opening Alice handed over
+	identity.GetIDReturns("collector", nil)
+	_, err = new(SmartContract).Approve(ctx, txID+feeTransferSuffix)
+	assert.NoError(t, err)
+	collected := readPoint(t, state, "collector")
+	assert.True(t, collected.Equals(&committedFee))
+
+	stub.GetTxIDReturns("TxidCollector")
+	spent, left, spentProof, leftProof, leftEquality, _, _ := spendProofs(t, &H, &rFee, 10, 4)
+	_, err = new(SmartContract).Transfer(ctx, "treasury", 0, spent, left, spentProof, leftProof, leftEquality)
+	assert.NoError(t, err)
+	collected = readPoint(t, state, "collector")
+	assert.True(t, collected.Equals(&left))
+	staged = readPoint(t, state, temporaryAccountAddressPrefix+"_TxidCollector")
+	assert.True(t, staged.Equals(&spent))
+}
@@ -0,0 +1,141 @@
+package chaincode
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+	"pedersen-commitment-transfer/lib/tests/testsfakes"
+	"pedersen-commitment-transfer/src/equality"
+	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/rangeproof"
+	"pedersen-commitment-transfer/src/sumproof"
+	"strings"
+	"testing"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestContext returns fakes backed by an in-memory world state
+func newTestContext(clientID string, mspID string) (*testsfakes.FakeTestTransactionContextInterface, *testsfakes.FakeTestChaincodeStubInterface, *testsfakes.FakeTestClientIdentity, map[string][]byte) {
+	ctx := &testsfakes.FakeTestTransactionContextInterface{}
+	stub := &testsfakes.FakeTestChaincodeStubInterface{}
+	identity := &testsfakes.FakeTestClientIdentity{}
+	state := map[string][]byte{}
+
+	ctx.GetStubStub = func() shim.ChaincodeStubInterface {
+		return stub
+	}
+	ctx.GetClientIdentityStub = func() cid.ClientIdentity {
+		return identity
+	}
+	identity.GetIDReturns(clientID, nil)
+	identity.GetMSPIDReturns(mspID, nil)
+
+	stub.GetTxIDReturns("TxidTest")
+	stub.GetTxTimestampReturns(&timestamp.Timestamp{Seconds: 123456789}, nil)
+	stub.GetStateStub = func(key string) ([]byte, error) {
+		return state[key], nil
+	}
+	stub.PutStateStub = func(key string, value []byte) error {
+		state[key] = value
+		return nil
+	}
+	stub.DelStateStub = func(key string) error {
+		delete(state, key)
+		return nil
+	}
+	stub.CreateCompositeKeyStub = func(objectType string, attributes []string) (string, error) {
+		return "\x00" + objectType + "\x00" + strings.Join(attributes, "\x00") + "\x00", nil
+	}
+
+	return ctx, stub, identity, state
+}
+
+// initTestContract stores the token options and the Pedersen parameters
+// It also returns a blinding factor for the commitments of the test client.
+func initTestContract(t *testing.T, ctx *testsfakes.FakeTestTransactionContextInterface, state map[string][]byte) (ristretto.Point, ristretto.Scalar) {
+	H, bindingFactor, _ := generateRandomCommitment(0)
+	err := InitPedersen(ctx, H)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state[nameKey] = []byte("Token")
+	state[decimalsKey] = []byte("2")
+	return H, bindingFactor
+}
+
+// commitAmount commits to amount with the given blinding factor
+func commitAmount(H *ristretto.Point, r *ristretto.Scalar, amount int64) ristretto.Point {
+	return pedersen.CommitTo(H, pedersen.NewSecret(r), testAmount(amount))
+}
+
+// Denomination of the token set up by initTestContract
+var testDenomination = pedersen.Denomination{Decimals: 2, Bits: amountBits}
+
+func testAmount(units int64) pedersen.Amount {
+	amount, err := testDenomination.FromUnits(big.NewInt(units))
+	if err != nil {
+		panic(err)
+	}
+	return amount
+}
+
+func transientAmounts(amounts map[string]int64) map[string][]byte {
+	transient := map[string][]byte{}
+	for key, amount := range amounts {
+		value := make([]byte, 8)
+		binary.BigEndian.PutUint64(value, uint64(amount))
+		transient[key] = value
+	}
+	return transient
+}
+
+// transientOpening returns the transient amount and the proof that commitAmount(H, r, amount) commits to it
+func transientOpening(H *ristretto.Point, r *ristretto.Scalar, amount int64) map[string][]byte {
+	transient := transientAmounts(map[string]int64{"amount": amount})
+	commitment := commitAmount(H, r, amount)
+	proof, err := sumproof.Prove(H, []ristretto.Point{commitment}, testAmount(amount), pedersen.NewSecret(r))
+	if err != nil {
+		panic(err)
+	}
+	transient[amountProofKey], err = json.Marshal(&proof)
+	if err != nil {
+		panic(err)
+	}
+	return transient
+}
+
+// spendProofs builds the proofs that amount can be taken out of a commitment to total with blinding factor r
+// It returns the commitments to the amount and to the remainder with the proofs.
+func spendProofs(t *testing.T, H *ristretto.Point, r *ristretto.Scalar, total int64, amount int64) (ristretto.Point, ristretto.Point, rangeproof.Proof, rangeproof.Proof, equality.Proof, ristretto.Scalar, ristretto.Scalar) {
+	var rAmount, rRemaining, rNew ristretto.Scalar
+	rAmount.Rand()
+	rNew.Rand()
+	rRemaining.Sub(r, &rAmount)
+	amountProof, err := rangeproof.Prove(H, testAmount(amount), pedersen.NewSecret(&rAmount))
+	assert.NoError(t, err)
+	remainderProof, err := rangeproof.Prove(H, testAmount(total-amount), pedersen.NewSecret(&rNew))
+	assert.NoError(t, err)
+	equalityProof := equality.Prove(H, H, testAmount(total-amount), pedersen.NewSecret(&rRemaining), pedersen.NewSecret(&rNew))
+	return commitAmount(H, &rAmount, amount), commitAmount(H, &rNew, total-amount), amountProof, remainderProof, equalityProof, rAmount, rNew
+}
+
+func readPoint(t *testing.T, state map[string][]byte, key string) ristretto.Point {
+	var p ristretto.Point
+	if err := p.UnmarshalBinary(state[key]); err != nil {
+		t.Fatalf("failed to read %q: %v", key, err)
+	}
+	return p
+}
+
+func readEvent(t *testing.T, stub *testsfakes.FakeTestChaincodeStubInterface, call int, event interface{}) string {
+	name, payload := stub.SetEventArgsForCall(call)
+	if err := json.Unmarshal(payload, event); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
@@ -0,0 +1,374 @@
+package chaincode
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pedersen-commitment-transfer/src/equality"
+	"pedersen-commitment-transfer/src/musig"
+	"pedersen-commitment-transfer/src/rangeproof"
+	"pedersen-commitment-transfer/src/schnorr"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Object types for the composite keys of joint accounts and of their balances
+const jointAccountObjectType = "jointAccount"
+const jointBalanceObjectType = "jointBalance"
+
+// JointAccount is owned by all of Owners together
+// Spends need a single MuSig2 signature under Key, the aggregate of the owner keys.
+// Sequence counts the spends so that a signature cannot be replayed.
+type JointAccount struct {
+	Owners   []ristretto.Point `json:"owners"`
+	Key      ristretto.Point   `json:"key"`
+	Sequence uint64            `json:"sequence"`
+}
+
+// JointTransferMessage is the message the owners sign to spend from a joint account
+// It covers the balance left, so that no owner can re-blind it without the others.
+func JointTransferMessage(key *ristretto.Point, sequence uint64, recipient string, amount *ristretto.Point, newBalance *ristretto.Point) []byte {
+	message := []byte("JointTransfer")
+	message = append(message, key.Bytes()...)
+	message = binary.BigEndian.AppendUint64(message, sequence)
+	message = append(message, amount.Bytes()...)
+	message = append(message, newBalance.Bytes()...)
+	return append(message, recipient...)
+}
+
+// JointDepositMessage is the message an owner signs with its own key to deposit into a joint account
+// It binds the transaction and the depositing client, so that the signature cannot be replayed.
+func JointDepositMessage(key *ristretto.Point, txID string, clientID string, amount *ristretto.Point) []byte {
+	message := []byte("JointDeposit")
+	message = append(message, key.Bytes()...)
+	message = append(message, amount.Bytes()...)
+	message = append(message, txID...)
+	message = append(message, 0)
+	return append(message, clientID...)
+}
+
+// JointReclaimMessage is the message the owners sign to reclaim an expired transfer from a joint account
+func JointReclaimMessage(key *ristretto.Point, TxId string) []byte {
+	message := []byte("JointReclaim")
+	message = append(message, key.Bytes()...)
+	return append(message, TxId...)
+}
+
+// CreateJointAccount creates an empty account owned by the aggregate of ownerKeys
+// The order of the keys matters, as it does for musig.AggregateKeys. Returns the aggregate key.
+func (s *SmartContract) CreateJointAccount(ctx contractapi.TransactionContextInterface, ownerKeys []ristretto.Point) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	if len(ownerKeys) < 2 {
+		return "", errors.New("a joint account needs at least two owners")
+	}
+	for i := range ownerKeys {
+		err = validatePoints(&ownerKeys[i])
+		if err != nil {
+			return "", fmt.Errorf("invalid owner key: %w", err)
+		}
+	}
+	agg, err := musig.AggregateKeys(ownerKeys)
+	if err != nil {
+		return "", err
+	}
+
+	existing, err := getJointAccount(ctx, &agg.Key)
+	if err != nil {
+		return "", err
+	}
+	if existing != nil {
+		return "", fmt.Errorf("joint account %s already exists", agg.Key)
+	}
+	err = putJointAccount(ctx, &JointAccount{Owners: ownerKeys, Key: agg.Key})
+	if err != nil {
+		return "", err
+	}
+
+	return agg.Key.String(), nil
+}
+
+// DepositToJointAccount moves committedAmount from the client account into a joint account
+// amountProof and balanceProof are the debit proofs described in the package documentation.
+// Only an owner can deposit, so that the owners can always open the joint balance: signature is made
+// with one of the owner keys on JointDepositMessage for this transaction and client.
+// This function triggers a Transfer event
+func (s *SmartContract) DepositToJointAccount(ctx contractapi.TransactionContextInterface, key ristretto.Point, committedAmount ristretto.Point, amountProof rangeproof.Proof, balanceProof rangeproof.Proof, signature schnorr.Signature) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = validateCommitments(&committedAmount)
+	if err != nil {
+		return "", err
+	}
+	err = validatePoints(&signature.R)
+	if err != nil {
+		return "", fmt.Errorf("invalid owner signature: %w", err)
+	}
+	account, err := getJointAccount(ctx, &key)
+	if err != nil {
+		return "", err
+	}
+	if account == nil {
+		return "", fmt.Errorf("joint account %s does not exist", key)
+	}
+	balanceKey, err := jointBalanceKey(ctx, &key)
+	if err != nil {
+		return "", err
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+	message := JointDepositMessage(&account.Key, ctx.GetStub().GetTxID(), clientID, &committedAmount)
+	if !isSignedByOwner(account, message, signature) {
+		return "", errors.New("only an owner can deposit into a joint account")
+	}
+	balance, err := getCommittedBalance(ctx, clientID)
+	if err != nil {
+		return "", err
+	}
+	err = checkAccountEpoch(ctx, clientID)
+	if err != nil {
+		return "", err
+	}
+	err = isValidDebit(ctx, "balance", &balance.Commitment, &committedAmount, amountProof, balanceProof)
+	if err != nil {
+		return "", fmt.Errorf("deposit failed: %v", err)
+	}
+	err = transferHelper(ctx, clientID, balanceKey, committedAmount)
+	if err != nil {
+		return "", fmt.Errorf("failed to transfer: %v", err)
+	}
+
+	err = emitTransferEvent(ctx, transferEvent{clientID, balanceKey, "Money deposited"})
+	if err != nil {
+		return "", err
+	}
+	return ctx.GetStub().GetTxID(), nil
+}
+
+// JointTransfer transfers committedAmount from a joint account to a temporary account for recipient
+// The proofs are those of Transfer, on the joint balance: committedAmount and newBalance are not
+// negative and newBalance hides the joint balance minus committedAmount.
+// signature is the owners' aggregated signature on JointTransferMessage for the current sequence number
+// recipient approves the transfer as for Transfer. A rejected transfer goes back to the joint account,
+// and an expired one is reclaimed with JointReclaim.
+// This function triggers a Transfer event
+func (s *SmartContract) JointTransfer(ctx contractapi.TransactionContextInterface, key ristretto.Point, recipient string, committedAmount ristretto.Point, newBalance ristretto.Point, amountProof rangeproof.Proof, balanceProof rangeproof.Proof, equalityProof equality.Proof, signature schnorr.Signature) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = validateCommitments(&committedAmount, &newBalance)
+	if err != nil {
+		return "", err
+	}
+	err = validatePoints(&signature.R)
+	if err != nil {
+		return "", fmt.Errorf("invalid joint signature: %w", err)
+	}
+
+	account, err := getJointAccount(ctx, &key)
+	if err != nil {
+		return "", err
+	}
+	if account == nil {
+		return "", fmt.Errorf("joint account %s does not exist", key)
+	}
+	message := JointTransferMessage(&account.Key, account.Sequence, recipient, &committedAmount, &newBalance)
+	if !schnorr.Verify(&account.Key, message, signature) {
+		return "", errors.New("joint signature not valid")
+	}
+
+	balanceKey, err := jointBalanceKey(ctx, &key)
+	if err != nil {
+		return "", err
+	}
+	err = checkRecipient(ctx, balanceKey, recipient)
+	if err != nil {
+		return "", err
+	}
+	timelock, err := resolveTimelock(ctx, 0)
+	if err != nil {
+		return "", err
+	}
+	balance, err := getCommittedBalance(ctx, balanceKey)
+	if err != nil {
+		return "", err
+	}
+	err = checkAccountEpoch(ctx, balanceKey)
+	if err != nil {
+		return "", err
+	}
+	err = isValidSpend(ctx, "balance", &balance.Commitment, &committedAmount, &newBalance, amountProof, balanceProof, equalityProof)
+	if err != nil {
+		return "", err
+	}
+
+	account.Sequence++
+	err = putJointAccount(ctx, account)
+	if err != nil {
+		return "", err
+	}
+	stub := ctx.GetStub()
+	TxID := stub.GetTxID()
+	err = stub.PutState(balanceKey, newBalance.Bytes())
+	if err != nil {
+		return "", fmt.Errorf("failed to update joint account %s: %v", key, err)
+	}
+	stagedAccount, err := stageTransfer(ctx, TxID, balanceKey, recipient, &committedAmount, timelock)
+	if err != nil {
+		return "", err
+	}
+
+	err = emitTransferEvent(ctx, transferEvent{balanceKey, stagedAccount, "Money sent"})
+	if err != nil {
+		return "", err
+	}
+	return TxID, nil
+}
+
+// JointReclaim returns an expired transfer from a joint account to it, as Reclaim does for client accounts
+// signature is the owners' aggregated signature on JointReclaimMessage.
+// This function triggers a Reclaim event
+func (s *SmartContract) JointReclaim(ctx contractapi.TransactionContextInterface, key ristretto.Point, TxId string, signature schnorr.Signature) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = validatePoints(&signature.R)
+	if err != nil {
+		return "", fmt.Errorf("invalid joint signature: %w", err)
+	}
+	account, err := getJointAccount(ctx, &key)
+	if err != nil {
+		return "", err
+	}
+	if account == nil {
+		return "", fmt.Errorf("joint account %s does not exist", key)
+	}
+	if !schnorr.Verify(&account.Key, JointReclaimMessage(&account.Key, TxId), signature) {
+		return "", errors.New("joint signature not valid")
+	}
+
+	balanceKey, err := jointBalanceKey(ctx, &key)
+	if err != nil {
+		return "", err
+	}
+	return reclaimTransfer(ctx, TxId, balanceKey)
+}
+
+// GetJointAccount returns the owners and the sequence number of a joint account
+func (s *SmartContract) GetJointAccount(ctx contractapi.TransactionContextInterface, key ristretto.Point) (*JointAccount, error) {
+	account, err := getJointAccount(ctx, &key)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return nil, fmt.Errorf("joint account %s does not exist", key)
+	}
+	return account, nil
+}
+
+// isSignedByOwner checks that signature on message is made with one of the owner keys of account
+func isSignedByOwner(account *JointAccount, message []byte, signature schnorr.Signature) bool {
+	for i := range account.Owners {
+		if schnorr.Verify(&account.Owners[i], message, signature) {
+			return true
+		}
+	}
+	return false
+}
+
+func jointKey(ctx contractapi.TransactionContextInterface, objectType string, key *ristretto.Point) (string, error) {
+	compositeKey, err := ctx.GetStub().CreateCompositeKey(objectType, []string{key.String()})
+	if err != nil {
+		return "", fmt.Errorf("failed to create the composite key: %v", err)
+	}
+	return compositeKey, nil
+}
+
+// jointBalanceKey is the account holding the balance of a joint account
+func jointBalanceKey(ctx contractapi.TransactionContextInterface, key *ristretto.Point) (string, error) {
+	return jointKey(ctx, jointBalanceObjectType, key)
+}
+
+// getJointAccount returns nil if the joint account does not exist
+func getJointAccount(ctx contractapi.TransactionContextInterface, key *ristretto.Point) (*JointAccount, error) {
+	accountKey, err := jointKey(ctx, jointAccountObjectType, key)
+	if err != nil {
+		return nil, err
+	}
+	accountJSON, err := ctx.GetStub().GetState(accountKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read joint account from world state: %v", err)
+	}
+	if accountJSON == nil {
+		return nil, nil
+	}
+	var account JointAccount
+	err = json.Unmarshal(accountJSON, &account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal: %v", err)
+	}
+	return &account, nil
+}
+
+func putJointAccount(ctx contractapi.TransactionContextInterface, account *JointAccount) error {
+	accountKey, err := jointKey(ctx, jointAccountObjectType, &account.Key)
+	if err != nil {
+		return err
+	}
+	accountJSON, err := json.Marshal(account)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().PutState(accountKey, accountJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put to world state. %v", err)
+	}
+	return nil
+}
+
+func emitTransferEvent(ctx contractapi.TransactionContextInterface, event transferEvent) error {
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent("Transfer", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+	return nil
+}
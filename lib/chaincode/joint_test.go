@@ -0,0 +1,168 @@
+package chaincode
+
+import (
+	"pedersen-commitment-transfer/src/equality"
+	"pedersen-commitment-transfer/src/musig"
+	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/rangeproof"
+	"pedersen-commitment-transfer/src/schnorr"
+	"testing"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/stretchr/testify/assert"
+)
+
+// jointSign runs a MuSig2 session of all owners on message
+func jointSign(t *testing.T, secrets []ristretto.Scalar, keys []ristretto.Point, message []byte) schnorr.Signature {
+	agg, err := musig.AggregateKeys(keys)
+	assert.NoError(t, err)
+	secretNonces := make([]*musig.SecretNonce, len(secrets))
+	publicNonces := make([]musig.PublicNonce, len(secrets))
+	for i := range secrets {
+		secretNonces[i], publicNonces[i] = musig.NewNonce()
+	}
+	session := musig.NewSession(agg, musig.AggregateNonces(publicNonces), message)
+	partials := make([]ristretto.Scalar, len(secrets))
+	for i := range secrets {
+		partials[i], err = session.Sign(i, &secrets[i], secretNonces[i])
+		assert.NoError(t, err)
+	}
+	return session.Aggregate(partials)
+}
+
+func TestJointTransfer(t *testing.T) {
+	ctx, stub, identity, state := newTestContext("alice", "Org1MSP")
+	H, bindingFactor := initTestContract(t, ctx, state)
+	balance := commitAmount(&H, &bindingFactor, 100)
+	state["alice"] = balance.Bytes()
+
+	secrets := make([]ristretto.Scalar, 3)
+	keys := make([]ristretto.Point, 3)
+	for i := range secrets {
+		secrets[i].Rand()
+		keys[i] = schnorr.PublicKey(&secrets[i])
+	}
+
+	_, err := new(SmartContract).CreateJointAccount(ctx, keys[:1])
+	assert.EqualError(t, err, "a joint account needs at least two owners")
+	encodedKey, err := new(SmartContract).CreateJointAccount(ctx, keys)
+	assert.NoError(t, err)
+	_, err = new(SmartContract).CreateJointAccount(ctx, keys)
+	assert.EqualError(t, err, "joint account "+encodedKey+" already exists")
+
+	var key ristretto.Point
+	assert.NoError(t, key.UnmarshalText([]byte(encodedKey)))
+
+	// Alice cannot deposit more than she has
+	var rDeposit, rLeft ristretto.Scalar
+	rDeposit.Rand()
+	rLeft.Sub(&bindingFactor, &rDeposit)
+	overdraft := commitAmount(&H, &rDeposit, 160)
+	overdraftProof, err := rangeproof.Prove(&H, testAmount(40), pedersen.NewSecret(&rLeft))
+	assert.NoError(t, err)
+	overdraftAmountProof, err := rangeproof.Prove(&H, testAmount(160), pedersen.NewSecret(&rDeposit))
+	assert.NoError(t, err)
+	overdraftSignature := schnorr.Sign(&secrets[0], JointDepositMessage(&key, "TxidTest", "alice", &overdraft))
+	_, err = new(SmartContract).DepositToJointAccount(ctx, key, overdraft, overdraftAmountProof, overdraftProof, overdraftSignature)
+	assert.EqualError(t, err, "deposit failed: balance range proof not valid")
+
+	deposit := commitAmount(&H, &rDeposit, 60)
+	balanceProof, err := rangeproof.Prove(&H, testAmount(40), pedersen.NewSecret(&rLeft))
+	assert.NoError(t, err)
+	depositProof, err := rangeproof.Prove(&H, testAmount(60), pedersen.NewSecret(&rDeposit))
+	assert.NoError(t, err)
+
+	// Only an owner can deposit, or the owners could not open the joint balance
+	var outsider ristretto.Scalar
+	outsider.Rand()
+	_, err = new(SmartContract).DepositToJointAccount(ctx, key, deposit, depositProof, balanceProof, schnorr.Sign(&outsider, JointDepositMessage(&key, "TxidTest", "alice", &deposit)))
+	assert.EqualError(t, err, "only an owner can deposit into a joint account")
+	_, err = new(SmartContract).DepositToJointAccount(ctx, key, deposit, depositProof, balanceProof, schnorr.Sign(&secrets[0], JointDepositMessage(&key, "TxidOther", "alice", &deposit)))
+	assert.EqualError(t, err, "only an owner can deposit into a joint account")
+
+	_, err = new(SmartContract).DepositToJointAccount(ctx, key, deposit, balanceProof, balanceProof, schnorr.Sign(&secrets[0], JointDepositMessage(&key, "TxidTest", "alice", &deposit)))
+	assert.EqualError(t, err, "deposit failed: amount range proof not valid")
+	_, err = new(SmartContract).DepositToJointAccount(ctx, key, deposit, depositProof, balanceProof, schnorr.Sign(&secrets[0], JointDepositMessage(&key, "TxidTest", "alice", &deposit)))
+	assert.NoError(t, err)
+
+	// The owners cannot spend more than the joint account holds
+	var rInflated, rEmpty, rRemaining ristretto.Scalar
+	rInflated.Rand()
+	rEmpty.Rand()
+	rRemaining.Sub(&rDeposit, &rInflated)
+	inflated := commitAmount(&H, &rInflated, 70)
+	inflatedProof, err := rangeproof.Prove(&H, testAmount(70), pedersen.NewSecret(&rInflated))
+	assert.NoError(t, err)
+	empty := commitAmount(&H, &rEmpty, 0)
+	emptyProof, err := rangeproof.Prove(&H, testAmount(0), pedersen.NewSecret(&rEmpty))
+	assert.NoError(t, err)
+	emptyEquality := equality.Prove(&H, &H, testAmount(0), pedersen.NewSecret(&rRemaining), pedersen.NewSecret(&rEmpty))
+	message := JointTransferMessage(&key, 0, "bob", &inflated, &empty)
+	_, err = new(SmartContract).JointTransfer(ctx, key, "bob", inflated, empty, inflatedProof, emptyProof, emptyEquality, jointSign(t, secrets, keys, message))
+	assert.EqualError(t, err, "balance equality proof not valid")
+
+	amount, newBalance, amountProof, jointProof, equalityProof, _, rJoint := spendProofs(t, &H, &rDeposit, 60, 25)
+	message = JointTransferMessage(&key, 0, "bob", &amount, &newBalance)
+
+	// All owners have to sign
+	_, err = new(SmartContract).JointTransfer(ctx, key, "bob", amount, newBalance, amountProof, jointProof, equalityProof, jointSign(t, secrets[:2], keys[:2], message))
+	assert.EqualError(t, err, "joint signature not valid")
+
+	signature := jointSign(t, secrets, keys, message)
+	_, err = new(SmartContract).JointTransfer(ctx, key, "mallory", amount, newBalance, amountProof, jointProof, equalityProof, signature)
+	assert.EqualError(t, err, "joint signature not valid")
+
+	// nor can anyone re-blind the balance left behind their back
+	_, reblinded, _, reblindedProof, reblindedEquality, _, _ := spendProofs(t, &H, &rDeposit, 60, 25)
+	_, err = new(SmartContract).JointTransfer(ctx, key, "bob", amount, reblinded, amountProof, reblindedProof, reblindedEquality, signature)
+	assert.EqualError(t, err, "joint signature not valid")
+
+	_, err = new(SmartContract).JointTransfer(ctx, key, "bob", amount, newBalance, amountProof, jointProof, equalityProof, signature)
+	assert.NoError(t, err)
+
+	balanceKey, err := jointBalanceKey(ctx, &key)
+	assert.NoError(t, err)
+	jointBalance := readPoint(t, state, balanceKey)
+	assert.True(t, jointBalance.Equals(&newBalance))
+
+	// Bob is credited once he approves the transfer
+	assert.Nil(t, state["bob"])
+	txInfo, err := getTxInfo(stub, "TxidTest")
+	assert.NoError(t, err)
+	assert.Equal(t, balanceKey, txInfo.Sender)
+	identity.GetIDReturns("bob", nil)
+	_, err = new(SmartContract).Approve(ctx, "TxidTest")
+	assert.NoError(t, err)
+	bobBalance := readPoint(t, state, "bob")
+	assert.True(t, bobBalance.Equals(&amount))
+
+	// The sequence number moved on, so the signature cannot be replayed
+	_, err = new(SmartContract).JointTransfer(ctx, key, "bob", amount, newBalance, amountProof, jointProof, equalityProof, signature)
+	assert.EqualError(t, err, "joint signature not valid")
+	account, err := new(SmartContract).GetJointAccount(ctx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), account.Sequence)
+	assert.Len(t, account.Owners, 3)
+
+	// A transfer Carol lets expire goes back to the joint account
+	stub.GetTxIDReturns("TxidJoint")
+	amount, newBalance, amountProof, jointProof, equalityProof, _, _ = spendProofs(t, &H, &rJoint, 35, 10)
+	message = JointTransferMessage(&key, 1, "carol", &amount, &newBalance)
+	_, err = new(SmartContract).JointTransfer(ctx, key, "carol", amount, newBalance, amountProof, jointProof, equalityProof, jointSign(t, secrets, keys, message))
+	assert.NoError(t, err)
+	txInfo, err = getTxInfo(stub, "TxidJoint")
+	assert.NoError(t, err)
+	stub.GetTxTimestampReturns(&timestamp.Timestamp{Seconds: txInfo.Deadline}, nil)
+
+	_, err = new(SmartContract).Reclaim(ctx, "TxidJoint")
+	assert.EqualError(t, err, "only the sender can reclaim transfer TxidJoint")
+	reclaimSignature := jointSign(t, secrets, keys, JointReclaimMessage(&key, "TxidJoint"))
+	_, err = new(SmartContract).JointReclaim(ctx, key, "TxidTest", reclaimSignature)
+	assert.EqualError(t, err, "joint signature not valid")
+	_, err = new(SmartContract).JointReclaim(ctx, key, "TxidJoint", reclaimSignature)
+	assert.NoError(t, err)
+	expectedBalance := pedersen.Add(&newBalance, &amount)
+	jointBalance = readPoint(t, state, balanceKey)
+	assert.True(t, jointBalance.Equals(&expectedBalance))
+}
@@ -2,9 +2,12 @@ package chaincode
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"math/big"
+	"pedersen-commitment-transfer/src/equality"
 	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/rangeproof"
+	"pedersen-commitment-transfer/src/sumproof"
 
 	"github.com/bwesterb/go-ristretto"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
@@ -12,49 +15,108 @@ import (
 
 const PEDERSEN_ID = "PEDERSEN"
 const PEDERSEN_H_ID = "PEDERSEN_H"
-const PEDERSEN_BINDING_ID = "PEDERSEN_BINDING"
-const PEDERSEN_ZERO_ID = "PEDERSEN_ZERO"
 
-func IsValidEncryption(ctx contractapi.TransactionContextInterface, x int64, committedAmount *ristretto.Point) error {
+// Transient key of the proof that a committed amount opens to the transient "amount"
+const amountProofKey = "amountProof"
+
+// IsValidEncryption checks that committedAmount commits to amount
+// Blinding factors are held by the clients, so instead of opening the commitment the
+// client proves knowledge of the blinding factor of committedAmount - amount H.
+func IsValidEncryption(ctx contractapi.TransactionContextInterface, amount pedersen.Amount, committedAmount *ristretto.Point, proof sumproof.Proof) error {
 
 	//Fetch pedersen parameters from state
-	H, bindingFactor, _, err := GetPedersenParams(ctx)
+	H, err := GetPedersenParams(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to fetch pedersen encryption parameters: %v", err)
 	}
 
-	isValid := pedersen.Validate(x, *committedAmount, *H, *bindingFactor)
-	if !isValid {
+	if !sumproof.Verify(H, []ristretto.Point{*committedAmount}, amount, proof) {
 		return fmt.Errorf("encryption not valid")
 	}
 	return nil
 }
 
-// InitLedger adds a base set of assets to the ledger
-func InitPedersen(ctx contractapi.TransactionContextInterface, H ristretto.Point, bindingFactor ristretto.Scalar) error {
+// isValidSpend checks that committedAmount can be taken out of current, leaving remainder
+// The range proofs show that neither committedAmount nor remainder is negative and the
+// equality proof that remainder hides current - committedAmount. what names current in the errors.
+func isValidSpend(ctx contractapi.TransactionContextInterface, what string, current, committedAmount, remainder *ristretto.Point, amountProof, remainderProof rangeproof.Proof, equalityProof equality.Proof) error {
+	H, err := GetPedersenParams(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch pedersen encryption parameters: %v", err)
+	}
+	if !rangeproof.Verify(H, committedAmount, amountBits, amountProof) {
+		return errors.New("amount range proof not valid")
+	}
+	return isValidRemainderCommitment(ctx, what, current, committedAmount, remainder, remainderProof, equalityProof)
+}
 
-	var vX ristretto.Scalar
+// isValidRemainderCommitment checks that remainder hides current - debit and is not negative
+// Unlike isValidSpend it leaves checking debit to the caller.
+func isValidRemainderCommitment(ctx contractapi.TransactionContextInterface, what string, current, debit, remainder *ristretto.Point, remainderProof rangeproof.Proof, equalityProof equality.Proof) error {
+	err := validatePoints(&equalityProof.A1, &equalityProof.A2)
+	if err != nil {
+		return fmt.Errorf("invalid equality proof: %w", err)
+	}
 
-	zero := big.NewInt(0)
+	H, err := GetPedersenParams(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch pedersen encryption parameters: %v", err)
+	}
+	if !rangeproof.Verify(H, remainder, amountBits, remainderProof) {
+		return fmt.Errorf("%s range proof not valid", what)
+	}
+	expected := pedersen.Sub(current, debit)
+	if !equality.Verify(H, H, &expected, remainder, equalityProof) {
+		return fmt.Errorf("%s equality proof not valid", what)
+	}
+	return nil
+}
 
-	zeroCommitted := pedersen.CommitTo(&H, &bindingFactor, vX.SetBigInt(zero))
+// isValidDebit checks that committedAmount can be taken out of current without opening it
+// amountProof is a range proof on committedAmount and remainderProof one on current - committedAmount,
+// made with the difference of the blinding factors. what names current in the errors.
+func isValidDebit(ctx contractapi.TransactionContextInterface, what string, current, committedAmount *ristretto.Point, amountProof, remainderProof rangeproof.Proof) error {
+	H, err := GetPedersenParams(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch pedersen encryption parameters: %v", err)
+	}
+	if !rangeproof.Verify(H, committedAmount, amountBits, amountProof) {
+		return errors.New("amount range proof not valid")
+	}
+	return isValidRemainder(ctx, what, current, committedAmount, remainderProof)
+}
 
-	HJSON, err := H.MarshalBinary()
+// isValidRemainder checks that taking committedAmount out of current does not leave it negative
+// It is for debits whose amount is checked by the caller, such as one opened in the transient map.
+// remainderProof is a range proof on current - committedAmount, made with the difference of the
+// blinding factors. what names current in the errors.
+func isValidRemainder(ctx contractapi.TransactionContextInterface, what string, current, committedAmount *ristretto.Point, remainderProof rangeproof.Proof) error {
+	H, err := GetPedersenParams(ctx)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to fetch pedersen encryption parameters: %v", err)
+	}
+	remainder := pedersen.Sub(current, committedAmount)
+	if !rangeproof.Verify(H, &remainder, amountBits, remainderProof) {
+		return fmt.Errorf("%s range proof not valid", what)
 	}
+	return nil
+}
+
+// InitLedger adds a base set of assets to the ledger
+// Only the public generator H is stored; no secret material is kept on the ledger.
+func InitPedersen(ctx contractapi.TransactionContextInterface, H ristretto.Point) error {
 
-	BindingFactorJSON, err := bindingFactor.MarshalBinary()
+	err := pedersen.ValidateParams(&H)
 	if err != nil {
 		return err
 	}
 
-	ZeroPedersenJSON, err := zeroCommitted.MarshalBinary()
+	HJSON, err := H.MarshalBinary()
 	if err != nil {
 		return err
 	}
 
-	pedersenVariables := createPedersenVariables(HJSON, BindingFactorJSON, ZeroPedersenJSON)
+	pedersenVariables := createPedersenVariables(HJSON)
 	pedersenVariablesJSON, err := json.Marshal(pedersenVariables)
 	if err != nil {
 		return err
@@ -68,67 +130,57 @@ func InitPedersen(ctx contractapi.TransactionContextInterface, H ristretto.Point
 	return nil
 }
 
-// ReadAsset returns the asset stored in the world state with given id.
-func GetPedersenParams(ctx contractapi.TransactionContextInterface) (*ristretto.Point, *ristretto.Scalar, *ristretto.Point, error) {
+// GetPedersenParams reads the generator H stored by InitPedersen.
+// Missing or degenerate parameters are an error, never replaced by zero values.
+func GetPedersenParams(ctx contractapi.TransactionContextInterface) (*ristretto.Point, error) {
 	pedersenVariablesJson, err := ctx.GetStub().GetState(PEDERSEN_ID)
 	if err != nil {
-		return &ristretto.Point{}, &ristretto.Scalar{}, &ristretto.Point{}, fmt.Errorf("failed to read from world state: %v", err)
+		return &ristretto.Point{}, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if pedersenVariablesJson == nil {
+		return &ristretto.Point{}, fmt.Errorf("pedersen parameters are not set, call Initialize() first")
 	}
+	return parsePedersenVariables(pedersenVariablesJson)
+}
+
+// parsePedersenVariables decodes and validates the JSON stored by InitPedersen
+func parsePedersenVariables(pedersenVariablesJson []byte) (*ristretto.Point, error) {
 	var pedersenVariables PedersenVariables
-	err = json.Unmarshal(pedersenVariablesJson, &pedersenVariables)
+	err := json.Unmarshal(pedersenVariablesJson, &pedersenVariables)
 	if err != nil {
-		fmt.Errorf("failed to unmarshal")
-	}
-
-	// HJSON, err := ctx.GetStub().GetState(PEDERSEN_H_ID)
-	// if err != nil {
-	// 	return &ristretto.Point{}, &ristretto.Scalar{}, &ristretto.Point{}, fmt.Errorf("failed to read from world state: %v", err)
-	// }
-	// BindingFactorJSON, err := ctx.GetStub().GetState(PEDERSEN_BINDING_ID)
-	// if err != nil {
-	// 	return &ristretto.Point{}, &ristretto.Scalar{}, &ristretto.Point{}, fmt.Errorf("failed to read from world state: %v", err)
-	// }
-
-	// ZeroPedersenJSON, err := ctx.GetStub().GetState(PEDERSEN_ZERO_ID)
-	// if err != nil {
-	// 	return &ristretto.Point{}, &ristretto.Scalar{}, &ristretto.Point{}, fmt.Errorf("failed to read from world state: %v", err)
-	// }
-
-	var H, zeroPedersen ristretto.Point
-	var bindingFactor ristretto.Scalar
-
-	//This case should not happen, param is passed in input to Init
-	if pedersenVariables.H_bytes == nil {
-		H = ristretto.Point{}
-		err = nil
-	} else {
-		err = H.UnmarshalBinary(pedersenVariables.H_bytes)
-		if err != nil {
-			return &ristretto.Point{}, &ristretto.Scalar{}, &ristretto.Point{}, fmt.Errorf("failed to unmarshal H : %v", err)
-		}
+		return &ristretto.Point{}, fmt.Errorf("failed to unmarshal: %v", err)
 	}
 
-	//This case should not happen, param is passed in input to Init
-	if pedersenVariables.BindingFactor_bytes == nil {
-		bindingFactor = ristretto.Scalar{}
-		err = nil
-	} else {
-		err = bindingFactor.UnmarshalBinary(pedersenVariables.BindingFactor_bytes)
+	H, err := pedersen.DecodePoint(pedersenVariables.H_bytes)
+	if err != nil {
+		return &ristretto.Point{}, fmt.Errorf("failed to unmarshal H : %v", err)
+	}
+	err = pedersen.ValidateParams(&H)
+	if err != nil {
+		return &ristretto.Point{}, err
+	}
+
+	return &H, nil
+}
+
+// validateCommitments rejects degenerate commitments received from a client
+func validateCommitments(commitments ...*ristretto.Point) error {
+	for _, commitment := range commitments {
+		err := pedersen.ValidateCommitment(commitment)
 		if err != nil {
-			return &ristretto.Point{}, &ristretto.Scalar{}, &ristretto.Point{}, fmt.Errorf("failed to unmarshal the Binding Factor : %v", err)
+			return err
 		}
 	}
+	return nil
+}
 
-	//This case should not happen, param is passed in input to Init
-	if pedersenVariables.ZeroCommitted_bytes == nil {
-		zeroPedersen = ristretto.Point{}
-		err = nil
-	} else {
-		err = zeroPedersen.UnmarshalBinary(pedersenVariables.ZeroCommitted_bytes)
+// validatePoints rejects degenerate public keys and proof points received from a client
+func validatePoints(points ...*ristretto.Point) error {
+	for _, point := range points {
+		err := pedersen.ValidatePoint(point)
 		if err != nil {
-			return &ristretto.Point{}, &ristretto.Scalar{}, &ristretto.Point{}, fmt.Errorf("failed to unmarshal the vale for the committed zero : %v", err)
+			return err
 		}
 	}
-
-	return &H, &bindingFactor, &zeroPedersen, nil
+	return nil
 }
@@ -2,9 +2,10 @@ package chaincode
 
 import (
 	"encoding/json"
-	"math/big"
 	"pedersen-commitment-transfer/lib/tests/testsfakes"
 	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/rangeproof"
+	"pedersen-commitment-transfer/src/sumproof"
 	"testing"
 
 	"github.com/bwesterb/go-ristretto"
@@ -57,16 +58,9 @@ func TestInitPedersen(t *testing.T) {
 	stub.GetTxIDStub = func() string {
 		return "TxidTest"
 	}
-	H, bindingFactor, _ := generateRandomCommitment(0)
+	H, _, _ := generateRandomCommitment(0)
 
-	InitPedersen(ctx, H, bindingFactor)
-
-	//Prepare expected values
-	var vX ristretto.Scalar
-
-	zero := big.NewInt(0)
-
-	zeroCommitted := pedersen.CommitTo(&H, &bindingFactor, vX.SetBigInt(zero))
+	InitPedersen(ctx, H)
 
 	//Let's check that putstate was called correctly.
 	_, initPedersenPut := stub.PutStateArgsForCall(0)
@@ -75,25 +69,15 @@ func TestInitPedersen(t *testing.T) {
 	json.Unmarshal(initPedersenPut, &pedersenVariables_got)
 
 	var H_got ristretto.Point
-	var bindingFactor_got ristretto.Scalar
-	var zeroPedersen_got ristretto.Point
-
 	H_got.UnmarshalBinary(pedersenVariables_got.H_bytes)
-	bindingFactor_got.UnmarshalBinary(pedersenVariables_got.BindingFactor_bytes)
-	zeroPedersen_got.UnmarshalBinary(pedersenVariables_got.ZeroCommitted_bytes)
 
 	if !H_got.Equals(&H) {
 		t.Fatal("Error")
 	}
 
-	if !zeroPedersen_got.Equals(&zeroCommitted) {
-		t.Fatal("Error")
-	}
-
-	if !bindingFactor_got.Equals(&bindingFactor) {
-		t.Fatalf("Error: expected %v, got %v", bindingFactor, bindingFactor_got)
-	}
-
+	var stored map[string]json.RawMessage
+	json.Unmarshal(initPedersenPut, &stored)
+	assert.Len(t, stored, 1, "Only H should be stored")
 }
 
 func TestGetPedersenParams(t *testing.T) {
@@ -105,19 +89,15 @@ func TestGetPedersenParams(t *testing.T) {
 	stub.GetTxIDStub = func() string {
 		return "TxidTest"
 	}
-	H, bindingFactor, zeroPedersen := generateRandomCommitment(0)
+	H, _, _ := generateRandomCommitment(0)
 	HJSON, _ := H.MarshalBinary()
-	BindingFactorJSON, _ := bindingFactor.MarshalBinary()
-	ZeroPedersenJSON, _ := zeroPedersen.MarshalBinary()
-	pedersenVariables := createPedersenVariables(HJSON, BindingFactorJSON, ZeroPedersenJSON)
+	pedersenVariables := createPedersenVariables(HJSON)
 	pedersenVariablesJson, _ := json.Marshal(pedersenVariables)
 	stub.PutState(PEDERSEN_ID, pedersenVariablesJson)
 
 	stub.GetStateReturnsOnCall(0, pedersenVariablesJson, nil)
 
-	var H2, zeroPedersen2 *ristretto.Point
-	var bindingFactor2 *ristretto.Scalar
-	H2, bindingFactor2, zeroPedersen2, err := GetPedersenParams(ctx)
+	H2, err := GetPedersenParams(ctx)
 
 	if err != nil {
 		t.Fatal(err)
@@ -125,15 +105,6 @@ func TestGetPedersenParams(t *testing.T) {
 	if !H2.Equals(&H) {
 		t.Fatal("Error")
 	}
-
-	if !zeroPedersen2.Equals(&zeroPedersen) {
-		t.Fatal("Error")
-	}
-
-	if !bindingFactor2.Equals(&bindingFactor) {
-		t.Fatalf("Error: expected %v, got %v", bindingFactor, bindingFactor2)
-	}
-
 }
 
 func TestIsValidEncryption(t *testing.T) {
@@ -151,14 +122,16 @@ func TestIsValidEncryption(t *testing.T) {
 			//It uses GetPedersenParams under the hood, hence similar mocking methods.
 			H, bindingFactor, committedAmount := generateRandomCommitment(testcase.amount)
 			HJSON, _ := H.MarshalBinary()
-			BindingFactorJSON, _ := bindingFactor.MarshalBinary()
-			committedAmountJSON, _ := committedAmount.MarshalBinary()
-			pedersenVariables := createPedersenVariables(HJSON, BindingFactorJSON, committedAmountJSON)
+			pedersenVariables := createPedersenVariables(HJSON)
 			pedersenVariablesJson, _ := json.Marshal(pedersenVariables)
 
 			stub.GetStateReturnsOnCall(i, pedersenVariablesJson, nil)
 
-			err := IsValidEncryption(ctx, testcase.wrongAmount, &committedAmount)
+			// The client proves the opening with its own blinding factor
+			proof, err := sumproof.Prove(&H, []ristretto.Point{committedAmount}, testAmount(testcase.amount), pedersen.NewSecret(&bindingFactor))
+			assert.NoError(t, err)
+
+			err = IsValidEncryption(ctx, testAmount(testcase.wrongAmount), &committedAmount, proof)
 			if !testcase.isError {
 				if err != nil {
 					t.Fatalf("Error is: %v", err)
@@ -172,10 +145,59 @@ func TestIsValidEncryption(t *testing.T) {
 
 func generateRandomCommitment(amount int64) (ristretto.Point, ristretto.Scalar, ristretto.Point) {
 
-	var rX, vX ristretto.Scalar
+	var rX ristretto.Scalar
 	H1 := pedersen.GenerateH() // Secondary point on the Curve
 	rX.Rand()
-	amountBig := big.NewInt(amount)
-	amountCommitted := pedersen.CommitTo(&H1, &rX, vX.SetBigInt(amountBig))
+	amountCommitted := pedersen.CommitTo(&H1, pedersen.NewSecret(&rX), testAmount(amount))
 	return H1, rX, amountCommitted
 }
+
+func TestInitPedersenRejectsDegenerateParams(t *testing.T) {
+	var B, negB, identity ristretto.Point
+	B.SetBase()
+	negB.Neg(&B)
+	identity.SetZero()
+
+	testcases := []struct {
+		name string
+		H    ristretto.Point
+		err  error
+	}{
+		{name: "Identity H", H: identity, err: pedersen.ErrIdentityPoint},
+		{name: "H equal to B", H: B, err: pedersen.ErrDegenerateH},
+		{name: "H equal to -B", H: negB, err: pedersen.ErrDegenerateH},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			ctx, stub, _, _ := newTestContext("client", "Org1MSP")
+			err := InitPedersen(ctx, testcase.H)
+			assert.ErrorIs(t, err, testcase.err)
+			assert.Equal(t, 0, stub.PutStateCallCount(), "Nothing should be stored")
+		})
+	}
+}
+
+func TestGetPedersenParamsMissing(t *testing.T) {
+	ctx, _, _, _ := newTestContext("client", "Org1MSP")
+	_, err := GetPedersenParams(ctx)
+	assert.Error(t, err, "Missing parameters should not be replaced by zero values")
+}
+
+func TestIsValidRemainder(t *testing.T) {
+	ctx, _, _, state := newTestContext("alice", "Org2MSP")
+	H, bindingFactor := initTestContract(t, ctx, state)
+	balance := commitAmount(&H, &bindingFactor, 100)
+
+	var rAmount, rLeft ristretto.Scalar
+	rAmount.Rand()
+	rLeft.Sub(&bindingFactor, &rAmount)
+	committedAmount := commitAmount(&H, &rAmount, 30)
+	proof, err := rangeproof.Prove(&H, testAmount(70), pedersen.NewSecret(&rLeft))
+	assert.NoError(t, err)
+	assert.NoError(t, isValidRemainder(ctx, "balance", &balance, &committedAmount, proof))
+
+	// Taking 130 out of 100 leaves a negative balance, which no range proof covers
+	overdraft := commitAmount(&H, &rAmount, 130)
+	assert.EqualError(t, isValidRemainder(ctx, "balance", &balance, &overdraft, proof), "balance range proof not valid")
+}
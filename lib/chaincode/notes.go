@@ -0,0 +1,488 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pedersen-commitment-transfer/src/equality"
+	"pedersen-commitment-transfer/src/notes"
+	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/rangeproof"
+	"pedersen-commitment-transfer/src/schnorr"
+	"strconv"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Key of the note tree frontier
+const noteTreeKey = "noteTree"
+
+// Object types for the composite keys of the note mode
+// A note without an epoch was appended in epoch 0.
+const noteRootObjectType = "noteRoot"
+const nullifierObjectType = "nullifier"
+const noteEpochObjectType = "noteEpoch"
+
+// Bit width of the range proofs on output notes
+const noteRangeBits = amountBits
+
+// NoteSpend spends one note of the tree
+// The path proves that the note commitment is in the tree under Root, a root the tree had at some point.
+// Outputs must commit to the same total as the spent note, each with a range proof.
+// The spent note and its position are revealed; only the amounts stay hidden.
+type NoteSpend struct {
+	Note        notes.Note         `json:"note"`
+	Position    uint64             `json:"position"`
+	Path        []ristretto.Point  `json:"path"`
+	Root        ristretto.Point    `json:"root"`
+	Outputs     []notes.Note       `json:"outputs"`
+	RangeProofs []rangeproof.Proof `json:"rangeProofs"`
+	Signature   schnorr.Signature  `json:"signature"`
+}
+
+// NoteMigration moves a note of a past parameter epoch to the current one
+// Output commits to the same value as Note under the current H, which Proof shows as for MigrateBalance.
+// Signature is made by the owner of Note on the spend message of Output.
+type NoteMigration struct {
+	Note      notes.Note        `json:"note"`
+	Position  uint64            `json:"position"`
+	Path      []ristretto.Point `json:"path"`
+	Root      ristretto.Point   `json:"root"`
+	Output    notes.Note        `json:"output"`
+	Proof     equality.Proof    `json:"proof"`
+	Signature schnorr.Signature `json:"signature"`
+}
+
+// noteEvent lists the spent nullifier, if any, and the notes appended to the tree
+// Wallets replay these events to rebuild the tree and compute their membership paths.
+type noteEvent struct {
+	Nullifier string         `json:"nullifier,omitempty"`
+	To        string         `json:"to,omitempty"`
+	Appended  []appendedNote `json:"appended,omitempty"`
+}
+
+type appendedNote struct {
+	Position uint64     `json:"position"`
+	Note     notes.Note `json:"note"`
+}
+
+// WithdrawMessage is the message the owner of a note signs to withdraw it into account
+func WithdrawMessage(nullifier *ristretto.Point, account string) []byte {
+	return append(notes.SpendMessage(nullifier, nil), account...)
+}
+
+// DepositNote moves the value of note out of the client account and appends the note to the note tree
+// amountProof and balanceProof are the debit proofs of the note value, see the package documentation.
+// This function triggers a NoteAppended event
+func (s *SmartContract) DepositNote(ctx contractapi.TransactionContextInterface, note notes.Note, amountProof rangeproof.Proof, balanceProof rangeproof.Proof) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = validateNote(&note)
+	if err != nil {
+		return "", err
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+	balance, err := getCommittedBalance(ctx, clientID)
+	if err != nil {
+		return "", err
+	}
+	err = isValidDebit(ctx, "balance", &balance.Commitment, &note.Value, amountProof, balanceProof)
+	if err != nil {
+		return "", fmt.Errorf("depositing note failed: %v", err)
+	}
+	_, _, err = subtractFromBalance(ctx, clientID, &note.Value)
+	if err != nil {
+		return "", err
+	}
+
+	appended, err := appendNotes(ctx, []notes.Note{note})
+	if err != nil {
+		return "", err
+	}
+
+	err = emitNoteEvent(ctx, "NoteAppended", noteEvent{Appended: appended})
+	if err != nil {
+		return "", err
+	}
+
+	return ctx.GetStub().GetTxID(), nil
+}
+
+// SpendNote spends a note into new output notes
+// The note must be in the current parameter epoch, see MigrateNote.
+// This function triggers a NoteSpent event listing the outputs
+func (s *SmartContract) SpendNote(ctx contractapi.TransactionContextInterface, spend NoteSpend) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	if len(spend.Outputs) == 0 {
+		return "", errors.New("a spend needs at least one output")
+	}
+	if len(spend.RangeProofs) != len(spend.Outputs) {
+		return "", fmt.Errorf("expected %d range proofs, got %d", len(spend.Outputs), len(spend.RangeProofs))
+	}
+
+	for i := range spend.Outputs {
+		err = validateNote(&spend.Outputs[i])
+		if err != nil {
+			return "", fmt.Errorf("output %d: %w", i, err)
+		}
+	}
+
+	nullifier := spend.Note.Nullifier()
+	err = checkNoteSpend(ctx, &spend.Note, spend.Position, spend.Path, &spend.Root)
+	if err != nil {
+		return "", err
+	}
+	err = validatePoints(&spend.Signature.R)
+	if err != nil {
+		return "", fmt.Errorf("invalid note signature: %w", err)
+	}
+	if !schnorr.Verify(&spend.Note.Owner, notes.SpendMessage(&nullifier, spend.Outputs), spend.Signature) {
+		return "", errors.New("note signature not valid")
+	}
+
+	H, err := GetPedersenParams(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch pedersen encryption parameters: %v", err)
+	}
+	var total ristretto.Point
+	total.SetZero()
+	for i := range spend.Outputs {
+		if !rangeproof.Verify(H, &spend.Outputs[i].Value, noteRangeBits, spend.RangeProofs[i]) {
+			return "", fmt.Errorf("range proof of output %d not valid", i)
+		}
+		total = pedersen.Add(&total, &spend.Outputs[i].Value)
+	}
+	if !total.Equals(&spend.Note.Value) {
+		return "", errors.New("outputs do not add up to the spent note")
+	}
+
+	err = spendNullifier(ctx, &nullifier)
+	if err != nil {
+		return "", err
+	}
+	appended, err := appendNotes(ctx, spend.Outputs)
+	if err != nil {
+		return "", err
+	}
+
+	err = emitNoteEvent(ctx, "NoteSpent", noteEvent{Nullifier: nullifier.String(), Appended: appended})
+	if err != nil {
+		return "", err
+	}
+
+	return ctx.GetStub().GetTxID(), nil
+}
+
+// WithdrawNote spends a note into the client account
+// The note must be in the current parameter epoch, see MigrateNote.
+// This function triggers a NoteSpent event
+func (s *SmartContract) WithdrawNote(ctx contractapi.TransactionContextInterface, note notes.Note, position uint64, path []ristretto.Point, root ristretto.Point, signature schnorr.Signature) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	nullifier := note.Nullifier()
+	err = checkNoteSpend(ctx, &note, position, path, &root)
+	if err != nil {
+		return "", err
+	}
+	err = validatePoints(&signature.R)
+	if err != nil {
+		return "", fmt.Errorf("invalid note signature: %w", err)
+	}
+	if !schnorr.Verify(&note.Owner, WithdrawMessage(&nullifier, clientID), signature) {
+		return "", errors.New("note signature not valid")
+	}
+
+	err = spendNullifier(ctx, &nullifier)
+	if err != nil {
+		return "", err
+	}
+	_, _, err = addToBalance(ctx, clientID, &note.Value)
+	if err != nil {
+		return "", err
+	}
+
+	err = emitNoteEvent(ctx, "NoteSpent", noteEvent{Nullifier: nullifier.String(), To: clientID})
+	if err != nil {
+		return "", err
+	}
+
+	return ctx.GetStub().GetTxID(), nil
+}
+
+// MigrateNote spends a note of a past parameter epoch into a note of the current one
+// This function triggers a NoteSpent event listing the migrated note
+func (s *SmartContract) MigrateNote(ctx contractapi.TransactionContextInterface, migration NoteMigration) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = validateNote(&migration.Output)
+	if err != nil {
+		return "", fmt.Errorf("output: %w", err)
+	}
+	err = validatePoints(&migration.Proof.A1, &migration.Proof.A2)
+	if err != nil {
+		return "", fmt.Errorf("invalid migration proof: %w", err)
+	}
+
+	nullifier := migration.Note.Nullifier()
+	err = checkNoteMembership(ctx, &migration.Note, migration.Position, migration.Path, &migration.Root)
+	if err != nil {
+		return "", err
+	}
+	epoch, err := getPedersenEpoch(ctx)
+	if err != nil {
+		return "", err
+	}
+	noteEpoch, err := getNoteEpoch(ctx, migration.Position)
+	if err != nil {
+		return "", err
+	}
+	if noteEpoch == epoch {
+		return "", fmt.Errorf("note at position %d is already in epoch %d", migration.Position, epoch)
+	}
+	err = validatePoints(&migration.Signature.R)
+	if err != nil {
+		return "", fmt.Errorf("invalid note signature: %w", err)
+	}
+	if !schnorr.Verify(&migration.Note.Owner, notes.SpendMessage(&nullifier, []notes.Note{migration.Output}), migration.Signature) {
+		return "", errors.New("note signature not valid")
+	}
+
+	oldH, err := getRetiredH(ctx, noteEpoch)
+	if err != nil {
+		return "", err
+	}
+	newH, err := GetPedersenParams(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch pedersen encryption parameters: %v", err)
+	}
+	if !equality.Verify(oldH, newH, &migration.Note.Value, &migration.Output.Value, migration.Proof) {
+		return "", errors.New("migration proof not valid")
+	}
+
+	err = spendNullifier(ctx, &nullifier)
+	if err != nil {
+		return "", err
+	}
+	appended, err := appendNotes(ctx, []notes.Note{migration.Output})
+	if err != nil {
+		return "", err
+	}
+
+	err = emitNoteEvent(ctx, "NoteSpent", noteEvent{Nullifier: nullifier.String(), Appended: appended})
+	if err != nil {
+		return "", err
+	}
+
+	return ctx.GetStub().GetTxID(), nil
+}
+
+// checkNoteSpend checks that the note is in the tree, in the current parameter epoch and has not been spent yet
+func checkNoteSpend(ctx contractapi.TransactionContextInterface, note *notes.Note, position uint64, path []ristretto.Point, root *ristretto.Point) error {
+	err := checkNoteMembership(ctx, note, position, path, root)
+	if err != nil {
+		return err
+	}
+	epoch, err := getPedersenEpoch(ctx)
+	if err != nil {
+		return err
+	}
+	noteEpoch, err := getNoteEpoch(ctx, position)
+	if err != nil {
+		return err
+	}
+	if noteEpoch != epoch {
+		return fmt.Errorf("note at position %d is in epoch %d, call MigrateNote() to move it to epoch %d", position, noteEpoch, epoch)
+	}
+	return nil
+}
+
+// checkNoteMembership checks that the note is in the tree and has not been spent yet
+func checkNoteMembership(ctx contractapi.TransactionContextInterface, note *notes.Note, position uint64, path []ristretto.Point, root *ristretto.Point) error {
+	stub := ctx.GetStub()
+
+	err := validateNote(note)
+	if err != nil {
+		return err
+	}
+
+	rootKey, err := stub.CreateCompositeKey(noteRootObjectType, []string{root.String()})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key: %v", err)
+	}
+	known, err := stub.GetState(rootKey)
+	if err != nil {
+		return fmt.Errorf("failed to read note root from world state: %v", err)
+	}
+	if known == nil {
+		return errors.New("unknown note tree root")
+	}
+
+	cm := note.Commitment()
+	if !notes.VerifyPath(root, &cm, position, path) {
+		return errors.New("note membership proof not valid")
+	}
+
+	nullifier := note.Nullifier()
+	nullifierKey, err := stub.CreateCompositeKey(nullifierObjectType, []string{nullifier.String()})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key: %v", err)
+	}
+	spent, err := stub.GetState(nullifierKey)
+	if err != nil {
+		return fmt.Errorf("failed to read nullifier from world state: %v", err)
+	}
+	if spent != nil {
+		return errors.New("note already spent")
+	}
+	return nil
+}
+
+func spendNullifier(ctx contractapi.TransactionContextInterface, nullifier *ristretto.Point) error {
+	stub := ctx.GetStub()
+	nullifierKey, err := stub.CreateCompositeKey(nullifierObjectType, []string{nullifier.String()})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key: %v", err)
+	}
+	return stub.PutState(nullifierKey, []byte(stub.GetTxID()))
+}
+
+func emitNoteEvent(ctx contractapi.TransactionContextInterface, name string, event noteEvent) error {
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent(name, eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+	return nil
+}
+
+// getNoteEpoch returns the parameter epoch the note at position is committed in
+func getNoteEpoch(ctx contractapi.TransactionContextInterface, position uint64) (uint64, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(noteEpochObjectType, []string{strconv.FormatUint(position, 10)})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create the composite key: %v", err)
+	}
+	epochBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the epoch of note %d from world state: %v", position, err)
+	}
+	if epochBytes == nil {
+		return 0, nil
+	}
+	return strconv.ParseUint(string(epochBytes), 10, 64)
+}
+
+// appendNotes adds the note commitments to the tree and records the new root
+// Notes appended after a rotation of the parameters are tagged with the current epoch.
+func appendNotes(ctx contractapi.TransactionContextInterface, newNotes []notes.Note) ([]appendedNote, error) {
+	stub := ctx.GetStub()
+	epoch, err := getPedersenEpoch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	frontier := notes.NewFrontier()
+	frontierJSON, err := stub.GetState(noteTreeKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read note tree from world state: %v", err)
+	}
+	if frontierJSON != nil {
+		err = json.Unmarshal(frontierJSON, frontier)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal note tree: %v", err)
+		}
+	}
+
+	appended := make([]appendedNote, len(newNotes))
+	for i := range newNotes {
+		cm := newNotes[i].Commitment()
+		position, err := frontier.Append(&cm)
+		if err != nil {
+			return nil, err
+		}
+		appended[i] = appendedNote{position, newNotes[i]}
+		if epoch != 0 {
+			epochKey, err := stub.CreateCompositeKey(noteEpochObjectType, []string{strconv.FormatUint(position, 10)})
+			if err != nil {
+				return nil, fmt.Errorf("failed to create the composite key: %v", err)
+			}
+			err = stub.PutState(epochKey, []byte(strconv.FormatUint(epoch, 10)))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	frontierJSON, err = json.Marshal(frontier)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal: %v", err)
+	}
+	err = stub.PutState(noteTreeKey, frontierJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	rootKey, err := stub.CreateCompositeKey(noteRootObjectType, []string{frontier.Root.String()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key: %v", err)
+	}
+	err = stub.PutState(rootKey, []byte(stub.GetTxID()))
+	if err != nil {
+		return nil, err
+	}
+	return appended, nil
+}
+
+// validateNote rejects notes with a degenerate owner key or value commitment
+func validateNote(note *notes.Note) error {
+	err := validatePoints(&note.Owner)
+	if err != nil {
+		return fmt.Errorf("invalid note owner: %w", err)
+	}
+	return validateCommitments(&note.Value)
+}
@@ -0,0 +1,205 @@
+package chaincode
+
+import (
+	"pedersen-commitment-transfer/lib/tests/testsfakes"
+	"pedersen-commitment-transfer/src/equality"
+	"pedersen-commitment-transfer/src/notes"
+	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/rangeproof"
+	"pedersen-commitment-transfer/src/schnorr"
+	"testing"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNoteLifecycle(t *testing.T) {
+	ctx, stub, _, state := newTestContext("alice", "Org2MSP")
+	H, bindingFactor := initTestContract(t, ctx, state)
+	contract := new(SmartContract)
+
+	balance := commitAmount(&H, &bindingFactor, 100)
+	state["alice"] = balance.Bytes()
+
+	// Deposit 60 into a note owned by x
+	var x ristretto.Scalar
+	x.Rand()
+	deposit := notes.Note{Owner: schnorr.PublicKey(&x), Value: commitAmount(&H, &bindingFactor, 60), Rho: []byte("rho-1")}
+	var rLeft ristretto.Scalar
+	balanceProof, err := rangeproof.Prove(&H, testAmount(40), pedersen.NewSecret(rLeft.SetZero()))
+	assert.NoError(t, err)
+
+	amountProof, err := rangeproof.Prove(&H, testAmount(60), pedersen.NewSecret(&bindingFactor))
+	assert.NoError(t, err)
+
+	// The balance cannot cover a note of 160
+	overdraft := notes.Note{Owner: deposit.Owner, Value: commitAmount(&H, &bindingFactor, 160), Rho: []byte("rho-0")}
+	overdraftProof, err := rangeproof.Prove(&H, testAmount(160), pedersen.NewSecret(&bindingFactor))
+	assert.NoError(t, err)
+	_, err = contract.DepositNote(ctx, overdraft, overdraftProof, balanceProof)
+	assert.EqualError(t, err, "depositing note failed: balance range proof not valid")
+	_, err = contract.DepositNote(ctx, deposit, balanceProof, balanceProof)
+	assert.EqualError(t, err, "depositing note failed: amount range proof not valid")
+
+	_, err = contract.DepositNote(ctx, deposit, amountProof, balanceProof)
+	assert.NoError(t, err)
+
+	expectedBalance := pedersen.Sub(&balance, &deposit.Value)
+	aliceBalance := readPoint(t, state, "alice")
+	assert.True(t, aliceBalance.Equals(&expectedBalance))
+
+	// The wallet rebuilds the tree from the events
+	var tree notes.Tree
+	replayNoteEvent(t, stub, 0, &tree)
+	path, _ := tree.Path(0)
+	root := tree.Root()
+
+	// Split it into 45 + 15; the output blinding factors add up to the note's
+	var r1, r2 ristretto.Scalar
+	r1.Rand()
+	r2.Sub(&bindingFactor, &r1)
+	outputs := []notes.Note{
+		{Owner: deposit.Owner, Value: commitAmount(&H, &r1, 45), Rho: []byte("rho-2")},
+		{Owner: deposit.Owner, Value: commitAmount(&H, &r2, 15), Rho: []byte("rho-3")},
+	}
+	proof1, _ := rangeproof.Prove(&H, testAmount(45), pedersen.NewSecret(&r1))
+	proof2, _ := rangeproof.Prove(&H, testAmount(15), pedersen.NewSecret(&r2))
+
+	nullifier := deposit.Nullifier()
+	spend := NoteSpend{
+		Note:        deposit,
+		Position:    0,
+		Path:        path,
+		Root:        root,
+		Outputs:     outputs,
+		RangeProofs: []rangeproof.Proof{proof1, proof2},
+		Signature:   schnorr.Sign(&x, notes.SpendMessage(&nullifier, outputs)),
+	}
+
+	unbalanced := spend
+	unbalanced.Outputs = outputs[:1]
+	unbalanced.RangeProofs = spend.RangeProofs[:1]
+	unbalanced.Signature = schnorr.Sign(&x, notes.SpendMessage(&nullifier, unbalanced.Outputs))
+	_, err = contract.SpendNote(ctx, unbalanced)
+	assert.EqualError(t, err, "outputs do not add up to the spent note")
+
+	var y ristretto.Scalar
+	y.Rand()
+	stolen := spend
+	stolen.Signature = schnorr.Sign(&y, notes.SpendMessage(&nullifier, outputs))
+	_, err = contract.SpendNote(ctx, stolen)
+	assert.EqualError(t, err, "note signature not valid")
+
+	_, err = contract.SpendNote(ctx, spend)
+	assert.NoError(t, err)
+	_, err = contract.SpendNote(ctx, spend)
+	assert.EqualError(t, err, "note already spent")
+
+	// Withdraw the 15 output back into the account
+	replayNoteEvent(t, stub, stub.SetEventCallCount()-1, &tree)
+	path, _ = tree.Path(2)
+	root = tree.Root()
+	withdrawn := outputs[1]
+	withdrawnNullifier := withdrawn.Nullifier()
+	signature := schnorr.Sign(&x, WithdrawMessage(&withdrawnNullifier, "alice"))
+
+	var unknownRoot ristretto.Point
+	unknownRoot.Rand()
+	_, err = contract.WithdrawNote(ctx, withdrawn, 2, path, unknownRoot, signature)
+	assert.EqualError(t, err, "unknown note tree root")
+	_, err = contract.WithdrawNote(ctx, withdrawn, 1, path, root, signature)
+	assert.EqualError(t, err, "note membership proof not valid")
+
+	_, err = contract.WithdrawNote(ctx, withdrawn, 2, path, root, signature)
+	assert.NoError(t, err)
+
+	expectedBalance = pedersen.Add(&expectedBalance, &withdrawn.Value)
+	aliceBalance = readPoint(t, state, "alice")
+	assert.True(t, aliceBalance.Equals(&expectedBalance))
+}
+
+func TestNoteAfterRotation(t *testing.T) {
+	ctx, stub, identity, state := newTestContext("alice", "Org1MSP")
+	H, bindingFactor := initTestContract(t, ctx, state)
+	contract := new(SmartContract)
+
+	balance := commitAmount(&H, &bindingFactor, 100)
+	state["alice"] = balance.Bytes()
+
+	var x ristretto.Scalar
+	x.Rand()
+	deposit := notes.Note{Owner: schnorr.PublicKey(&x), Value: commitAmount(&H, &bindingFactor, 60), Rho: []byte("rho-1")}
+	var rLeft ristretto.Scalar
+	balanceProof, err := rangeproof.Prove(&H, testAmount(40), pedersen.NewSecret(rLeft.SetZero()))
+	assert.NoError(t, err)
+	amountProof, err := rangeproof.Prove(&H, testAmount(60), pedersen.NewSecret(&bindingFactor))
+	assert.NoError(t, err)
+	_, err = contract.DepositNote(ctx, deposit, amountProof, balanceProof)
+	assert.NoError(t, err)
+
+	var tree notes.Tree
+	replayNoteEvent(t, stub, 0, &tree)
+	path, _ := tree.Path(0)
+	root := tree.Root()
+
+	newH, _, _ := generateRandomCommitment(0)
+	_, err = contract.RotatePedersenParams(ctx, newH)
+	assert.NoError(t, err)
+
+	// The note value is committed under the old H, so it can neither be withdrawn nor spent as is
+	identity.GetIDReturns("bob", nil)
+	nullifier := deposit.Nullifier()
+	_, err = contract.WithdrawNote(ctx, deposit, 0, path, root, schnorr.Sign(&x, WithdrawMessage(&nullifier, "bob")))
+	assert.EqualError(t, err, "note at position 0 is in epoch 0, call MigrateNote() to move it to epoch 1")
+	_, err = contract.SpendNote(ctx, NoteSpend{Note: deposit, Position: 0, Path: path, Root: root, Outputs: []notes.Note{deposit}, RangeProofs: []rangeproof.Proof{{}}})
+	assert.EqualError(t, err, "note at position 0 is in epoch 0, call MigrateNote() to move it to epoch 1")
+	assert.Nil(t, state["bob"])
+
+	// The owner moves it to a note committed under the new H
+	var rNew ristretto.Scalar
+	rNew.Rand()
+	output := notes.Note{Owner: deposit.Owner, Value: commitAmount(&newH, &rNew, 60), Rho: []byte("rho-2")}
+	migration := NoteMigration{
+		Note:      deposit,
+		Position:  0,
+		Path:      path,
+		Root:      root,
+		Output:    output,
+		Proof:     equality.Prove(&H, &newH, testAmount(60), pedersen.NewSecret(&bindingFactor), pedersen.NewSecret(&rNew)),
+		Signature: schnorr.Sign(&x, notes.SpendMessage(&nullifier, []notes.Note{output})),
+	}
+	inflated := migration
+	inflated.Output.Value = commitAmount(&newH, &rNew, 61)
+	inflated.Signature = schnorr.Sign(&x, notes.SpendMessage(&nullifier, []notes.Note{inflated.Output}))
+	_, err = contract.MigrateNote(ctx, inflated)
+	assert.EqualError(t, err, "migration proof not valid")
+	_, err = contract.MigrateNote(ctx, migration)
+	assert.NoError(t, err)
+	_, err = contract.MigrateNote(ctx, migration)
+	assert.EqualError(t, err, "note already spent")
+
+	replayNoteEvent(t, stub, stub.SetEventCallCount()-1, &tree)
+	path, _ = tree.Path(1)
+	root = tree.Root()
+	_, err = contract.MigrateNote(ctx, NoteMigration{Note: output, Position: 1, Path: path, Root: root, Output: output, Proof: migration.Proof})
+	assert.EqualError(t, err, "note at position 1 is already in epoch 1")
+
+	outputNullifier := output.Nullifier()
+	_, err = contract.WithdrawNote(ctx, output, 1, path, root, schnorr.Sign(&x, WithdrawMessage(&outputNullifier, "bob")))
+	assert.NoError(t, err)
+	bobBalance := readPoint(t, state, "bob")
+	assert.True(t, bobBalance.Equals(&output.Value))
+	bobEpoch, err := getAccountEpoch(ctx, "bob")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), bobEpoch)
+}
+
+func replayNoteEvent(t *testing.T, stub *testsfakes.FakeTestChaincodeStubInterface, call int, tree *notes.Tree) {
+	var event noteEvent
+	readEvent(t, stub, call, &event)
+	for _, appended := range event.Appended {
+		cm := appended.Note.Commitment()
+		position, _ := tree.Append(&cm)
+		assert.Equal(t, appended.Position, position)
+	}
+}
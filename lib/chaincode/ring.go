@@ -0,0 +1,216 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pedersen-commitment-transfer/src/rangeproof"
+	"pedersen-commitment-transfer/src/ring"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Object types for the composite keys of the ring transfer mode
+const ringAccountObjectType = "ringAccount"
+const keyImageObjectType = "ringKeyImage"
+
+// RingTransferMessage is the message signed by ring transfers to recipient
+// The signature also covers the ring and the pseudo commitment.
+func RingTransferMessage(recipient string) []byte {
+	return append([]byte("RingTransfer"), recipient...)
+}
+
+// ringTransferEvent replaces transferEvent for ring transfers, whose sender is not known
+type ringTransferEvent struct {
+	To       string `json:"to"`
+	RingSize int    `json:"ringSize"`
+	KeyImage string `json:"keyImage"`
+	Message  string `json:"message"`
+}
+
+// RegisterRingAccount moves committedAmount from the client account into a new ring account owned by publicKey
+// Ring accounts are one-time accounts owned by a ristretto public key rather than by a Fabric identity.
+// They are spent as a whole by RingTransfer, which hides which ring account is being spent.
+// amountProof and balanceProof are the debit proofs described in the package documentation.
+func (s *SmartContract) RegisterRingAccount(ctx contractapi.TransactionContextInterface, publicKey ristretto.Point, committedAmount ristretto.Point, amountProof rangeproof.Proof, balanceProof rangeproof.Proof) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = validatePoints(&publicKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid public key: %w", err)
+	}
+	err = validateCommitments(&committedAmount)
+	if err != nil {
+		return "", err
+	}
+
+	accountKey, err := ringAccountKey(ctx, &publicKey)
+	if err != nil {
+		return "", err
+	}
+	existing, err := ctx.GetStub().GetState(accountKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to read ring account from world state: %v", err)
+	}
+	if existing != nil {
+		return "", fmt.Errorf("ring account %s already exists", publicKey)
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+	balance, err := getCommittedBalance(ctx, clientID)
+	if err != nil {
+		return "", err
+	}
+	err = isValidDebit(ctx, "balance", &balance.Commitment, &committedAmount, amountProof, balanceProof)
+	if err != nil {
+		return "", fmt.Errorf("registering ring account failed: %v", err)
+	}
+
+	err = transferHelper(ctx, clientID, accountKey, committedAmount)
+	if err != nil {
+		return "", fmt.Errorf("failed to transfer: %v", err)
+	}
+
+	return ctx.GetStub().GetTxID(), nil
+}
+
+// RingTransfer spends one ring account out of ringKeys without revealing which one
+// The amount is moved into a staged account for recipient under the pseudo commitment, which must commit to the same value.
+// The sender is not known, so the transfer can be approved by recipient but never reclaimed.
+// The signature key image is recorded so that the same ring account cannot be spent twice.
+func (s *SmartContract) RingTransfer(ctx contractapi.TransactionContextInterface, recipient string, ringKeys []ristretto.Point, pseudoCommitment ristretto.Point, signature ring.Signature) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	stub := ctx.GetStub()
+
+	if recipient == "" {
+		return "", errors.New("recipient must not be empty")
+	}
+	err = validateCommitments(&pseudoCommitment)
+	if err != nil {
+		return "", err
+	}
+	err = validatePoints(&signature.KeyImage, &signature.Auxiliary)
+	if err != nil {
+		return "", fmt.Errorf("invalid ring signature: %w", err)
+	}
+
+	members := make([]ring.Member, len(ringKeys))
+	for i := range ringKeys {
+		members[i], err = getRingMember(ctx, &ringKeys[i])
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if !ring.Verify(RingTransferMessage(recipient), members, &pseudoCommitment, signature) {
+		return "", errors.New("ring signature not valid")
+	}
+
+	keyImageKey, err := stub.CreateCompositeKey(keyImageObjectType, []string{signature.KeyImage.String()})
+	if err != nil {
+		return "", fmt.Errorf("failed to create the composite key: %v", err)
+	}
+	spent, err := stub.GetState(keyImageKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to read key image from world state: %v", err)
+	}
+	if spent != nil {
+		return "", errors.New("ring account already spent")
+	}
+
+	TxID := stub.GetTxID()
+	err = stub.PutState(keyImageKey, []byte(TxID))
+	if err != nil {
+		return "", err
+	}
+
+	stagedAccount := temporaryAccountAddressPrefix + "_" + TxID
+	_, _, err = addToBalance(ctx, stagedAccount, &pseudoCommitment)
+	if err != nil {
+		return "", fmt.Errorf("failed to transfer: %v", err)
+	}
+
+	// The sender is not known, only the key image is
+	transferEvent := ringTransferEvent{stagedAccount, len(members), signature.KeyImage.String(), "Money sent from ring"}
+	transferEventJSON, err := json.Marshal(transferEvent)
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = stub.SetEvent("RingTransfer", transferEventJSON)
+	if err != nil {
+		return "", fmt.Errorf("failed to set event: %v", err)
+	}
+
+	timelock, err := resolveTimelock(ctx, 0)
+	if err != nil {
+		return "", err
+	}
+	err = storeTxInfo(stub, "", recipient, pseudoCommitment, timelock)
+	if err != nil {
+		return "", fmt.Errorf("failed to store transaction info: %v", err)
+	}
+
+	return TxID, nil
+}
+
+func ringAccountKey(ctx contractapi.TransactionContextInterface, publicKey *ristretto.Point) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(ringAccountObjectType, []string{publicKey.String()})
+	if err != nil {
+		return "", fmt.Errorf("failed to create the composite key: %v", err)
+	}
+	return key, nil
+}
+
+func getRingMember(ctx contractapi.TransactionContextInterface, publicKey *ristretto.Point) (ring.Member, error) {
+	accountKey, err := ringAccountKey(ctx, publicKey)
+	if err != nil {
+		return ring.Member{}, err
+	}
+	balanceBytes, err := ctx.GetStub().GetState(accountKey)
+	if err != nil {
+		return ring.Member{}, fmt.Errorf("failed to read ring account from world state: %v", err)
+	}
+	if balanceBytes == nil {
+		return ring.Member{}, fmt.Errorf("ring account %s does not exist", publicKey)
+	}
+	// Members committed under retired parameters cannot be mixed with the current ones
+	epoch, err := getPedersenEpoch(ctx)
+	if err != nil {
+		return ring.Member{}, err
+	}
+	accountEpoch, err := getAccountEpoch(ctx, accountKey)
+	if err != nil {
+		return ring.Member{}, err
+	}
+	if accountEpoch != epoch {
+		return ring.Member{}, fmt.Errorf("ring account %s is in epoch %d, not in the current epoch %d", publicKey, accountEpoch, epoch)
+	}
+
+	member := ring.Member{PublicKey: *publicKey}
+	err = member.Commitment.UnmarshalBinary(balanceBytes)
+	if err != nil {
+		return ring.Member{}, fmt.Errorf("error unmarshalling")
+	}
+	return member, nil
+}
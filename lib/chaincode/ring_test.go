@@ -0,0 +1,133 @@
+package chaincode
+
+import (
+	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/rangeproof"
+	"pedersen-commitment-transfer/src/ring"
+	"testing"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterRingAccount(t *testing.T) {
+	ctx, stub, _, state := newTestContext("alice", "Org1MSP")
+	H, bindingFactor := initTestContract(t, ctx, state)
+
+	balance := commitAmount(&H, &bindingFactor, 100)
+	state["alice"] = balance.Bytes()
+
+	var x ristretto.Scalar
+	var publicKey ristretto.Point
+	x.Rand()
+	publicKey.ScalarMultBase(&x)
+	var rAmount, rLeft ristretto.Scalar
+	rAmount.Rand()
+	rLeft.Sub(&bindingFactor, &rAmount)
+	committedAmount := commitAmount(&H, &rAmount, 40)
+	amountProof, err := rangeproof.Prove(&H, testAmount(40), pedersen.NewSecret(&rAmount))
+	assert.NoError(t, err)
+	balanceProof, err := rangeproof.Prove(&H, testAmount(60), pedersen.NewSecret(&rLeft))
+	assert.NoError(t, err)
+
+	// Alice cannot fund a ring account with more than she has
+	overdraft := commitAmount(&H, &rAmount, 140)
+	overdraftProof, err := rangeproof.Prove(&H, testAmount(140), pedersen.NewSecret(&rAmount))
+	assert.NoError(t, err)
+	_, err = new(SmartContract).RegisterRingAccount(ctx, publicKey, overdraft, overdraftProof, balanceProof)
+	assert.EqualError(t, err, "registering ring account failed: balance range proof not valid")
+
+	// nor with a negative amount, which would raise her balance
+	_, err = new(SmartContract).RegisterRingAccount(ctx, publicKey, committedAmount, balanceProof, balanceProof)
+	assert.EqualError(t, err, "registering ring account failed: amount range proof not valid")
+
+	_, err = new(SmartContract).RegisterRingAccount(ctx, publicKey, committedAmount, amountProof, balanceProof)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, stub.GetTransientCallCount(), "No transient data is needed")
+
+	accountKey, _ := ringAccountKey(ctx, &publicKey)
+	accountBalance := readPoint(t, state, accountKey)
+	assert.True(t, accountBalance.Equals(&committedAmount))
+
+	expectedBalance := pedersen.Sub(&balance, &committedAmount)
+	aliceBalance := readPoint(t, state, "alice")
+	assert.True(t, aliceBalance.Equals(&expectedBalance))
+
+	_, err = new(SmartContract).RegisterRingAccount(ctx, publicKey, committedAmount, amountProof, balanceProof)
+	assert.EqualError(t, err, "ring account "+publicKey.String()+" already exists")
+
+	var identity ristretto.Point
+	identity.SetZero()
+	_, err = new(SmartContract).RegisterRingAccount(ctx, identity, committedAmount, amountProof, balanceProof)
+	assert.ErrorIs(t, err, pedersen.ErrIdentityPoint, "Identity public key")
+	_, err = new(SmartContract).RegisterRingAccount(ctx, publicKey, identity, amountProof, balanceProof)
+	assert.ErrorIs(t, err, pedersen.ErrIdentityPoint, "Identity commitment")
+}
+
+func TestRingTransfer(t *testing.T) {
+	ctx, stub, _, state := newTestContext("bob", "Org2MSP")
+	H, _ := initTestContract(t, ctx, state)
+
+	// Three ring accounts, the second one is ours
+	const signer = 1
+	var x, r, z, rPseudo ristretto.Scalar
+	keys := make([]ristretto.Point, 3)
+	for i := range keys {
+		var key, blinding ristretto.Scalar
+		key.Rand()
+		blinding.Rand()
+		if i == signer {
+			x, r = key, blinding
+		}
+		keys[i].ScalarMultBase(&key)
+		accountKey, _ := ringAccountKey(ctx, &keys[i])
+		commitment := commitAmount(&H, &blinding, 25)
+		state[accountKey] = commitment.Bytes()
+	}
+
+	rPseudo.Rand()
+	z.Sub(&r, &rPseudo)
+	pseudoCommitment := commitAmount(&H, &rPseudo, 25)
+
+	members := make([]ring.Member, len(keys))
+	for i := range keys {
+		members[i], _ = getRingMember(ctx, &keys[i])
+	}
+	signature, err := ring.Sign(RingTransferMessage("carol"), members, &pseudoCommitment, signer, &x, &z)
+	assert.NoError(t, err)
+
+	// The signature is bound to the recipient
+	_, err = new(SmartContract).RingTransfer(ctx, "mallory", keys, pseudoCommitment, signature)
+	assert.EqualError(t, err, "ring signature not valid")
+
+	txID, err := new(SmartContract).RingTransfer(ctx, "carol", keys, pseudoCommitment, signature)
+	assert.NoError(t, err)
+
+	staged := readPoint(t, state, temporaryAccountAddressPrefix+"_"+txID)
+	assert.True(t, staged.Equals(&pseudoCommitment))
+
+	var event ringTransferEvent
+	assert.Equal(t, "RingTransfer", readEvent(t, stub, 0, &event))
+	assert.Equal(t, 3, event.RingSize)
+	assert.Equal(t, signature.KeyImage.String(), event.KeyImage)
+
+	// The key image is now spent, even in another ring
+	_, err = new(SmartContract).RingTransfer(ctx, "carol", keys, pseudoCommitment, signature)
+	assert.EqualError(t, err, "ring account already spent")
+
+	// Unknown ring members are rejected
+	var unknown ristretto.Point
+	unknown.Rand()
+	_, err = new(SmartContract).RingTransfer(ctx, "carol", append(keys, unknown), pseudoCommitment, signature)
+	assert.EqualError(t, err, "ring account "+unknown.String()+" does not exist")
+
+	// A pseudo commitment to another amount does not verify
+	inflated := commitAmount(&H, &rPseudo, 26)
+	_, err = new(SmartContract).RingTransfer(ctx, "carol", keys, inflated, signature)
+	assert.EqualError(t, err, "ring signature not valid")
+
+	// After a parameter rotation the ring accounts are committed under the retired H
+	state[pedersenEpochKey] = []byte("1")
+	_, err = new(SmartContract).RingTransfer(ctx, "carol", keys, pseudoCommitment, signature)
+	assert.EqualError(t, err, "ring account "+keys[0].String()+" is in epoch 0, not in the current epoch 1")
+}
@@ -0,0 +1,109 @@
+package chaincode
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// TransferStatus is the state of a pending transfer
+type TransferStatus string
+
+// Status of a pending transfer
+const (
+	TransferPending   TransferStatus = "pending"
+	TransferApproved  TransferStatus = "approved"
+	TransferRejected  TransferStatus = "rejected"
+	TransferReclaimed TransferStatus = "reclaimed"
+	TransferExpired   TransferStatus = "expired"
+)
+
+// Allowed transitions; approved, rejected and reclaimed transfers are final
+var transferTransitions = map[TransferStatus][]TransferStatus{
+	TransferPending: {TransferApproved, TransferRejected, TransferExpired},
+	TransferExpired: {TransferReclaimed},
+}
+
+// StatusChange records when a pending transfer entered Status, in seconds since the Unix epoch
+type StatusChange struct {
+	Status    TransferStatus `json:"status"`
+	Timestamp int64          `json:"timestamp"`
+}
+
+// TransitionError is returned when a pending transfer cannot move to the requested status
+type TransitionError struct {
+	TxID string
+	From TransferStatus
+	To   TransferStatus
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("transfer %s cannot go from %s to %s", e.TxID, e.From, e.To)
+}
+
+// GetTransferStatus returns a pending transfer with its current status and the history of its transitions
+// Past its deadline a pending transfer is reported expired, although the stored record stays pending until it is reclaimed.
+func (s *SmartContract) GetTransferStatus(ctx contractapi.TransactionContextInterface, txID string) (*TxInformation, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return nil, fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	txInfo, err := getTxInfo(ctx.GetStub(), txID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction info: %v", err)
+	}
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	expireIfDue(&txInfo, txTimestamp.GetSeconds())
+	return &txInfo, nil
+}
+
+// expireIfDue marks a pending transfer expired once its deadline at now has passed
+// Nothing is stored when the deadline passes, so reads derive the expiry and Approve or Reject
+// of an expired transfer fail on it. Reclaim stores it with expireTransfer.
+func expireIfDue(txInfo *TxInformation, now int64) bool {
+	if txInfo.Status == TransferPending && now >= txInfo.Deadline {
+		txInfo.Status = TransferExpired
+		txInfo.History = append(txInfo.History, StatusChange{Status: TransferExpired, Timestamp: txInfo.Deadline})
+		return true
+	}
+	return false
+}
+
+// expireTransfer stores the pending to expired transition of TxId once its deadline at now has passed
+// The expiry is timestamped at the deadline.
+func expireTransfer(stub shim.ChaincodeStubInterface, TxId string, txInfo *TxInformation, now int64) error {
+	if !expireIfDue(txInfo, now) {
+		return nil
+	}
+	return putTxInfo(stub, TxId, txInfo)
+}
+
+// setTransferStatus moves the pending transfer TxId to status and stores it
+// It fails with a *TransitionError if the current status does not allow it.
+func setTransferStatus(stub shim.ChaincodeStubInterface, TxId string, txInfo *TxInformation, status TransferStatus) error {
+	allowed := false
+	for _, next := range transferTransitions[txInfo.Status] {
+		allowed = allowed || next == status
+	}
+	if !allowed {
+		return &TransitionError{TxID: TxId, From: txInfo.Status, To: status}
+	}
+
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get the transaction timestamp: %v", err)
+	}
+	txInfo.Status = status
+	txInfo.History = append(txInfo.History, StatusChange{Status: status, Timestamp: txTimestamp.GetSeconds()})
+	return putTxInfo(stub, TxId, txInfo)
+}
@@ -0,0 +1,125 @@
+package chaincode
+
+import (
+	"pedersen-commitment-transfer/src/pedersen"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransferStatus(t *testing.T) {
+	ctx, stub, identity, state := newTestContext("bob", "Org2MSP")
+	H, bindingFactor := initTestContract(t, ctx, state)
+	committedAmount := commitAmount(&H, &bindingFactor, 30)
+	contract := new(SmartContract)
+
+	const created = 123456789
+	state[temporaryAccountAddressPrefix+"_TxidTest"] = committedAmount.Bytes()
+	assert.NoError(t, storeTxInfo(stub, "alice", "bob", committedAmount, 3600))
+
+	txInfo, err := contract.GetTransferStatus(ctx, "TxidTest")
+	assert.NoError(t, err)
+	assert.Equal(t, TransferPending, txInfo.Status)
+
+	// The recipient approves before the deadline, only once
+	stub.GetTxTimestampReturns(&timestamp.Timestamp{Seconds: created + 3599}, nil)
+	_, err = contract.Approve(ctx, "TxidTest")
+	assert.NoError(t, err)
+	_, err = contract.Approve(ctx, "TxidTest")
+	var transitionErr *TransitionError
+	assert.ErrorAs(t, err, &transitionErr)
+	assert.Equal(t, TransitionError{TxID: "TxidTest", From: TransferApproved, To: TransferApproved}, *transitionErr)
+
+	bobBalance := readPoint(t, state, "bob")
+	assert.True(t, bobBalance.Equals(&committedAmount), "Approved once")
+
+	txInfo, err = contract.GetTransferStatus(ctx, "TxidTest")
+	assert.NoError(t, err)
+	assert.Equal(t, TransferApproved, txInfo.Status)
+	assert.Equal(t, []StatusChange{{TransferPending, created}, {TransferApproved, created + 3599}}, txInfo.History)
+
+	_, err = contract.Reject(ctx, "TxidTest")
+	assert.EqualError(t, err, "transfer TxidTest cannot go from approved to rejected")
+	identity.GetIDReturns("alice", nil)
+
+	// The second transfer expires at its deadline and the sender reclaims it
+	stub.GetTxIDReturns("TxidTest2")
+	stub.GetTxTimestampReturns(&timestamp.Timestamp{Seconds: created}, nil)
+	state[temporaryAccountAddressPrefix+"_TxidTest2"] = committedAmount.Bytes()
+	assert.NoError(t, storeTxInfo(stub, "alice", "bob", committedAmount, 3600))
+
+	_, err = contract.Reclaim(ctx, "TxidTest2")
+	assert.EqualError(t, err, "transfer TxidTest2 can only be reclaimed from "+formatDeadline(created+3600))
+
+	stub.GetTxTimestampReturns(&timestamp.Timestamp{Seconds: created + 3600}, nil)
+	txInfo, err = contract.GetTransferStatus(ctx, "TxidTest2")
+	assert.NoError(t, err)
+	assert.Equal(t, TransferExpired, txInfo.Status)
+
+	// The expiry is derived on read, the stored record is still pending
+	stored, err := getTxInfo(stub, "TxidTest2")
+	assert.NoError(t, err)
+	assert.Equal(t, TransferPending, stored.Status)
+	assert.Equal(t, []StatusChange{{TransferPending, created}}, stored.History)
+
+	identity.GetIDReturns("bob", nil)
+	_, err = contract.Approve(ctx, "TxidTest2")
+	assert.EqualError(t, err, "transfer TxidTest2 cannot go from expired to approved")
+	_, err = contract.Reject(ctx, "TxidTest2")
+	assert.EqualError(t, err, "transfer TxidTest2 cannot go from expired to rejected")
+
+	identity.GetIDReturns("alice", nil)
+	stub.GetTxTimestampReturns(&timestamp.Timestamp{Seconds: created + 4000}, nil)
+	_, err = contract.Reclaim(ctx, "TxidTest2")
+	assert.NoError(t, err)
+	aliceBalance := readPoint(t, state, "alice")
+	assert.True(t, aliceBalance.Equals(&committedAmount))
+
+	// Reclaiming stores the expiry, at the deadline, before the reclaim
+	stored, err = getTxInfo(stub, "TxidTest2")
+	assert.NoError(t, err)
+	assert.Equal(t, TransferReclaimed, stored.Status)
+	assert.Equal(t, []StatusChange{{TransferPending, created}, {TransferExpired, created + 3600}, {TransferReclaimed, created + 4000}}, stored.History)
+
+	var event reclaimEvent
+	assert.Equal(t, "Reclaim", readEvent(t, stub, stub.SetEventCallCount()-1, &event))
+	assert.Equal(t, reclaimEvent{"TxidTest2", temporaryAccountAddressPrefix + "_TxidTest2", "alice", "Contract reclaimed!"}, event)
+
+	_, err = contract.Reclaim(ctx, "TxidTest2")
+	assert.EqualError(t, err, "transfer TxidTest2 cannot go from reclaimed to reclaimed")
+
+	// The recipient sends the third one back
+	stub.GetTxIDReturns("TxidTest3")
+	stub.GetTxTimestampReturns(&timestamp.Timestamp{Seconds: created}, nil)
+	state[temporaryAccountAddressPrefix+"_TxidTest3"] = committedAmount.Bytes()
+	assert.NoError(t, storeTxInfo(stub, "alice", "bob", committedAmount, 3600))
+
+	identity.GetIDReturns("bob", nil)
+	_, err = contract.Reject(ctx, "TxidTest3")
+	assert.NoError(t, err)
+	expectedBalance := pedersen.Add(&committedAmount, &committedAmount)
+	aliceBalance = readPoint(t, state, "alice")
+	assert.True(t, aliceBalance.Equals(&expectedBalance))
+
+	txInfo, err = contract.GetTransferStatus(ctx, "TxidTest3")
+	assert.NoError(t, err)
+	assert.Equal(t, TransferRejected, txInfo.Status)
+
+	// The expiry is only stored once the deadline has passed, and only once
+	stub.GetTxIDReturns("TxidTest4")
+	assert.NoError(t, storeTxInfo(stub, "alice", "bob", committedAmount, 3600))
+	stored, err = getTxInfo(stub, "TxidTest4")
+	assert.NoError(t, err)
+	assert.NoError(t, expireTransfer(stub, "TxidTest4", &stored, created+3599))
+	assert.Equal(t, TransferPending, stored.Status)
+	assert.NoError(t, expireTransfer(stub, "TxidTest4", &stored, created+3700))
+	assert.NoError(t, expireTransfer(stub, "TxidTest4", &stored, created+3800))
+	stored, err = getTxInfo(stub, "TxidTest4")
+	assert.NoError(t, err)
+	assert.Equal(t, TransferExpired, stored.Status)
+	assert.Equal(t, []StatusChange{{TransferPending, created}, {TransferExpired, created + 3600}}, stored.History)
+
+	_, err = contract.GetTransferStatus(ctx, "unknown")
+	assert.EqualError(t, err, "failed to get transaction info: transaction unknown not found")
+}
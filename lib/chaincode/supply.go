@@ -0,0 +1,373 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/rangeproof"
+	"pedersen-commitment-transfer/src/sumproof"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Key of the commitment to the total supply once it is confidential
+const supplyCommitmentKey = "supplyCommitment"
+
+// Object type for the composite keys of disclosed supply bounds
+const supplyBoundObjectType = "supplyBound"
+
+// Transient key of the blinding factor of burned amounts in confidential supply mode
+const amountBlindingKey = "amountBlinding"
+
+// Implicit private data collection of the issuer, where the openings of burned amounts are kept
+const issuerCollection = "_implicit_org_Org1MSP"
+
+// BurnOpening is the opening of an amount burned in confidential supply mode
+// It is stored in the private data collection of the issuer under the ID of the burn transaction.
+// Units is the amount in base units, as a decimal number.
+type BurnOpening struct {
+	Units    string           `json:"units"`
+	Blinding ristretto.Scalar `json:"blinding"`
+}
+
+// SupplyBound is a public upper bound on the total supply
+// Commitment is the commitment to the supply when the bound was disclosed.
+type SupplyBound struct {
+	Commitment  ristretto.Point `json:"commitment"`
+	Bound       string          `json:"bound"`
+	DisclosedBy string          `json:"disclosedBy"`
+}
+
+// EnableConfidentialSupply replaces the plaintext total supply with committedSupply, a commitment to it
+// The proof shows that committedSupply hides the current total supply, as for DiscloseTotal. From then on
+// mints and burns update the commitment and the issuer keeps its opening: the blinding factors of its own
+// mints and the openings of burned amounts. Burners pass the blinding factor under "amountBlinding" in the
+// transient map, and the amount and blinding factor are stored as a BurnOpening in the private data
+// collection of the issuer.
+// The issuer discloses the supply with DiscloseTotal on the supplyCommitment key, or an upper bound on
+// it with DiscloseSupplyBound. Once the pedersen parameters are rotated, the issuer moves the commitment
+// to the new ones with MigrateAccount on the supplyCommitment key before mints and burns resume.
+// This function triggers a SupplyCommitted event
+func (s *SmartContract) EnableConfidentialSupply(ctx contractapi.TransactionContextInterface, committedSupply ristretto.Point, proof sumproof.Proof) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	// Check issuer authorization - this sample assumes Org1 is the central banker
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get MSPID: %v", err)
+	}
+	if clientMSPID != "Org1MSP" {
+		return "", fmt.Errorf("client is not authorized to change the total supply mode")
+	}
+
+	confidential, err := isSupplyConfidential(ctx)
+	if err != nil {
+		return "", err
+	}
+	if confidential {
+		return "", errors.New("total supply is already confidential")
+	}
+	err = validateCommitments(&committedSupply)
+	if err != nil {
+		return "", err
+	}
+	err = validatePoints(&proof.R)
+	if err != nil {
+		return "", fmt.Errorf("invalid sum proof: %w", err)
+	}
+
+	units, err := s.TotalSupply(ctx)
+	if err != nil {
+		return "", err
+	}
+	denomination, err := getDenomination(ctx)
+	if err != nil {
+		return "", err
+	}
+	denomination.Bits = pedersen.MaxAmountBits
+	supply, err := denomination.FromUnits(big.NewInt(int64(units)))
+	if err != nil {
+		return "", err
+	}
+	H, err := GetPedersenParams(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch pedersen encryption parameters: %v", err)
+	}
+	if !sumproof.Verify(H, []ristretto.Point{committedSupply}, supply, proof) {
+		return "", errors.New("supply proof not valid")
+	}
+
+	stub := ctx.GetStub()
+	err = stub.PutState(supplyCommitmentKey, committedSupply.Bytes())
+	if err != nil {
+		return "", fmt.Errorf("failed to set the supply commitment: %v", err)
+	}
+	epoch, err := getPedersenEpoch(ctx)
+	if err != nil {
+		return "", err
+	}
+	if epoch != 0 {
+		err = setAccountEpoch(ctx, supplyCommitmentKey, epoch)
+		if err != nil {
+			return "", err
+		}
+	}
+	err = stub.DelState(totalSupplyKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to delete the total supply: %v", err)
+	}
+
+	err = stub.SetEvent("SupplyCommitted", committedSupply.Bytes())
+	if err != nil {
+		return "", fmt.Errorf("failed to set event: %v", err)
+	}
+	return stub.GetTxID(), nil
+}
+
+// SupplyCommitment returns the commitment to the total supply in confidential supply mode
+func (s *SmartContract) SupplyCommitment(ctx contractapi.TransactionContextInterface) (*ristretto.Point, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return nil, fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	supply, err := getSupplyCommitment(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &supply, nil
+}
+
+// DiscloseSupplyBound records that the total supply is at most bound, a decimal amount in display units
+// The proof is a range proof on bound H minus the supply commitment, which only the issuer can open.
+// This function triggers a SupplyBoundDisclosed event
+func (s *SmartContract) DiscloseSupplyBound(ctx contractapi.TransactionContextInterface, bound string, proof rangeproof.Proof) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	supply, err := getSupplyCommitment(ctx)
+	if err != nil {
+		return "", err
+	}
+	err = checkAccountEpoch(ctx, supplyCommitmentKey)
+	if err != nil {
+		return "", err
+	}
+	denomination, err := getDenomination(ctx)
+	if err != nil {
+		return "", err
+	}
+	// The supply may not fit in the width of a single amount
+	denomination.Bits = pedersen.MaxAmountBits
+	boundAmount, err := denomination.Parse(bound)
+	if err != nil {
+		return "", err
+	}
+
+	H, err := GetPedersenParams(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch pedersen encryption parameters: %v", err)
+	}
+	committedBound := pedersen.CommitTo(H, pedersen.NewSecretFromUint64(0), boundAmount)
+	headroom := pedersen.Sub(&committedBound, &supply)
+	if !rangeproof.Verify(H, &headroom, pedersen.MaxAmountBits, proof) {
+		return "", errors.New("supply bound range proof not valid")
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+	record := SupplyBound{Commitment: supply, Bound: boundAmount.String(), DisclosedBy: clientID}
+	recordJSON, err := json.Marshal(&record)
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	stub := ctx.GetStub()
+	TxID := stub.GetTxID()
+	recordKey, err := stub.CreateCompositeKey(supplyBoundObjectType, []string{TxID})
+	if err != nil {
+		return "", fmt.Errorf("failed to create the composite key: %v", err)
+	}
+	err = stub.PutState(recordKey, recordJSON)
+	if err != nil {
+		return "", fmt.Errorf("failed to put to world state. %v", err)
+	}
+
+	err = stub.SetEvent("SupplyBoundDisclosed", recordJSON)
+	if err != nil {
+		return "", fmt.Errorf("failed to set event: %v", err)
+	}
+	return TxID, nil
+}
+
+// GetSupplyBound returns the supply bound disclosed in transaction TxId
+func (s *SmartContract) GetSupplyBound(ctx contractapi.TransactionContextInterface, TxId string) (*SupplyBound, error) {
+	stub := ctx.GetStub()
+	recordKey, err := stub.CreateCompositeKey(supplyBoundObjectType, []string{TxId})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key: %v", err)
+	}
+	recordJSON, err := stub.GetState(recordKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read supply bound from world state: %v", err)
+	}
+	if recordJSON == nil {
+		return nil, fmt.Errorf("no supply bound disclosed in transaction %s", TxId)
+	}
+	var record SupplyBound
+	err = json.Unmarshal(recordJSON, &record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal: %v", err)
+	}
+	return &record, nil
+}
+
+func isSupplyConfidential(ctx contractapi.TransactionContextInterface) (bool, error) {
+	supplyBytes, err := ctx.GetStub().GetState(supplyCommitmentKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to read the supply commitment from world state: %v", err)
+	}
+	return supplyBytes != nil, nil
+}
+
+func getSupplyCommitment(ctx contractapi.TransactionContextInterface) (ristretto.Point, error) {
+	supplyBytes, err := ctx.GetStub().GetState(supplyCommitmentKey)
+	if err != nil {
+		return ristretto.Point{}, fmt.Errorf("failed to read the supply commitment from world state: %v", err)
+	}
+	if supplyBytes == nil {
+		return ristretto.Point{}, errors.New("total supply is public, call TotalSupply()")
+	}
+	supply, err := pedersen.DecodePoint(supplyBytes)
+	if err != nil {
+		return ristretto.Point{}, fmt.Errorf("failed to decode the supply commitment: %v", err)
+	}
+	return supply, nil
+}
+
+// addToSupply adds amount, committed to by committedAmount, to the total supply
+// The plaintext supply is updated unless the supply is confidential.
+func addToSupply(ctx contractapi.TransactionContextInterface, amount pedersen.Amount, committedAmount *ristretto.Point) error {
+	confidential, err := isSupplyConfidential(ctx)
+	if err != nil {
+		return err
+	}
+	if !confidential {
+		units, err := supplyUnits(amount)
+		if err != nil {
+			return err
+		}
+		return updateTotalSupply(ctx, units)
+	}
+	err = checkAccountEpoch(ctx, supplyCommitmentKey)
+	if err != nil {
+		return err
+	}
+	supply, err := getSupplyCommitment(ctx)
+	if err != nil {
+		return err
+	}
+	supply = pedersen.Add(&supply, committedAmount)
+	return putSupplyCommitment(ctx, &supply)
+}
+
+// removeFromSupply takes amount, committed to by committedAmount, out of the total supply
+// When the supply is confidential the blinding factor of committedAmount is read from the transient
+// map and the opening is stored for the issuer, which needs it to keep opening the supply commitment.
+func removeFromSupply(ctx contractapi.TransactionContextInterface, amount pedersen.Amount, committedAmount *ristretto.Point) error {
+	confidential, err := isSupplyConfidential(ctx)
+	if err != nil {
+		return err
+	}
+	if !confidential {
+		units, err := supplyUnits(amount)
+		if err != nil {
+			return err
+		}
+		return updateTotalSupply(ctx, -units)
+	}
+	err = checkAccountEpoch(ctx, supplyCommitmentKey)
+	if err != nil {
+		return err
+	}
+
+	blinding, err := getTransientBlinding(ctx, amountBlindingKey)
+	if err != nil {
+		return err
+	}
+	H, err := GetPedersenParams(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch pedersen encryption parameters: %v", err)
+	}
+	expected := pedersen.CommitTo(H, pedersen.NewSecret(&blinding), amount)
+	if !expected.Equals(committedAmount) {
+		return errors.New("amount blinding factor does not open the committed amount")
+	}
+	openingJSON, err := json.Marshal(&BurnOpening{Units: amount.Units().String(), Blinding: blinding})
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	stub := ctx.GetStub()
+	err = stub.PutPrivateData(issuerCollection, stub.GetTxID(), openingJSON)
+	if err != nil {
+		return fmt.Errorf("failed to store the burn opening: %v", err)
+	}
+
+	supply, err := getSupplyCommitment(ctx)
+	if err != nil {
+		return err
+	}
+	supply = pedersen.Sub(&supply, committedAmount)
+	return putSupplyCommitment(ctx, &supply)
+}
+
+func putSupplyCommitment(ctx contractapi.TransactionContextInterface, supply *ristretto.Point) error {
+	err := ctx.GetStub().PutState(supplyCommitmentKey, supply.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to update the supply commitment: %v", err)
+	}
+	return nil
+}
+
+// getTransientBlinding reads a 32 byte blinding factor from the transient map
+func getTransientBlinding(ctx contractapi.TransactionContextInterface, key string) (ristretto.Scalar, error) {
+	tr, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return ristretto.Scalar{}, fmt.Errorf("failed to get Transient field: %v", err)
+	}
+	value, ok := tr[key]
+	if !ok {
+		return ristretto.Scalar{}, fmt.Errorf("key %s not found", key)
+	}
+	var blinding ristretto.Scalar
+	err = blinding.UnmarshalBinary(value)
+	if err != nil {
+		return ristretto.Scalar{}, fmt.Errorf("failed to unmarshal %s: %v", key, err)
+	}
+	return blinding, nil
+}
@@ -0,0 +1,179 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"math/big"
+	"pedersen-commitment-transfer/src/equality"
+	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/rangeproof"
+	"pedersen-commitment-transfer/src/sumproof"
+	"testing"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/stretchr/testify/assert"
+)
+
+// supplyAmount returns an amount as wide as the total supply
+func supplyAmount(units int64) pedersen.Amount {
+	amount, err := pedersen.Denomination{Decimals: 2, Bits: pedersen.MaxAmountBits}.FromUnits(big.NewInt(units))
+	if err != nil {
+		panic(err)
+	}
+	return amount
+}
+
+func TestConfidentialSupply(t *testing.T) {
+	ctx, stub, identity, state := newTestContext("issuer", "Org1MSP")
+	H, _ := initTestContract(t, ctx, state)
+	contract := new(SmartContract)
+	state[totalSupplyKey] = []byte("500")
+
+	var rSupply ristretto.Scalar
+	rSupply.Rand()
+	committedSupply := pedersen.CommitTo(&H, pedersen.NewSecret(&rSupply), supplyAmount(500))
+	supplyProof, err := sumproof.Prove(&H, []ristretto.Point{committedSupply}, supplyAmount(500), pedersen.NewSecret(&rSupply))
+	assert.NoError(t, err)
+
+	// The commitment must hide the current supply
+	wrongSupply := pedersen.CommitTo(&H, pedersen.NewSecret(&rSupply), supplyAmount(400))
+	_, err = contract.EnableConfidentialSupply(ctx, wrongSupply, supplyProof)
+	assert.EqualError(t, err, "supply proof not valid")
+
+	_, err = contract.EnableConfidentialSupply(ctx, committedSupply, supplyProof)
+	assert.NoError(t, err)
+	assert.Nil(t, state[totalSupplyKey])
+	_, err = contract.TotalSupply(ctx)
+	assert.EqualError(t, err, "total supply is confidential, call SupplyCommitment()")
+	_, err = contract.EnableConfidentialSupply(ctx, committedSupply, supplyProof)
+	assert.EqualError(t, err, "total supply is already confidential")
+
+	// Mint 100
+	var rMint ristretto.Scalar
+	rMint.Rand()
+	minted := commitAmount(&H, &rMint, 100)
+	stub.GetTransientReturns(transientOpening(&H, &rMint, 100), nil)
+	_, err = contract.Mint(ctx, minted)
+	assert.NoError(t, err)
+	assert.Nil(t, state[totalSupplyKey])
+
+	// Alice burns 30 of them and hands the issuer her blinding factor
+	identity.GetIDReturns("alice", nil)
+	identity.GetMSPIDReturns("Org2MSP", nil)
+	state["alice"] = minted.Bytes()
+	var rBurn, rLeft ristretto.Scalar
+	rBurn.Rand()
+	rLeft.Sub(&rMint, &rBurn)
+	burned := commitAmount(&H, &rBurn, 30)
+	balanceProof, err := rangeproof.Prove(&H, testAmount(70), pedersen.NewSecret(&rLeft))
+	assert.NoError(t, err)
+
+	transient := transientOpening(&H, &rBurn, 30)
+	stub.GetTransientReturns(transient, nil)
+	_, err = contract.Burn(ctx, burned, balanceProof)
+	assert.EqualError(t, err, "burning failed: key amountBlinding not found")
+	transient[amountBlindingKey] = rMint.Bytes()
+	_, err = contract.Burn(ctx, burned, balanceProof)
+	assert.EqualError(t, err, "burning failed: amount blinding factor does not open the committed amount")
+
+	transient[amountBlindingKey] = rBurn.Bytes()
+	_, err = contract.Burn(ctx, burned, balanceProof)
+	assert.NoError(t, err)
+	collection, key, value := stub.PutPrivateDataArgsForCall(0)
+	assert.Equal(t, issuerCollection, collection)
+	assert.Equal(t, "TxidTest", key)
+	var opening BurnOpening
+	assert.NoError(t, json.Unmarshal(value, &opening))
+	assert.Equal(t, "30", opening.Units)
+
+	// The issuer re-opens the supply from its own openings and the stored burn opening alone
+	burnedUnits, ok := new(big.Int).SetString(opening.Units, 10)
+	assert.True(t, ok)
+	var rTotal ristretto.Scalar
+	rTotal.Add(&rSupply, &rMint)
+	rTotal.Sub(&rTotal, &opening.Blinding)
+	totalUnits := new(big.Int).Sub(big.NewInt(500+100), burnedUnits)
+	supply, err := contract.SupplyCommitment(ctx)
+	assert.NoError(t, err)
+	assert.True(t, pedersen.Validate(supplyAmount(totalUnits.Int64()), *supply, H, pedersen.NewSecret(&rTotal)))
+	expectedSupply := pedersen.CommitTo(&H, pedersen.NewSecret(&rTotal), supplyAmount(570))
+
+	// The issuer discloses the supply
+	totalProof, err := sumproof.Prove(&H, []ristretto.Point{*supply}, supplyAmount(570), pedersen.NewSecret(&rTotal))
+	assert.NoError(t, err)
+	_, err = contract.DiscloseTotal(ctx, []string{supplyCommitmentKey}, "5.70", totalProof)
+	assert.NoError(t, err)
+
+	// and an upper bound on it, with the blinding factor of the bound minus the supply
+	var rHeadroom ristretto.Scalar
+	rHeadroom.Neg(&rTotal)
+	boundProof, err := rangeproof.Prove(&H, supplyAmount(430), pedersen.NewSecret(&rHeadroom))
+	assert.NoError(t, err)
+	_, err = contract.DiscloseSupplyBound(ctx, "9.99", boundProof)
+	assert.EqualError(t, err, "supply bound range proof not valid")
+
+	stub.GetTxIDReturns("TxidBound")
+	_, err = contract.DiscloseSupplyBound(ctx, "10.00", boundProof)
+	assert.NoError(t, err)
+	record, err := contract.GetSupplyBound(ctx, "TxidBound")
+	assert.NoError(t, err)
+	assert.True(t, record.Commitment.Equals(&expectedSupply))
+	assert.Equal(t, "10.00", record.Bound)
+	assert.Equal(t, "alice", record.DisclosedBy)
+
+	_, err = contract.GetSupplyBound(ctx, "unknown")
+	assert.EqualError(t, err, "no supply bound disclosed in transaction unknown")
+}
+
+func TestConfidentialSupplyRotation(t *testing.T) {
+	ctx, stub, _, state := newTestContext("issuer", "Org1MSP")
+	H, _ := initTestContract(t, ctx, state)
+	contract := new(SmartContract)
+	state[totalSupplyKey] = []byte("500")
+
+	var rSupply ristretto.Scalar
+	rSupply.Rand()
+	committedSupply := pedersen.CommitTo(&H, pedersen.NewSecret(&rSupply), supplyAmount(500))
+	supplyProof, err := sumproof.Prove(&H, []ristretto.Point{committedSupply}, supplyAmount(500), pedersen.NewSecret(&rSupply))
+	assert.NoError(t, err)
+	_, err = contract.EnableConfidentialSupply(ctx, committedSupply, supplyProof)
+	assert.NoError(t, err)
+
+	newH, _, _ := generateRandomCommitment(0)
+	_, err = contract.RotatePedersenParams(ctx, newH)
+	assert.NoError(t, err)
+
+	// The supply commitment is still under the old H, so mints cannot add to it
+	var rMint ristretto.Scalar
+	rMint.Rand()
+	minted := commitAmount(&newH, &rMint, 100)
+	stub.GetTransientReturns(transientOpening(&newH, &rMint, 100), nil)
+	_, err = contract.Mint(ctx, minted)
+	assert.EqualError(t, err, "client account supplyCommitment is in epoch 0, call MigrateBalance() or MigrateAccount() to move it to epoch 1")
+
+	migratedSupply := pedersen.CommitTo(&newH, pedersen.NewSecret(&rSupply), supplyAmount(500))
+	migrationProof := equality.ProveSameBlinding(&H, &newH, supplyAmount(500), pedersen.NewSecret(&rSupply))
+	_, err = contract.MigrateAccount(ctx, supplyCommitmentKey, migratedSupply, migrationProof)
+	assert.NoError(t, err)
+
+	_, err = contract.Mint(ctx, minted)
+	assert.NoError(t, err)
+	var rTotal ristretto.Scalar
+	rTotal.Add(&rSupply, &rMint)
+	expectedSupply := pedersen.CommitTo(&newH, pedersen.NewSecret(&rTotal), supplyAmount(600))
+	supply, err := contract.SupplyCommitment(ctx)
+	assert.NoError(t, err)
+	assert.True(t, supply.Equals(&expectedSupply))
+}
+
+func TestPublicSupply(t *testing.T) {
+	ctx, _, _, state := newTestContext("alice", "Org2MSP")
+	initTestContract(t, ctx, state)
+	contract := new(SmartContract)
+
+	_, err := contract.SupplyCommitment(ctx)
+	assert.EqualError(t, err, "total supply is public, call TotalSupply()")
+	_, err = contract.DiscloseSupplyBound(ctx, "10.00", rangeproof.Proof{})
+	assert.EqualError(t, err, "total supply is public, call TotalSupply()")
+	_, err = contract.EnableConfidentialSupply(ctx, ristretto.Point{}, sumproof.Proof{})
+	assert.EqualError(t, err, "client is not authorized to change the total supply mode")
+}
@@ -0,0 +1,373 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pedersen-commitment-transfer/src/adaptor"
+	"pedersen-commitment-transfer/src/rangeproof"
+	"pedersen-commitment-transfer/src/schnorr"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Object types for the composite keys of the swap flow
+const swapObjectType = "swap"
+const swapAccountObjectType = "swapAccount"
+
+// Status of a swap
+const (
+	swapLocked   = "locked"
+	swapClaimed  = "claimed"
+	swapRefunded = "refunded"
+)
+
+// SwapTerms describe a swap locked by LockSwap
+// The locked amount goes to Recipient once someone publishes a signature under SignerKey
+// on SwapClaimMessage. PreSignature is the sender's pre-signature of that message for
+// AdaptorPoint, so the only way to claim is to adapt it with the secret of AdaptorPoint,
+// which the claim then reveals. After Expiry (Unix seconds) the sender can take the amount back.
+type SwapTerms struct {
+	Recipient    string               `json:"recipient"`
+	Amount       ristretto.Point      `json:"amount"`
+	SignerKey    ristretto.Point      `json:"signerKey"`
+	AdaptorPoint ristretto.Point      `json:"adaptorPoint"`
+	PreSignature adaptor.PreSignature `json:"preSignature"`
+	Expiry       int64                `json:"expiry"`
+}
+
+// Swap is a locked swap and its outcome
+type Swap struct {
+	SwapTerms
+	Sender string `json:"sender"`
+	Status string `json:"status"`
+	// Adaptor secret revealed by the claim, base64 encoded as ristretto.Scalar text
+	Secret string `json:"secret,omitempty"`
+}
+
+// swapEvent reports a change of status of a swap
+type swapEvent struct {
+	SwapID string `json:"swapId"`
+	Status string `json:"status"`
+	Secret string `json:"secret,omitempty"`
+}
+
+// SwapClaimMessage is the message whose signature claims a swap
+func SwapClaimMessage(swapID string, recipient string, amount *ristretto.Point) []byte {
+	message := []byte("SwapClaim")
+	message = append(message, amount.Bytes()...)
+	message = append(message, swapID...)
+	message = append(message, 0)
+	return append(message, recipient...)
+}
+
+// LockSwap moves the committed amount from the client account into a swap account
+// amountProof and balanceProof are the debit proofs of terms.Amount, see the package documentation.
+// terms.Expiry must leave the recipient a lock window allowed by the timelock configuration.
+// This function triggers a Swap event
+func (s *SmartContract) LockSwap(ctx contractapi.TransactionContextInterface, swapID string, terms SwapTerms, amountProof rangeproof.Proof, balanceProof rangeproof.Proof) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	if swapID == "" {
+		return "", errors.New("swap id must not be empty")
+	}
+	if terms.Recipient == "" {
+		return "", errors.New("swap recipient must not be empty")
+	}
+	err = validateCommitments(&terms.Amount)
+	if err != nil {
+		return "", err
+	}
+	err = validatePoints(&terms.SignerKey, &terms.AdaptorPoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid swap key: %w", err)
+	}
+
+	// The recipient needs time to claim before the sender can take the amount back
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return "", fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	config, err := getTimelockConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+	lock := terms.Expiry - timestamp.GetSeconds()
+	if lock < config.Min || lock > config.Max {
+		return "", fmt.Errorf("swap must expire between %d and %d seconds from now, got %d", config.Min, config.Max, lock)
+	}
+
+	message := SwapClaimMessage(swapID, terms.Recipient, &terms.Amount)
+	if !adaptor.PreVerify(&terms.SignerKey, &terms.AdaptorPoint, message, terms.PreSignature) {
+		return "", errors.New("swap pre-signature not valid")
+	}
+
+	existing, err := getSwap(ctx, swapID)
+	if err != nil {
+		return "", err
+	}
+	if existing != nil {
+		return "", fmt.Errorf("swap %s already exists", swapID)
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+	balance, err := getCommittedBalance(ctx, clientID)
+	if err != nil {
+		return "", err
+	}
+	err = checkAccountEpoch(ctx, clientID)
+	if err != nil {
+		return "", err
+	}
+	err = isValidDebit(ctx, "balance", &balance.Commitment, &terms.Amount, amountProof, balanceProof)
+	if err != nil {
+		return "", fmt.Errorf("locking swap failed: %v", err)
+	}
+	accountKey, err := swapAccountKey(ctx, swapID)
+	if err != nil {
+		return "", err
+	}
+	err = transferHelper(ctx, clientID, accountKey, terms.Amount)
+	if err != nil {
+		return "", fmt.Errorf("failed to transfer: %v", err)
+	}
+
+	err = putSwap(ctx, swapID, &Swap{SwapTerms: terms, Sender: clientID, Status: swapLocked})
+	if err != nil {
+		return "", err
+	}
+	err = emitSwapEvent(ctx, swapEvent{SwapID: swapID, Status: swapLocked})
+	if err != nil {
+		return "", err
+	}
+
+	return ctx.GetStub().GetTxID(), nil
+}
+
+// ClaimSwap pays a locked swap to its recipient
+// The signature must be the sender's pre-signature adapted with the adaptor secret,
+// which is extracted and published in the swap and in the Swap event.
+// The swap can only be claimed before its expiry; from then on only the sender can refund it.
+// This function triggers a Swap event
+func (s *SmartContract) ClaimSwap(ctx contractapi.TransactionContextInterface, swapID string, signature schnorr.Signature) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	err = validatePoints(&signature.R)
+	if err != nil {
+		return "", fmt.Errorf("invalid swap signature: %w", err)
+	}
+
+	swap, err := getLockedSwap(ctx, swapID)
+	if err != nil {
+		return "", err
+	}
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return "", fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	if timestamp.GetSeconds() >= swap.Expiry {
+		return "", fmt.Errorf("swap %s expired at %s", swapID, formatDeadline(swap.Expiry))
+	}
+	message := SwapClaimMessage(swapID, swap.Recipient, &swap.Amount)
+	if !schnorr.Verify(&swap.SignerKey, message, signature) {
+		return "", errors.New("swap signature not valid")
+	}
+	secret, err := adaptor.Extract(swap.PreSignature, signature, &swap.AdaptorPoint)
+	if err != nil {
+		return "", err
+	}
+
+	accountKey, err := swapAccountKey(ctx, swapID)
+	if err != nil {
+		return "", err
+	}
+	// The account holds the locked amount, migrated to the current epoch if H was rotated since
+	locked, err := getCommittedBalance(ctx, accountKey)
+	if err != nil {
+		return "", err
+	}
+	err = transferHelper(ctx, accountKey, swap.Recipient, locked.Commitment)
+	if err != nil {
+		return "", fmt.Errorf("failed to transfer: %v", err)
+	}
+
+	swap.Status = swapClaimed
+	swap.Secret = secret.String()
+	err = putSwap(ctx, swapID, swap)
+	if err != nil {
+		return "", err
+	}
+	err = emitSwapEvent(ctx, swapEvent{SwapID: swapID, Status: swapClaimed, Secret: swap.Secret})
+	if err != nil {
+		return "", err
+	}
+
+	return ctx.GetStub().GetTxID(), nil
+}
+
+// RefundSwap returns an expired, unclaimed swap to its sender
+// This function triggers a Swap event
+func (s *SmartContract) RefundSwap(ctx contractapi.TransactionContextInterface, swapID string) (string, error) {
+
+	// Check if contract has been intilized first
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return "", fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
+
+	swap, err := getLockedSwap(ctx, swapID)
+	if err != nil {
+		return "", err
+	}
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+	if clientID != swap.Sender {
+		return "", errors.New("only the sender can refund a swap")
+	}
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return "", fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	if timestamp.GetSeconds() < swap.Expiry {
+		return "", fmt.Errorf("swap %s has not expired yet", swapID)
+	}
+
+	accountKey, err := swapAccountKey(ctx, swapID)
+	if err != nil {
+		return "", err
+	}
+	// The account holds the locked amount, migrated to the current epoch if H was rotated since
+	locked, err := getCommittedBalance(ctx, accountKey)
+	if err != nil {
+		return "", err
+	}
+	err = transferHelper(ctx, accountKey, swap.Sender, locked.Commitment)
+	if err != nil {
+		return "", fmt.Errorf("failed to transfer: %v", err)
+	}
+
+	swap.Status = swapRefunded
+	err = putSwap(ctx, swapID, swap)
+	if err != nil {
+		return "", err
+	}
+	err = emitSwapEvent(ctx, swapEvent{SwapID: swapID, Status: swapRefunded})
+	if err != nil {
+		return "", err
+	}
+
+	return ctx.GetStub().GetTxID(), nil
+}
+
+// GetSwap returns a swap, including the adaptor secret once it has been claimed
+func (s *SmartContract) GetSwap(ctx contractapi.TransactionContextInterface, swapID string) (*Swap, error) {
+	swap, err := getSwap(ctx, swapID)
+	if err != nil {
+		return nil, err
+	}
+	if swap == nil {
+		return nil, fmt.Errorf("swap %s does not exist", swapID)
+	}
+	return swap, nil
+}
+
+func swapKey(ctx contractapi.TransactionContextInterface, objectType string, swapID string) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(objectType, []string{swapID})
+	if err != nil {
+		return "", fmt.Errorf("failed to create the composite key: %v", err)
+	}
+	return key, nil
+}
+
+// swapAccountKey is the account holding the amount of a locked swap
+func swapAccountKey(ctx contractapi.TransactionContextInterface, swapID string) (string, error) {
+	return swapKey(ctx, swapAccountObjectType, swapID)
+}
+
+// getSwap returns nil if the swap does not exist
+func getSwap(ctx contractapi.TransactionContextInterface, swapID string) (*Swap, error) {
+	key, err := swapKey(ctx, swapObjectType, swapID)
+	if err != nil {
+		return nil, err
+	}
+	swapJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read swap from world state: %v", err)
+	}
+	if swapJSON == nil {
+		return nil, nil
+	}
+	var swap Swap
+	err = json.Unmarshal(swapJSON, &swap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal: %v", err)
+	}
+	return &swap, nil
+}
+
+func getLockedSwap(ctx contractapi.TransactionContextInterface, swapID string) (*Swap, error) {
+	swap, err := getSwap(ctx, swapID)
+	if err != nil {
+		return nil, err
+	}
+	if swap == nil {
+		return nil, fmt.Errorf("swap %s does not exist", swapID)
+	}
+	if swap.Status != swapLocked {
+		return nil, fmt.Errorf("swap %s is already %s", swapID, swap.Status)
+	}
+	return swap, nil
+}
+
+func putSwap(ctx contractapi.TransactionContextInterface, swapID string, swap *Swap) error {
+	key, err := swapKey(ctx, swapObjectType, swapID)
+	if err != nil {
+		return err
+	}
+	swapJSON, err := json.Marshal(swap)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().PutState(key, swapJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put to world state. %v", err)
+	}
+	return nil
+}
+
+func emitSwapEvent(ctx contractapi.TransactionContextInterface, event swapEvent) error {
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent("Swap", eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+	return nil
+}
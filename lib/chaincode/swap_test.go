@@ -0,0 +1,172 @@
+package chaincode
+
+import (
+	"pedersen-commitment-transfer/src/adaptor"
+	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/rangeproof"
+	"pedersen-commitment-transfer/src/schnorr"
+	"testing"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSwapClaim(t *testing.T) {
+	ctx, stub, identity, state := newTestContext("alice", "Org1MSP")
+	H, bindingFactor := initTestContract(t, ctx, state)
+	balance := commitAmount(&H, &bindingFactor, 100)
+	state["alice"] = balance.Bytes()
+
+	// Bob knows the secret that unlocks his side of the swap on the other ledger
+	var x, secret, rAmount, rLeft ristretto.Scalar
+	x.Rand()
+	secret.Rand()
+	rAmount.Rand()
+	rLeft.Sub(&bindingFactor, &rAmount)
+	terms := SwapTerms{
+		Recipient:    "bob",
+		Amount:       commitAmount(&H, &rAmount, 30),
+		SignerKey:    schnorr.PublicKey(&x),
+		AdaptorPoint: schnorr.PublicKey(&secret),
+		Expiry:       123456789 + 3600,
+	}
+	message := SwapClaimMessage("swap1", terms.Recipient, &terms.Amount)
+	terms.PreSignature = adaptor.PreSign(&x, &terms.AdaptorPoint, message)
+	balanceProof, err := rangeproof.Prove(&H, testAmount(70), pedersen.NewSecret(&rLeft))
+	assert.NoError(t, err)
+
+	amountProof, err := rangeproof.Prove(&H, testAmount(30), pedersen.NewSecret(&rAmount))
+	assert.NoError(t, err)
+	_, err = new(SmartContract).LockSwap(ctx, "swap1", terms, amountProof, balanceProof)
+	assert.NoError(t, err)
+	_, err = new(SmartContract).LockSwap(ctx, "swap1", terms, amountProof, balanceProof)
+	assert.EqualError(t, err, "swap swap1 already exists")
+
+	badTerms := terms
+	badTerms.Recipient = "mallory"
+	_, err = new(SmartContract).LockSwap(ctx, "swap2", badTerms, amountProof, balanceProof)
+	assert.EqualError(t, err, "swap pre-signature not valid")
+
+	// A signature that does not come from the pre-signature is rejected
+	identity.GetIDReturns("bob", nil)
+	_, err = new(SmartContract).ClaimSwap(ctx, "swap1", schnorr.Sign(&x, []byte("other")))
+	assert.EqualError(t, err, "swap signature not valid")
+
+	_, err = new(SmartContract).RefundSwap(ctx, "swap1")
+	assert.EqualError(t, err, "only the sender can refund a swap")
+
+	signature := adaptor.Adapt(terms.PreSignature, &secret)
+	_, err = new(SmartContract).ClaimSwap(ctx, "swap1", signature)
+	assert.NoError(t, err)
+
+	bobBalance := readPoint(t, state, "bob")
+	assert.True(t, bobBalance.Equals(&terms.Amount))
+
+	// The claim reveals the secret to Alice
+	swap, err := new(SmartContract).GetSwap(ctx, "swap1")
+	assert.NoError(t, err)
+	assert.Equal(t, swapClaimed, swap.Status)
+	assert.Equal(t, secret.String(), swap.Secret)
+
+	var event swapEvent
+	assert.Equal(t, "Swap", readEvent(t, stub, 1, &event))
+	assert.Equal(t, swapEvent{SwapID: "swap1", Status: swapClaimed, Secret: secret.String()}, event)
+
+	_, err = new(SmartContract).ClaimSwap(ctx, "swap1", signature)
+	assert.EqualError(t, err, "swap swap1 is already claimed")
+}
+
+func TestSwapRefund(t *testing.T) {
+	ctx, stub, _, state := newTestContext("alice", "Org1MSP")
+	H, bindingFactor := initTestContract(t, ctx, state)
+	balance := commitAmount(&H, &bindingFactor, 100)
+	state["alice"] = balance.Bytes()
+
+	var x, secret, rAmount, rLeft ristretto.Scalar
+	x.Rand()
+	secret.Rand()
+	rAmount.Rand()
+	rLeft.Sub(&bindingFactor, &rAmount)
+	terms := SwapTerms{
+		Recipient:    "bob",
+		Amount:       commitAmount(&H, &rAmount, 30),
+		SignerKey:    schnorr.PublicKey(&x),
+		AdaptorPoint: schnorr.PublicKey(&secret),
+		Expiry:       123456789 + 3600,
+	}
+	terms.PreSignature = adaptor.PreSign(&x, &terms.AdaptorPoint, SwapClaimMessage("swap1", "bob", &terms.Amount))
+	balanceProof, err := rangeproof.Prove(&H, testAmount(70), pedersen.NewSecret(&rLeft))
+	assert.NoError(t, err)
+
+	amountProof, err := rangeproof.Prove(&H, testAmount(30), pedersen.NewSecret(&rAmount))
+	assert.NoError(t, err)
+	_, err = new(SmartContract).LockSwap(ctx, "swap1", terms, amountProof, balanceProof)
+	assert.NoError(t, err)
+
+	_, err = new(SmartContract).RefundSwap(ctx, "swap1")
+	assert.EqualError(t, err, "swap swap1 has not expired yet")
+
+	// From the expiry on the recipient is too late to claim, even with the adapted signature
+	stub.GetTxTimestampReturns(&timestamp.Timestamp{Seconds: terms.Expiry}, nil)
+	_, err = new(SmartContract).ClaimSwap(ctx, "swap1", adaptor.Adapt(terms.PreSignature, &secret))
+	assert.EqualError(t, err, "swap swap1 expired at "+formatDeadline(terms.Expiry))
+
+	_, err = new(SmartContract).RefundSwap(ctx, "swap1")
+	assert.NoError(t, err)
+
+	aliceBalance := readPoint(t, state, "alice")
+	assert.True(t, aliceBalance.Equals(&balance), "The amount should be back")
+
+	_, err = new(SmartContract).ClaimSwap(ctx, "swap1", adaptor.Adapt(terms.PreSignature, &secret))
+	assert.EqualError(t, err, "swap swap1 is already refunded")
+}
+
+func TestLockSwapChecks(t *testing.T) {
+	ctx, _, _, state := newTestContext("alice", "Org1MSP")
+	H, bindingFactor := initTestContract(t, ctx, state)
+	balance := commitAmount(&H, &bindingFactor, 100)
+	state["alice"] = balance.Bytes()
+
+	var x, secret, rAmount, rLeft ristretto.Scalar
+	x.Rand()
+	secret.Rand()
+	rAmount.Rand()
+	rLeft.Sub(&bindingFactor, &rAmount)
+	lockSwap := func(swapID string, value int64, expiry int64, balanceProof rangeproof.Proof) error {
+		terms := SwapTerms{
+			Recipient:    "bob",
+			Amount:       commitAmount(&H, &rAmount, value),
+			SignerKey:    schnorr.PublicKey(&x),
+			AdaptorPoint: schnorr.PublicKey(&secret),
+			Expiry:       expiry,
+		}
+		terms.PreSignature = adaptor.PreSign(&x, &terms.AdaptorPoint, SwapClaimMessage(swapID, "bob", &terms.Amount))
+		amountProof, err := rangeproof.Prove(&H, testAmount(value), pedersen.NewSecret(&rAmount))
+		assert.NoError(t, err)
+		_, err = new(SmartContract).LockSwap(ctx, swapID, terms, amountProof, balanceProof)
+		return err
+	}
+
+	// Alice cannot lock more than she has, whatever range proof she makes up
+	var rOver ristretto.Scalar
+	rOver.Rand()
+	overdraftProof, err := rangeproof.Prove(&H, testAmount(30), pedersen.NewSecret(&rOver))
+	assert.NoError(t, err)
+	err = lockSwap("swap1", 130, 123456789+3600, overdraftProof)
+	assert.EqualError(t, err, "locking swap failed: balance range proof not valid")
+
+	// nor lock an amount she could refund before the recipient had a chance to claim it
+	balanceProof, err := rangeproof.Prove(&H, testAmount(70), pedersen.NewSecret(&rLeft))
+	assert.NoError(t, err)
+	err = lockSwap("swap1", 30, 123456789-1, balanceProof)
+	assert.EqualError(t, err, "swap must expire between 3600 and 2592000 seconds from now, got -1")
+	err = lockSwap("swap1", 30, 123456789+60, balanceProof)
+	assert.EqualError(t, err, "swap must expire between 3600 and 2592000 seconds from now, got 60")
+
+	left := readPoint(t, state, "alice")
+	assert.True(t, left.Equals(&balance), "Nothing should have been locked")
+
+	err = lockSwap("swap1", 30, 123456789+3600, balanceProof)
+	assert.NoError(t, err)
+}
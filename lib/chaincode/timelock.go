@@ -0,0 +1,85 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Key of the timelock configuration
+const timelockKey = "timelock"
+
+// TimelockConfig bounds the time a recipient has to approve a pending transfer, in seconds
+// Transfers get Default unless the sender picks a timelock between Min and Max.
+// The sender can reclaim the transfer once it is over.
+type TimelockConfig struct {
+	Default int64 `json:"default"`
+	Min     int64 `json:"min"`
+	Max     int64 `json:"max"`
+}
+
+// Timelocks of contracts initialized before they could be configured
+var defaultTimelockConfig = TimelockConfig{
+	Default: int64(24 * time.Hour / time.Second),
+	Min:     int64(time.Hour / time.Second),
+	Max:     int64(30 * 24 * time.Hour / time.Second),
+}
+
+// Validate checks that 0 < Min <= Default <= Max
+func (c TimelockConfig) Validate() error {
+	if c.Min <= 0 || c.Min > c.Default || c.Default > c.Max {
+		return fmt.Errorf("timelocks must satisfy 0 < min <= default <= max, got min %d, default %d and max %d", c.Min, c.Default, c.Max)
+	}
+	return nil
+}
+
+func putTimelockConfig(ctx contractapi.TransactionContextInterface, config TimelockConfig) error {
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().PutState(timelockKey, configJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set the timelock: %v", err)
+	}
+	return nil
+}
+
+// getTimelockConfig reads the configuration set by Initialize
+func getTimelockConfig(ctx contractapi.TransactionContextInterface) (TimelockConfig, error) {
+	configJSON, err := ctx.GetStub().GetState(timelockKey)
+	if err != nil {
+		return TimelockConfig{}, fmt.Errorf("failed to read the timelock from world state: %v", err)
+	}
+	if configJSON == nil {
+		return defaultTimelockConfig, nil
+	}
+	var config TimelockConfig
+	err = json.Unmarshal(configJSON, &config)
+	if err != nil {
+		return TimelockConfig{}, fmt.Errorf("failed to unmarshal the timelock: %v", err)
+	}
+	return config, nil
+}
+
+// resolveTimelock returns the timelock of a new transfer; 0 selects the default
+func resolveTimelock(ctx contractapi.TransactionContextInterface, timelock int64) (int64, error) {
+	config, err := getTimelockConfig(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if timelock == 0 {
+		return config.Default, nil
+	}
+	if timelock < config.Min || timelock > config.Max {
+		return 0, fmt.Errorf("timelock must be between %d and %d seconds, got %d", config.Min, config.Max, timelock)
+	}
+	return timelock, nil
+}
+
+// formatDeadline formats a deadline in seconds since the Unix epoch for error messages
+func formatDeadline(deadline int64) string {
+	return time.Unix(deadline, 0).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,40 @@
+package chaincode
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveTimelock(t *testing.T) {
+	ctx, _, _, state := newTestContext("alice", "Org1MSP")
+
+	timelock, err := resolveTimelock(ctx, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, defaultTimelockConfig.Default, timelock, "Contracts initialized without timelocks use the defaults")
+
+	assert.NoError(t, putTimelockConfig(ctx, TimelockConfig{Default: 600, Min: 60, Max: 3600}))
+	assert.NotNil(t, state[timelockKey])
+
+	var tests = []struct {
+		requested int64
+		timelock  int64
+		err       string
+	}{
+		{requested: 0, timelock: 600},
+		{requested: 60, timelock: 60},
+		{requested: 3600, timelock: 3600},
+		{requested: 59, err: "timelock must be between 60 and 3600 seconds, got 59"},
+		{requested: 3601, err: "timelock must be between 60 and 3600 seconds, got 3601"},
+		{requested: -1, err: "timelock must be between 60 and 3600 seconds, got -1"},
+	}
+	for _, tt := range tests {
+		timelock, err := resolveTimelock(ctx, tt.requested)
+		if tt.err != "" {
+			assert.EqualError(t, err, tt.err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tt.timelock, timelock)
+	}
+}
@@ -1,66 +1,84 @@
 package chaincode
 
 import (
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"math/big"
+	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/sumproof"
+	"strconv"
 
 	"github.com/bwesterb/go-ristretto"
 	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
-const BLOCK_GENERATION_TIME = 10
+// Bit width of token amounts; transient amounts are 8 bytes
+const amountBits = 64
 
+// PedersenVariables holds the public parameters of the commitments
+// Blinding factors are chosen and kept by the clients, never stored here.
 type PedersenVariables struct {
-	H_bytes             []byte
-	BindingFactor_bytes []byte
-	ZeroCommitted_bytes []byte
+	H_bytes []byte
 }
 
-func createPedersenVariables(H, BindingFactor, ZeroCommitted []byte) PedersenVariables {
+func createPedersenVariables(H []byte) PedersenVariables {
 	return PedersenVariables{
-		H_bytes:             H,
-		BindingFactor_bytes: BindingFactor,
-		ZeroCommitted_bytes: ZeroCommitted,
+		H_bytes: H,
 	}
 }
 
+// TxInformation records a pending transfer held in its staged account
+// Only Recipient can approve or reject it, before Deadline in seconds since the Unix epoch,
+// and only Sender can reclaim it, from Deadline on.
+// History lists every status the transfer has been in, the last one being Status.
 type TxInformation struct {
-	Amount              []byte
-	ProposalBlockNumber int64
-	isValid             bool //will be needed to avoid double spending, otherwise a recipient could approve several times within the time the contract exists.
-} //Since we are using a different temp address per each transaction, this won't happen anyway. Implementing this allows us to have a single temp account
+	Sender    string
+	Recipient string
+	Amount    []byte
+	Deadline  int64
+	Status    TransferStatus
+	History   []StatusChange
+}
 
 // TODO: use pointers, you MUST on stubs for example
-func createTxInfo(stub shim.ChaincodeStubInterface, sender string, amount ristretto.Point) (*TxInformation, error) {
+func createTxInfo(stub shim.ChaincodeStubInterface, sender string, recipient string, amount ristretto.Point, timelock int64) (*TxInformation, error) {
 	amountBytes, err := amount.MarshalBinary()
 	if err != nil {
 		return &TxInformation{}, err
 	}
-	blockNumber, err := GetBlockNumber(stub)
+	txTimestamp, err := stub.GetTxTimestamp()
 	if err != nil {
 		return &TxInformation{}, err
 	}
 
 	txInfo := TxInformation{
-		Amount:              amountBytes,
-		ProposalBlockNumber: blockNumber,
-		isValid:             true,
+		Sender:    sender,
+		Recipient: recipient,
+		Amount:    amountBytes,
+		Deadline:  txTimestamp.GetSeconds() + timelock,
+		Status:    TransferPending,
+		History:   []StatusChange{{Status: TransferPending, Timestamp: txTimestamp.GetSeconds()}},
 	}
 	return &txInfo, nil
 }
 
-func storeTxInfo(stub shim.ChaincodeStubInterface, sender string, amount ristretto.Point) error {
-	txInfo, err := createTxInfo(stub, sender, amount)
+func storeTxInfo(stub shim.ChaincodeStubInterface, sender string, recipient string, amount ristretto.Point, timelock int64) error {
+	txInfo, err := createTxInfo(stub, sender, recipient, amount, timelock)
 	if err != nil {
 		return err
 	}
 
+	return putTxInfo(stub, stub.GetTxID(), txInfo)
+}
+
+func putTxInfo(stub shim.ChaincodeStubInterface, TxId string, txInfo *TxInformation) error {
 	transferDetailsBytes, err := json.Marshal(txInfo)
 	if err != nil {
 		return fmt.Errorf("failed to marshal: %v", err)
 	}
-	txId := stub.GetTxID()
-	err = stub.PutState(txId, transferDetailsBytes)
+	err = stub.PutState(TxId, transferDetailsBytes)
 	if err != nil {
 		return err
 	}
@@ -72,9 +90,15 @@ func getTxInfo(stub shim.ChaincodeStubInterface, TxId string) (TxInformation, er
 	TxInfoBytes, err := stub.GetState(TxId)
 	if err != nil {
 		return TxInformation{}, fmt.Errorf("failed to read transaction information from world state: %v", err)
-	} //TODO: may not be correct to return true if fails
+	}
+	if TxInfoBytes == nil {
+		return TxInformation{}, fmt.Errorf("transaction %s not found", TxId)
+	}
 	var txInfo TxInformation
-	json.Unmarshal(TxInfoBytes, &txInfo)
+	err = json.Unmarshal(TxInfoBytes, &txInfo)
+	if err != nil {
+		return TxInformation{}, fmt.Errorf("failed to unmarshal transaction information: %v", err)
+	}
 	if txInfo.Amount == nil {
 		return TxInformation{}, fmt.Errorf("temporary account has no balance")
 	}
@@ -86,18 +110,74 @@ func getTxInfo(stub shim.ChaincodeStubInterface, TxId string) (TxInformation, er
 	return txInfo, nil
 }
 
-func GetBlockNumber(stub shim.ChaincodeStubInterface) (int64, error) {
-	// Get the transaction timestamp
-	txTimestamp, err := stub.GetTxTimestamp()
+// getTransientAmount reads a big-endian number of base units from the transient map
+func getTransientAmount(ctx contractapi.TransactionContextInterface, key string) (pedersen.Amount, error) {
+	tr, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return pedersen.Amount{}, fmt.Errorf("failed to get Transient field: %v", err)
+	}
+	value, ok := tr[key]
+	if !ok {
+		return pedersen.Amount{}, fmt.Errorf("key %s not found", key)
+	}
+	if len(value) != 8 {
+		return pedersen.Amount{}, fmt.Errorf("transient %s must be 8 bytes", key)
+	}
+	denomination, err := getDenomination(ctx)
+	if err != nil {
+		return pedersen.Amount{}, err
+	}
+	return denomination.FromUint64(binary.BigEndian.Uint64(value))
+}
+
+// getTransientOpeningProof reads the JSON proof that a commitment opens to a transient amount
+func getTransientOpeningProof(ctx contractapi.TransactionContextInterface, key string) (sumproof.Proof, error) {
+	tr, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return sumproof.Proof{}, fmt.Errorf("failed to get Transient field: %v", err)
+	}
+	value, ok := tr[key]
+	if !ok {
+		return sumproof.Proof{}, fmt.Errorf("key %s not found", key)
+	}
+	var proof sumproof.Proof
+	err = json.Unmarshal(value, &proof)
+	if err != nil {
+		return sumproof.Proof{}, fmt.Errorf("failed to unmarshal %s: %v", key, err)
+	}
+	err = validatePoints(&proof.R)
+	if err != nil {
+		return sumproof.Proof{}, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return proof, nil
+}
+
+// newAmount converts a number of base units to an amount of the token
+func newAmount(ctx contractapi.TransactionContextInterface, units int64) (pedersen.Amount, error) {
+	denomination, err := getDenomination(ctx)
 	if err != nil {
-		return 0, err
+		return pedersen.Amount{}, err
 	}
-	// Calculate the approximate block number
-	blockNumber := txTimestamp.GetSeconds() / BLOCK_GENERATION_TIME // Assuming 10 seconds per block
+	return denomination.FromUnits(big.NewInt(units))
+}
 
-	return blockNumber, nil
+// getDenomination reads the decimals set at Initialize
+func getDenomination(ctx contractapi.TransactionContextInterface) (pedersen.Denomination, error) {
+	decimalsBytes, err := ctx.GetStub().GetState(decimalsKey)
+	if err != nil {
+		return pedersen.Denomination{}, fmt.Errorf("failed to get decimals: %v", err)
+	}
+	if decimalsBytes == nil {
+		return pedersen.Denomination{}, fmt.Errorf("token decimals are not set, call Initialize() first")
+	}
+	return parseDenomination(decimalsBytes)
 }
 
-func (txInfo *TxInformation) InvalidateTx() {
-	txInfo.isValid = false
+// parseDenomination parses the decimals argument of Initialize
+func parseDenomination(decimals []byte) (pedersen.Denomination, error) {
+	value, err := strconv.ParseUint(string(decimals), 10, 8)
+	if err != nil {
+		return pedersen.Denomination{}, fmt.Errorf("decimals must be an integer between 0 and 255: %v", err)
+	}
+	return pedersen.Denomination{Decimals: uint8(value), Bits: amountBits}, nil
 }
@@ -11,28 +11,6 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-func TestGetBlockNumber(t *testing.T) {
-	// Create a mock stub
-	ctx := &testsfakes.FakeTestTransactionContextInterface{}
-	stub := &testsfakes.FakeTestChaincodeStubInterface{}
-	ctx.GetStubStub = func() shim.ChaincodeStubInterface {
-		return stub
-	}
-	expectedTimestamp := &timestamp.Timestamp{
-		Seconds: 123456789, // Replace with your desired timestamp
-	}
-
-	// Configure the fake stub's behavior
-	stub.GetTxTimestampReturns(expectedTimestamp, nil)
-
-	// Call your function with the fake stub
-	blockNumber, err := GetBlockNumber(stub)
-
-	// Assertions
-	assert.NoError(t, err)
-	assert.Equal(t, int64(12345678), blockNumber) // Replace with your expected block number
-}
-
 func TestCreateTxInfo(t *testing.T) {
 	// Create a mock stub
 	ctx := &testsfakes.FakeTestTransactionContextInterface{}
@@ -52,12 +30,15 @@ func TestCreateTxInfo(t *testing.T) {
 	// Call your function with the fake stub
 	sender := "sender"
 	amount := ristretto.Point{} // Replace with your desired amount
-	_, err := createTxInfo(stub, sender, amount)
+	txInfo, err := createTxInfo(stub, sender, "recipient", amount, 3600)
 
 	// Custom assertions
 	if err != nil {
 		t.Errorf("createTxInfo error: %v", err)
 	}
+	assert.Equal(t, "sender", txInfo.Sender)
+	assert.Equal(t, "recipient", txInfo.Recipient)
+	assert.Equal(t, int64(123456789+3600), txInfo.Deadline)
 
 	// Add more custom assertions as needed for other fields
 }
@@ -81,7 +62,7 @@ func TestStoreTxInfo(t *testing.T) {
 	// Call your function with the fake stub
 	sender := "sender"
 	amount := ristretto.Point{} // Replace with your desired amount
-	err := storeTxInfo(stub, sender, amount)
+	err := storeTxInfo(stub, sender, "recipient", amount, 3600)
 
 	// Custom assertions
 	if err != nil {
@@ -109,9 +90,9 @@ func TestGetTxInfo(t *testing.T) {
 	// Create a sample TxInformation struct and store it in the stub's state
 	amount := ristretto.Point{} // Replace with your desired amount
 	txInfo := TxInformation{
-		Amount:              amount.Bytes(),
-		ProposalBlockNumber: 12345678, // Replace with your desired block number
-		isValid:             true,
+		Amount:   amount.Bytes(),
+		Deadline: 123456789 + 3600,
+		Status:   TransferPending,
 	}
 	txInfoBytes, _ := json.Marshal(txInfo)
 	stub.GetStateReturns(txInfoBytes, nil)
@@ -125,5 +106,31 @@ func TestGetTxInfo(t *testing.T) {
 		t.Errorf("getTxInfo error: %v", err)
 	}
 
-	// Add more custom assertions as needed for other fields
+	stub.GetStateReturns(nil, nil)
+	_, err = getTxInfo(stub, txId)
+	assert.EqualError(t, err, "transaction tx123 not found")
+
+	stub.GetStateReturns([]byte("{"), nil)
+	_, err = getTxInfo(stub, txId)
+	assert.ErrorContains(t, err, "failed to unmarshal transaction information")
+}
+
+func TestGetTransientOpeningProof(t *testing.T) {
+	ctx, stub, _, state := newTestContext("alice", "Org1MSP")
+	H, bindingFactor := initTestContract(t, ctx, state)
+
+	stub.GetTransientReturns(transientAmounts(map[string]int64{"amount": 10}), nil)
+	_, err := getTransientOpeningProof(ctx, amountProofKey)
+	assert.EqualError(t, err, "key amountProof not found")
+
+	stub.GetTransientReturns(map[string][]byte{amountProofKey: []byte("{")}, nil)
+	_, err = getTransientOpeningProof(ctx, amountProofKey)
+	assert.Error(t, err)
+
+	stub.GetTransientReturns(transientOpening(&H, &bindingFactor, 10), nil)
+	proof, err := getTransientOpeningProof(ctx, amountProofKey)
+	assert.NoError(t, err)
+	committed := commitAmount(&H, &bindingFactor, 10)
+	assert.NoError(t, IsValidEncryption(ctx, testAmount(10), &committed, proof))
+	assert.EqualError(t, IsValidEncryption(ctx, testAmount(11), &committed, proof), "encryption not valid")
 }
@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
 	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
@@ -14,3 +15,8 @@ type TestTransactionContextInterface interface {
 type TestChaincodeStubInterface interface {
 	shim.ChaincodeStubInterface
 }
+
+//go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 . TestClientIdentity
+type TestClientIdentity interface {
+	cid.ClientIdentity
+}
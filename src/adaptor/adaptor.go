@@ -0,0 +1,74 @@
+// Package adaptor implements Schnorr adaptor signatures.
+//
+// A pre-signature on m for the adaptor point T = tB is a nonce point
+// R' = kB and a response s' = k + cx, where the challenge
+// c = schnorr.Challenge(R' + T, X, m) already commits to the final nonce
+// R' + T. Whoever knows t can adapt it into the ordinary Schnorr signature
+// (R' + T, s' + t), and whoever sees both the pre-signature and the
+// signature learns t = s - s'. Publishing the signature to claim funds on
+// one ledger therefore hands the counterparty the secret it needs on the
+// other one.
+package adaptor
+
+import (
+	"errors"
+	"pedersen-commitment-transfer/src/schnorr"
+
+	"github.com/bwesterb/go-ristretto"
+)
+
+// Pre-signature (R', s') for an adaptor point T
+type PreSignature struct {
+	R ristretto.Point  `json:"r"`
+	S ristretto.Scalar `json:"s"`
+}
+
+// Pre-sign message with the secret key x for the adaptor point T
+func PreSign(x *ristretto.Scalar, T *ristretto.Point, message []byte) PreSignature {
+	X := schnorr.PublicKey(x)
+	var k ristretto.Scalar
+	defer k.SetZero()
+	k.Rand()
+
+	var pre PreSignature
+	pre.R.ScalarMultBase(&k)
+	c := schnorr.Challenge(finalNonce(&pre, T), &X, message)
+	pre.S.MulAdd(&c, x, &k)
+	return pre
+}
+
+// Verify a pre-signature on message under the public key X for the adaptor point T
+func PreVerify(X, T *ristretto.Point, message []byte, pre PreSignature) bool {
+	c := schnorr.Challenge(finalNonce(&pre, T), X, message)
+	var lhs, rhs, cX ristretto.Point
+	lhs.ScalarMultBase(&pre.S)
+	rhs.Add(&pre.R, cX.ScalarMult(X, &c))
+	return lhs.Equals(&rhs)
+}
+
+// Complete a pre-signature with the adaptor secret t into a Schnorr signature
+func Adapt(pre PreSignature, t *ristretto.Scalar) schnorr.Signature {
+	var T ristretto.Point
+	T.ScalarMultBase(t)
+	var sig schnorr.Signature
+	sig.R = *finalNonce(&pre, &T)
+	sig.S.Add(&pre.S, t)
+	return sig
+}
+
+// Recover the adaptor secret of T from a pre-signature and its adapted signature
+func Extract(pre PreSignature, sig schnorr.Signature, T *ristretto.Point) (ristretto.Scalar, error) {
+	var t ristretto.Scalar
+	t.Sub(&sig.S, &pre.S)
+	var check ristretto.Point
+	if !check.ScalarMultBase(&t).Equals(T) {
+		return ristretto.Scalar{}, errors.New("signature was not adapted from this pre-signature")
+	}
+	return t, nil
+}
+
+// R' + T
+func finalNonce(pre *PreSignature, T *ristretto.Point) *ristretto.Point {
+	var R ristretto.Point
+	return R.Add(&pre.R, T)
+}
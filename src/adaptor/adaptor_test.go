@@ -0,0 +1,49 @@
+package adaptor
+
+import (
+	"pedersen-commitment-transfer/src/schnorr"
+	"testing"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreSignAdaptExtract(t *testing.T) {
+	var x, secret ristretto.Scalar
+	x.Rand()
+	secret.Rand()
+	X := schnorr.PublicKey(&x)
+	T := schnorr.PublicKey(&secret)
+	message := []byte("claim")
+
+	pre := PreSign(&x, &T, message)
+	assert.True(t, PreVerify(&X, &T, message, pre), "Pre-signature should verify")
+	assert.False(t, PreVerify(&X, &T, []byte("other"), pre), "Pre-signature is bound to the message")
+
+	var otherT ristretto.Point
+	otherT.Rand()
+	assert.False(t, PreVerify(&X, &otherT, message, pre), "Pre-signature is bound to the adaptor point")
+
+	// A pre-signature alone is not a valid signature
+	assert.False(t, schnorr.Verify(&X, message, schnorr.Signature{R: pre.R, S: pre.S}))
+
+	sig := Adapt(pre, &secret)
+	assert.True(t, schnorr.Verify(&X, message, sig), "Adapted signature should verify")
+
+	extracted, err := Extract(pre, sig, &T)
+	assert.NoError(t, err)
+	assert.True(t, extracted.Equals(&secret), "Extracted secret should match")
+}
+
+func TestExtractFromUnrelatedSignature(t *testing.T) {
+	var x, secret ristretto.Scalar
+	x.Rand()
+	secret.Rand()
+	T := schnorr.PublicKey(&secret)
+	message := []byte("claim")
+
+	pre := PreSign(&x, &T, message)
+	sig := schnorr.Sign(&x, message)
+	_, err := Extract(pre, sig, &T)
+	assert.Error(t, err)
+}
@@ -0,0 +1,107 @@
+// Package blindsig implements blind Schnorr signatures.
+//
+// The signer commits to a nonce R = kB, the user blinds it into
+// R' = R + aB + bX and sends back the blinded challenge c = c' + b with
+// c' = schnorr.Challenge(R', X, m). The signer answers s = k + cx and the
+// user unblinds it into s' = s + a. (R', s') is an ordinary Schnorr
+// signature on m that the signer cannot link to the signing session.
+//
+// A signer must not run many sessions concurrently with the same key, since
+// parallel sessions are exposed to the ROS attack. Sessions are single use.
+package blindsig
+
+import (
+	"errors"
+	"pedersen-commitment-transfer/src/schnorr"
+
+	"github.com/bwesterb/go-ristretto"
+)
+
+// Signer holds the issuing key
+type Signer struct {
+	x ristretto.Scalar
+	X ristretto.Point
+}
+
+// Signing session on the signer side
+type SignerSession struct {
+	k    ristretto.Scalar
+	R    ristretto.Point
+	done bool
+}
+
+// Signing session on the user side
+type UserSession struct {
+	X       ristretto.Point
+	R       ristretto.Point
+	message []byte
+	alpha   ristretto.Scalar
+	c       ristretto.Scalar
+	blinded schnorr.Signature
+}
+
+// Create a signer for the secret key x
+func NewSigner(x *ristretto.Scalar) *Signer {
+	return &Signer{x: *x, X: schnorr.PublicKey(x)}
+}
+
+// Start a session; session.R is sent to the user
+func (s *Signer) NewSession() *SignerSession {
+	var session SignerSession
+	session.k.Rand()
+	session.R.ScalarMultBase(&session.k)
+	return &session
+}
+
+// Answer the blinded challenge of the user. A session can only sign once,
+// since two answers for the same nonce reveal the secret key.
+func (s *Signer) Sign(session *SignerSession, challenge *ristretto.Scalar) (ristretto.Scalar, error) {
+	if session.done {
+		return ristretto.Scalar{}, errors.New("signing session already used")
+	}
+	session.done = true
+
+	var response ristretto.Scalar
+	response.MulAdd(challenge, &s.x, &session.k)
+	session.k.SetZero()
+	return response, nil
+}
+
+// Blind the signer nonce R for message under public key X.
+// The returned challenge is sent to the signer.
+func Blind(X, R *ristretto.Point, message []byte) (*UserSession, ristretto.Scalar) {
+	session := &UserSession{X: *X, R: *R, message: append([]byte{}, message...)}
+
+	var beta ristretto.Scalar
+	session.alpha.Rand()
+	beta.Rand()
+
+	// R' = R + aB + bX
+	var aB, bX ristretto.Point
+	session.blinded.R.Add(R, aB.ScalarMultBase(&session.alpha))
+	session.blinded.R.Add(&session.blinded.R, bX.ScalarMult(X, &beta))
+
+	cPrime := schnorr.Challenge(&session.blinded.R, X, message)
+	session.c.Add(&cPrime, &beta)
+	return session, session.c
+}
+
+// Unblind the signer response into a signature on the message.
+// The response is checked first, so a misbehaving signer is detected.
+func (u *UserSession) Unblind(response *ristretto.Scalar) (schnorr.Signature, error) {
+	var lhs, rhs, cX ristretto.Point
+	lhs.ScalarMultBase(response)
+	rhs.Add(&u.R, cX.ScalarMult(&u.X, &u.c))
+	if !lhs.Equals(&rhs) {
+		return schnorr.Signature{}, errors.New("signer response not valid")
+	}
+
+	sig := u.blinded
+	sig.S.Add(response, &u.alpha)
+	return sig, nil
+}
+
+// Verify an unblinded signature; it is an ordinary Schnorr signature
+func Verify(X *ristretto.Point, message []byte, sig schnorr.Signature) bool {
+	return schnorr.Verify(X, message, sig)
+}
@@ -0,0 +1,57 @@
+package blindsig
+
+import (
+	"testing"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlindSignature(t *testing.T) {
+	var x ristretto.Scalar
+	x.Rand()
+	signer := NewSigner(&x)
+	message := []byte("serial-0001")
+
+	signerSession := signer.NewSession()
+	userSession, challenge := Blind(&signer.X, &signerSession.R, message)
+
+	// The signer never sees the message nor the final nonce
+	response, err := signer.Sign(signerSession, &challenge)
+	assert.NoError(t, err)
+
+	sig, err := userSession.Unblind(&response)
+	assert.NoError(t, err)
+	assert.True(t, Verify(&signer.X, message, sig), "Unblinded signature should verify")
+	assert.False(t, sig.R.Equals(&signerSession.R), "Signature nonce should be blinded")
+	assert.False(t, Verify(&signer.X, []byte("serial-0002"), sig))
+}
+
+func TestSessionIsSingleUse(t *testing.T) {
+	var x ristretto.Scalar
+	x.Rand()
+	signer := NewSigner(&x)
+
+	session := signer.NewSession()
+	_, challenge := Blind(&signer.X, &session.R, []byte("a"))
+	_, err := signer.Sign(session, &challenge)
+	assert.NoError(t, err)
+
+	_, challenge = Blind(&signer.X, &session.R, []byte("b"))
+	_, err = signer.Sign(session, &challenge)
+	assert.EqualError(t, err, "signing session already used")
+}
+
+func TestUnblindRejectsBadResponse(t *testing.T) {
+	var x ristretto.Scalar
+	x.Rand()
+	signer := NewSigner(&x)
+
+	session := signer.NewSession()
+	userSession, _ := Blind(&signer.X, &session.R, []byte("a"))
+
+	var bogus ristretto.Scalar
+	bogus.Rand()
+	_, err := userSession.Unblind(&bogus)
+	assert.EqualError(t, err, "signer response not valid")
+}
@@ -0,0 +1,100 @@
+package equality
+
+import (
+	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/transcript"
+
+	"github.com/bwesterb/go-ristretto"
+)
+
+const transcriptLabel = "pedersen-equality-v1"
+
+// Proof that C1 = r1 B + v H1 and C2 = r2 B + v H2 hide the same value v
+// under two different secondary points, without revealing v, r1 or r2.
+//
+// The prover commits to random k, k1, k2 with A1 = k1 B + k H1 and
+// A2 = k2 B + k H2 and answers the challenge c with Sv = k + c v,
+// S1 = k1 + c r1 and S2 = k2 + c r2. Sharing Sv between the two equations
+// is what ties the values together.
+type Proof struct {
+	A1 ristretto.Point  `json:"a1"`
+	A2 ristretto.Point  `json:"a2"`
+	Sv ristretto.Scalar `json:"sv"`
+	S1 ristretto.Scalar `json:"s1"`
+	S2 ristretto.Scalar `json:"s2"`
+}
+
+// Prove that CommitTo(H1, r1, v) and CommitTo(H2, r2, v) hide the same value
+func Prove(H1, H2 *ristretto.Point, v pedersen.Amount, r1, r2 *pedersen.Secret) Proof {
+	var k1, k2 ristretto.Scalar
+	defer k1.SetZero()
+	defer k2.SetZero()
+	k1.Rand()
+	k2.Rand()
+	return prove(H1, H2, v, r1, r2, &k1, &k2)
+}
+
+// ProveSameBlinding proves that CommitTo(H1, r, v) and CommitTo(H2, r, v) hide the same value
+// under the same blinding factor, so that the second commitment is determined by the first.
+func ProveSameBlinding(H1, H2 *ristretto.Point, v pedersen.Amount, r *pedersen.Secret) Proof {
+	var k1 ristretto.Scalar
+	defer k1.SetZero()
+	k1.Rand()
+	return prove(H1, H2, v, r, r, &k1, &k1)
+}
+
+func prove(H1, H2 *ristretto.Point, v pedersen.Amount, r1, r2 *pedersen.Secret, k1, k2 *ristretto.Scalar) Proof {
+	C1 := pedersen.CommitTo(H1, r1, v)
+	C2 := pedersen.CommitTo(H2, r2, v)
+
+	var k ristretto.Scalar
+	defer k.SetZero()
+	k.Rand()
+
+	var proof Proof
+	proof.A1 = commitScalar(H1, k1, &k)
+	proof.A2 = commitScalar(H2, k2, &k)
+	c := challenge(H1, H2, &C1, &C2, &proof.A1, &proof.A2)
+
+	var value ristretto.Scalar
+	defer value.SetZero()
+	value.SetBigInt(v.Units())
+	proof.Sv.MulAdd(&c, &value, &k)
+	proof.S1.MulAdd(&c, r1.Scalar(), k1)
+	proof.S2.MulAdd(&c, r2.Scalar(), k2)
+	return proof
+}
+
+// Verify that C1 under H1 and C2 under H2 hide the same value
+func Verify(H1, H2, C1, C2 *ristretto.Point, proof Proof) bool {
+	c := challenge(H1, H2, C1, C2, &proof.A1, &proof.A2)
+	return verifyEquation(H1, C1, &proof.A1, &proof.S1, &proof.Sv, &c) &&
+		verifyEquation(H2, C2, &proof.A2, &proof.S2, &proof.Sv, &c)
+}
+
+// VerifySameBlinding checks a proof made by ProveSameBlinding
+// Requiring S1 == S2 leaves Sv (H1 - H2) == A1 - A2 + c (C1 - C2), which only holds if
+// C1 - C2 is a multiple of H1 - H2, that is if both commitments share the blinding factor.
+func VerifySameBlinding(H1, H2, C1, C2 *ristretto.Point, proof Proof) bool {
+	return proof.S1.Equals(&proof.S2) && Verify(H1, H2, C1, C2, proof)
+}
+
+// Check s B + sv H == A + c C
+func verifyEquation(H, C, A *ristretto.Point, s, sv, c *ristretto.Scalar) bool {
+	lhs := commitScalar(H, s, sv)
+	var rhs, cC ristretto.Point
+	rhs.Add(A, cC.ScalarMult(C, c))
+	return lhs.Equals(&rhs)
+}
+
+// r B + x H for a scalar x
+func commitScalar(H *ristretto.Point, r, x *ristretto.Scalar) ristretto.Point {
+	var result, xH ristretto.Point
+	result.ScalarMultBase(r)
+	result.Add(&result, xH.ScalarMult(H, x))
+	return result
+}
+
+func challenge(H1, H2, C1, C2, A1, A2 *ristretto.Point) ristretto.Scalar {
+	return transcript.New(transcriptLabel).AppendPoints(H1, H2, C1, C2, A1, A2).Challenge()
+}
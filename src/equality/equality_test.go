@@ -0,0 +1,70 @@
+package equality
+
+import (
+	"pedersen-commitment-transfer/src/pedersen"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testDenomination = pedersen.Denomination{Decimals: 2, Bits: 64}
+
+func TestProveVerify(t *testing.T) {
+	H1 := pedersen.GenerateH()
+	H2 := pedersen.GenerateH()
+	v, _ := testDenomination.FromUint64(1234)
+	r1 := pedersen.RandomSecret()
+	r2 := pedersen.RandomSecret()
+
+	C1 := pedersen.CommitTo(&H1, r1, v)
+	C2 := pedersen.CommitTo(&H2, r2, v)
+	proof := Prove(&H1, &H2, v, r1, r2)
+	assert.True(t, Verify(&H1, &H2, &C1, &C2, proof), "Proof should verify")
+
+	// The proof is bound to the generators and commitments in order
+	assert.False(t, Verify(&H2, &H1, &C2, &C1, proof), "Swapped sides")
+	H3 := pedersen.GenerateH()
+	assert.False(t, Verify(&H1, &H3, &C1, &C2, proof), "Other generator")
+}
+
+func TestDifferentValues(t *testing.T) {
+	H1 := pedersen.GenerateH()
+	H2 := pedersen.GenerateH()
+	v, _ := testDenomination.FromUint64(100)
+	w, _ := testDenomination.FromUint64(101)
+	r1 := pedersen.RandomSecret()
+	r2 := pedersen.RandomSecret()
+
+	C1 := pedersen.CommitTo(&H1, r1, v)
+	C2 := pedersen.CommitTo(&H2, r2, w)
+	proof := Prove(&H1, &H2, v, r1, r2)
+	assert.False(t, Verify(&H1, &H2, &C1, &C2, proof), "Commitments to different values should not verify")
+
+	// Neither does a proof made for the new value
+	proof = Prove(&H1, &H2, w, r1, r2)
+	assert.False(t, Verify(&H1, &H2, &C1, &C2, proof))
+}
+
+func TestSameBlinding(t *testing.T) {
+	H1 := pedersen.GenerateH()
+	H2 := pedersen.GenerateH()
+	v, _ := testDenomination.FromUint64(1234)
+	r := pedersen.RandomSecret()
+
+	C1 := pedersen.CommitTo(&H1, r, v)
+	C2 := pedersen.CommitTo(&H2, r, v)
+	proof := ProveSameBlinding(&H1, &H2, v, r)
+	assert.True(t, VerifySameBlinding(&H1, &H2, &C1, &C2, proof), "Proof should verify")
+	assert.True(t, Verify(&H1, &H2, &C1, &C2, proof), "It is also a plain equality proof")
+
+	// A plain equality proof does not show the blinding factors are the same
+	proof = Prove(&H1, &H2, v, r, r)
+	assert.False(t, VerifySameBlinding(&H1, &H2, &C1, &C2, proof))
+
+	// Nor does a commitment to the same value under another blinding factor pass
+	r2 := pedersen.RandomSecret()
+	C2 = pedersen.CommitTo(&H2, r2, v)
+	proof = Prove(&H1, &H2, v, r, r2)
+	proof.S2 = proof.S1
+	assert.False(t, VerifySameBlinding(&H1, &H2, &C1, &C2, proof))
+}
@@ -0,0 +1,158 @@
+package feeproof
+
+import (
+	"fmt"
+	"math/big"
+	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/rangeproof"
+
+	"github.com/bwesterb/go-ristretto"
+)
+
+// Largest number of decimals of a rate; the numerator is a uint64
+const MaxRateDecimals = 18
+
+// Fee rate of Numerator / 10^Decimals, e.g. 25 with 4 decimals is 0.25%
+type Rate struct {
+	Numerator uint64 `json:"numerator"`
+	Decimals  uint8  `json:"decimals"`
+}
+
+// Proof that a committed fee f equals floor(a * rate) for a committed amount a.
+//
+// With a rate of R / 10^d, the remainder q = a R - f 10^d is committed to by
+// C_q = R C_a - 10^d C_f, which anyone can compute from the two commitments.
+// The fee is floor(a R / 10^d) exactly when 0 <= q < 10^d, shown by range
+// proofs on q and on 10^d - 1 - q. A range proof on the fee keeps every value
+// far below the group order, so the relation holds over the integers.
+//
+// The amount must be known to be in range by other means, e.g. its own range proof.
+type Proof struct {
+	Fee        rangeproof.Proof `json:"fee"`
+	Remainder  rangeproof.Proof `json:"remainder"`
+	Complement rangeproof.Proof `json:"complement"`
+}
+
+// Check that the rate is at most 100%
+func (r Rate) Validate() error {
+	if r.Decimals > MaxRateDecimals {
+		return fmt.Errorf("rate must have at most %d decimals, got %d", MaxRateDecimals, r.Decimals)
+	}
+	if new(big.Int).SetUint64(r.Numerator).Cmp(r.scale()) > 0 {
+		return fmt.Errorf("rate must not be more than 100%%")
+	}
+	return nil
+}
+
+// 10^Decimals
+func (r Rate) scale() *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(r.Decimals)), nil)
+}
+
+// Bit width of the range proofs on the remainder
+func (r Rate) remainderBits() int {
+	bits := new(big.Int).Sub(r.scale(), big.NewInt(1)).BitLen()
+	if bits == 0 {
+		// Without decimals the remainder must be 0, i.e. in [0, 2) with 0 - q in [0, 2)
+		return 1
+	}
+	return bits
+}
+
+// Fee owed on amount, rounded down. It has the denomination of the amount.
+func Fee(rate Rate, amount pedersen.Amount) (pedersen.Amount, error) {
+	err := rate.Validate()
+	if err != nil {
+		return pedersen.Amount{}, err
+	}
+	fee := new(big.Int).Mul(amount.Units(), new(big.Int).SetUint64(rate.Numerator))
+	fee.Quo(fee, rate.scale())
+	return amount.Denomination().FromUnits(fee)
+}
+
+// Prove that CommitTo(H, rFee, fee) is the fee on CommitTo(H, rAmount, amount)
+// Returns the fee along with the proof.
+func Prove(H *ristretto.Point, rate Rate, amount pedersen.Amount, rAmount, rFee *pedersen.Secret) (pedersen.Amount, Proof, error) {
+	fee, err := Fee(rate, amount)
+	if err != nil {
+		return pedersen.Amount{}, Proof{}, err
+	}
+
+	var proof Proof
+	proof.Fee, err = rangeproof.Prove(H, fee, rFee)
+	if err != nil {
+		return pedersen.Amount{}, Proof{}, fmt.Errorf("failed to prove the fee range: %v", err)
+	}
+
+	// q = a R - f 10^d, blinded by rAmount R - rFee 10^d
+	scale := rate.scale()
+	remainder := new(big.Int).Mul(amount.Units(), new(big.Int).SetUint64(rate.Numerator))
+	remainder.Sub(remainder, new(big.Int).Mul(fee.Units(), scale))
+	complement := new(big.Int).Sub(scale, big.NewInt(1))
+	complement.Sub(complement, remainder)
+
+	var rq, term ristretto.Scalar
+	defer rq.SetZero()
+	defer term.SetZero()
+	numerator, scaleScalar := rateScalars(rate)
+	rq.Mul(rAmount.Scalar(), &numerator)
+	rq.Sub(&rq, term.Mul(rFee.Scalar(), &scaleScalar))
+	remainderBlinding := pedersen.NewSecret(&rq)
+	defer remainderBlinding.Destroy()
+	complementBlinding := pedersen.NewSecret(term.Neg(&rq))
+	defer complementBlinding.Destroy()
+
+	denomination := pedersen.Denomination{Bits: rate.remainderBits()}
+	remainderAmount, err := denomination.FromUnits(remainder)
+	if err != nil {
+		return pedersen.Amount{}, Proof{}, err
+	}
+	complementAmount, err := denomination.FromUnits(complement)
+	if err != nil {
+		return pedersen.Amount{}, Proof{}, err
+	}
+	proof.Remainder, err = rangeproof.Prove(H, remainderAmount, remainderBlinding)
+	if err != nil {
+		return pedersen.Amount{}, Proof{}, err
+	}
+	proof.Complement, err = rangeproof.Prove(H, complementAmount, complementBlinding)
+	if err != nil {
+		return pedersen.Amount{}, Proof{}, err
+	}
+	return fee, proof, nil
+}
+
+// Verify that feeCommitment commits to the fee on amountCommitment at the
+// given rate, and that the fee fits in bits
+func Verify(H *ristretto.Point, rate Rate, amountCommitment, feeCommitment *ristretto.Point, bits int, proof Proof) bool {
+	if rate.Validate() != nil {
+		return false
+	}
+	if !rangeproof.Verify(H, feeCommitment, bits, proof.Fee) {
+		return false
+	}
+
+	numerator, scale := rateScalars(rate)
+	var remainder, scaledFee ristretto.Point
+	remainder.ScalarMult(amountCommitment, &numerator)
+	remainder.Sub(&remainder, scaledFee.ScalarMult(feeCommitment, &scale))
+
+	// (10^d - 1) H - C_q commits to 10^d - 1 - q
+	var maxRemainder ristretto.Scalar
+	var complement ristretto.Point
+	maxRemainder.Sub(&scale, new(ristretto.Scalar).SetOne())
+	complement.ScalarMult(H, &maxRemainder)
+	complement.Sub(&complement, &remainder)
+
+	remainderBits := rate.remainderBits()
+	return rangeproof.Verify(H, &remainder, remainderBits, proof.Remainder) &&
+		rangeproof.Verify(H, &complement, remainderBits, proof.Complement)
+}
+
+// The numerator and 10^Decimals as scalars
+func rateScalars(rate Rate) (ristretto.Scalar, ristretto.Scalar) {
+	var numerator, scale ristretto.Scalar
+	numerator.SetBigInt(new(big.Int).SetUint64(rate.Numerator))
+	scale.SetBigInt(rate.scale())
+	return numerator, scale
+}
@@ -0,0 +1,85 @@
+package feeproof
+
+import (
+	"pedersen-commitment-transfer/src/pedersen"
+	"testing"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/stretchr/testify/assert"
+)
+
+var testDenomination = pedersen.Denomination{Decimals: 2, Bits: 32}
+
+var _TestFees = []struct {
+	name   string
+	amount uint64
+	rate   Rate
+	fee    uint64
+}{
+	{name: "Exact", amount: 10000, rate: Rate{Numerator: 25, Decimals: 4}, fee: 25},
+	{name: "Rounded down", amount: 999, rate: Rate{Numerator: 25, Decimals: 4}, fee: 2},
+	{name: "Below one unit", amount: 10, rate: Rate{Numerator: 1, Decimals: 2}, fee: 0},
+	{name: "No decimals", amount: 7, rate: Rate{Numerator: 1, Decimals: 0}, fee: 7},
+	{name: "Zero rate", amount: 500, rate: Rate{Numerator: 0, Decimals: 3}, fee: 0},
+	{name: "Zero amount", amount: 0, rate: Rate{Numerator: 5, Decimals: 2}, fee: 0},
+}
+
+func TestProveVerify(t *testing.T) {
+	H := pedersen.GenerateH()
+
+	for _, testcase := range _TestFees {
+		t.Run(testcase.name, func(t *testing.T) {
+			amount, _ := testDenomination.FromUint64(testcase.amount)
+			rAmount := pedersen.RandomSecret()
+			rFee := pedersen.RandomSecret()
+
+			fee, proof, err := Prove(&H, testcase.rate, amount, rAmount, rFee)
+			assert.NoError(t, err)
+			assert.Equal(t, testcase.fee, fee.Units().Uint64())
+
+			amountCommitment := pedersen.CommitTo(&H, rAmount, amount)
+			feeCommitment := pedersen.CommitTo(&H, rFee, fee)
+			assert.True(t, Verify(&H, testcase.rate, &amountCommitment, &feeCommitment, testDenomination.Bits, proof), "Proof should verify")
+
+			otherRate := testcase.rate
+			otherRate.Numerator++
+			assert.False(t, Verify(&H, otherRate, &amountCommitment, &feeCommitment, testDenomination.Bits, proof), "Proof is bound to the rate")
+		})
+	}
+}
+
+// A fee one unit too low leaves a remainder of at least 10^d
+func TestWrongFee(t *testing.T) {
+	H := pedersen.GenerateH()
+	rate := Rate{Numerator: 150, Decimals: 3}
+	amount, _ := testDenomination.FromUint64(1000)
+	rAmount := pedersen.RandomSecret()
+	rFee := pedersen.RandomSecret()
+
+	fee, proof, err := Prove(&H, rate, amount, rAmount, rFee)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(150), fee.Units().Uint64())
+
+	amountCommitment := pedersen.CommitTo(&H, rAmount, amount)
+	lowerFee, _ := testDenomination.FromUint64(149)
+	lowerCommitment := pedersen.CommitTo(&H, rFee, lowerFee)
+	assert.False(t, Verify(&H, rate, &amountCommitment, &lowerCommitment, testDenomination.Bits, proof))
+
+	var B ristretto.Point
+	B.SetBase()
+	shifted := pedersen.Add(&amountCommitment, &B)
+	feeCommitment := pedersen.CommitTo(&H, rFee, fee)
+	assert.False(t, Verify(&H, rate, &shifted, &feeCommitment, testDenomination.Bits, proof), "Proof is bound to the amount commitment")
+}
+
+func TestInvalidRates(t *testing.T) {
+	amount, _ := testDenomination.FromUint64(100)
+	_, err := Fee(Rate{Numerator: 101, Decimals: 2}, amount)
+	assert.Error(t, err, "Rates above 100% are rejected")
+	_, err = Fee(Rate{Numerator: 1, Decimals: MaxRateDecimals + 1}, amount)
+	assert.Error(t, err)
+
+	fee, err := Fee(Rate{Numerator: 100, Decimals: 2}, amount)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, fee.Cmp(amount))
+}
@@ -0,0 +1,166 @@
+// Package musig implements MuSig2 n-of-n Schnorr multi-signatures.
+//
+// The public keys X_1..X_n of the signers aggregate into one key
+// X = sum a_i X_i, with a_i = H(L, X_i) for the list L of all keys, so no
+// signer can cancel out the others by choosing its key. Each signer
+// publishes two nonce points R_i1 = k_i1 B and R_i2 = k_i2 B. With the
+// aggregate nonces R_1 and R_2 and b = H(X, R_1, R_2, m), the final nonce
+// is R = R_1 + b R_2 and signer i answers s_i = k_i1 + b k_i2 + c a_i x_i
+// for c = schnorr.Challenge(R, X, m). The sum of the partial signatures is
+// an ordinary Schnorr signature (R, sum s_i) under X.
+package musig
+
+import (
+	"errors"
+	"pedersen-commitment-transfer/src/schnorr"
+	"pedersen-commitment-transfer/src/transcript"
+
+	"github.com/bwesterb/go-ristretto"
+)
+
+const keyListLabel = "pedersen-musig-keylist-v1"
+const keyCoefficientLabel = "pedersen-musig-keyagg-v1"
+const nonceCoefficientLabel = "pedersen-musig-nonce-v1"
+
+var ErrNonceUsed = errors.New("secret nonce has already been used")
+
+// Public nonce (R_1, R_2) of a signer, or the sum of the public nonces of all signers
+type PublicNonce struct {
+	R1 ristretto.Point `json:"r1"`
+	R2 ristretto.Point `json:"r2"`
+}
+
+// Secret nonce of a signer. It must be used for a single signature.
+type SecretNonce struct {
+	k1, k2 ristretto.Scalar
+	used   bool
+}
+
+// Aggregated public key of a list of signers
+type AggregateKey struct {
+	Key          ristretto.Point
+	keys         []ristretto.Point
+	coefficients []ristretto.Scalar
+}
+
+// Session of a signature on one message by the signers of an aggregate key
+type Session struct {
+	key *AggregateKey
+	b   ristretto.Scalar
+	R   ristretto.Point
+	c   ristretto.Scalar
+}
+
+// Aggregate the public keys of the signers; their order matters
+func AggregateKeys(keys []ristretto.Point) (*AggregateKey, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("at least one public key is required")
+	}
+	list := transcript.New(keyListLabel)
+	for i := range keys {
+		list.AppendPoints(&keys[i])
+	}
+	L := list.Challenge()
+
+	agg := &AggregateKey{
+		keys:         append([]ristretto.Point(nil), keys...),
+		coefficients: make([]ristretto.Scalar, len(keys)),
+	}
+	agg.Key.SetZero()
+	var term ristretto.Point
+	for i := range keys {
+		agg.coefficients[i] = transcript.New(keyCoefficientLabel).AppendScalars(&L).AppendPoints(&keys[i]).Challenge()
+		agg.Key.Add(&agg.Key, term.ScalarMult(&keys[i], &agg.coefficients[i]))
+	}
+	return agg, nil
+}
+
+// Generate a fresh nonce for one signing session
+func NewNonce() (*SecretNonce, PublicNonce) {
+	var secret SecretNonce
+	secret.k1.Rand()
+	secret.k2.Rand()
+	var public PublicNonce
+	public.R1.ScalarMultBase(&secret.k1)
+	public.R2.ScalarMultBase(&secret.k2)
+	return &secret, public
+}
+
+// Sum the public nonces of all signers
+func AggregateNonces(nonces []PublicNonce) PublicNonce {
+	var sum PublicNonce
+	sum.R1.SetZero()
+	sum.R2.SetZero()
+	for i := range nonces {
+		sum.R1.Add(&sum.R1, &nonces[i].R1)
+		sum.R2.Add(&sum.R2, &nonces[i].R2)
+	}
+	return sum
+}
+
+// Start a session to sign message with the aggregate of the signers' public nonces
+func NewSession(key *AggregateKey, nonce PublicNonce, message []byte) *Session {
+	session := &Session{key: key}
+	session.b = transcript.New(nonceCoefficientLabel).
+		AppendPoints(&key.Key, &nonce.R1, &nonce.R2).
+		AppendBytes(message).
+		Challenge()
+	var bR2 ristretto.Point
+	session.R.Add(&nonce.R1, bR2.ScalarMult(&nonce.R2, &session.b))
+	session.c = schnorr.Challenge(&session.R, &key.Key, message)
+	return session
+}
+
+// Partial signature of signer i with the secret key x and the signer's secret nonce
+// The nonce is erased, so it cannot be reused for another session.
+func (s *Session) Sign(i int, x *ristretto.Scalar, nonce *SecretNonce) (ristretto.Scalar, error) {
+	if nonce.used {
+		return ristretto.Scalar{}, ErrNonceUsed
+	}
+	if i < 0 || i >= len(s.key.keys) {
+		return ristretto.Scalar{}, errors.New("signer index out of range")
+	}
+	X := schnorr.PublicKey(x)
+	if !X.Equals(&s.key.keys[i]) {
+		return ristretto.Scalar{}, errors.New("secret key does not match the signer's public key")
+	}
+
+	// s_i = k_1 + b k_2 + c a_i x_i
+	var partial, cax ristretto.Scalar
+	defer cax.SetZero()
+	cax.Mul(&s.c, &s.key.coefficients[i])
+	cax.Mul(&cax, x)
+	partial.MulAdd(&s.b, &nonce.k2, &nonce.k1)
+	partial.Add(&partial, &cax)
+
+	nonce.k1.SetZero()
+	nonce.k2.SetZero()
+	nonce.used = true
+	return partial, nil
+}
+
+// Verify the partial signature of signer i, who published the public nonce
+func (s *Session) VerifyPartial(i int, nonce PublicNonce, partial *ristretto.Scalar) bool {
+	if i < 0 || i >= len(s.key.keys) {
+		return false
+	}
+	// s_i B = R_i1 + b R_i2 + c a_i X_i
+	var ca ristretto.Scalar
+	ca.Mul(&s.c, &s.key.coefficients[i])
+	var lhs, rhs, term ristretto.Point
+	lhs.ScalarMultBase(partial)
+	rhs.Add(&nonce.R1, term.ScalarMult(&nonce.R2, &s.b))
+	rhs.Add(&rhs, term.ScalarMult(&s.key.keys[i], &ca))
+	return lhs.Equals(&rhs)
+}
+
+// Combine the partial signatures of all signers into a Schnorr signature under the aggregate key
+func (s *Session) Aggregate(partials []ristretto.Scalar) schnorr.Signature {
+	var sig schnorr.Signature
+	sig.R = s.R
+	sig.S.SetZero()
+	for i := range partials {
+		sig.S.Add(&sig.S, &partials[i])
+	}
+	return sig
+}
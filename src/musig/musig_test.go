@@ -0,0 +1,102 @@
+package musig
+
+import (
+	"pedersen-commitment-transfer/src/schnorr"
+	"testing"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/stretchr/testify/assert"
+)
+
+// signers returns n secret keys and their public keys
+func signers(n int) ([]ristretto.Scalar, []ristretto.Point) {
+	secrets := make([]ristretto.Scalar, n)
+	keys := make([]ristretto.Point, n)
+	for i := range secrets {
+		secrets[i].Rand()
+		keys[i] = schnorr.PublicKey(&secrets[i])
+	}
+	return secrets, keys
+}
+
+func TestMultiSignature(t *testing.T) {
+	for _, n := range []int{1, 2, 5} {
+		secrets, keys := signers(n)
+		agg, err := AggregateKeys(keys)
+		assert.NoError(t, err)
+		message := []byte("spend")
+
+		secretNonces := make([]*SecretNonce, n)
+		publicNonces := make([]PublicNonce, n)
+		for i := range secretNonces {
+			secretNonces[i], publicNonces[i] = NewNonce()
+		}
+		session := NewSession(agg, AggregateNonces(publicNonces), message)
+
+		partials := make([]ristretto.Scalar, n)
+		for i := range partials {
+			partials[i], err = session.Sign(i, &secrets[i], secretNonces[i])
+			assert.NoError(t, err)
+			assert.True(t, session.VerifyPartial(i, publicNonces[i], &partials[i]), "Partial signature %d should verify", i)
+		}
+
+		sig := session.Aggregate(partials)
+		assert.True(t, schnorr.Verify(&agg.Key, message, sig), "Aggregate signature of %d signers should verify", n)
+		assert.False(t, schnorr.Verify(&agg.Key, []byte("other"), sig))
+	}
+}
+
+func TestMissingSigner(t *testing.T) {
+	secrets, keys := signers(3)
+	agg, err := AggregateKeys(keys)
+	assert.NoError(t, err)
+
+	secretNonces := make([]*SecretNonce, 3)
+	publicNonces := make([]PublicNonce, 3)
+	for i := range secretNonces {
+		secretNonces[i], publicNonces[i] = NewNonce()
+	}
+	session := NewSession(agg, AggregateNonces(publicNonces), []byte("spend"))
+
+	partials := make([]ristretto.Scalar, 2)
+	for i := range partials {
+		partials[i], err = session.Sign(i, &secrets[i], secretNonces[i])
+		assert.NoError(t, err)
+	}
+	assert.False(t, schnorr.Verify(&agg.Key, []byte("spend"), session.Aggregate(partials)))
+
+	// Signing for another signer's slot is refused
+	_, err = session.Sign(2, &secrets[0], secretNonces[2])
+	assert.Error(t, err)
+	assert.False(t, session.VerifyPartial(2, publicNonces[2], &partials[0]))
+}
+
+func TestNonceReuse(t *testing.T) {
+	secrets, keys := signers(2)
+	agg, err := AggregateKeys(keys)
+	assert.NoError(t, err)
+
+	nonce, public := NewNonce()
+	_, other := NewNonce()
+	session := NewSession(agg, AggregateNonces([]PublicNonce{public, other}), []byte("spend"))
+	_, err = session.Sign(0, &secrets[0], nonce)
+	assert.NoError(t, err)
+	_, err = session.Sign(0, &secrets[0], nonce)
+	assert.Equal(t, ErrNonceUsed, err)
+}
+
+func TestAggregateKeys(t *testing.T) {
+	_, err := AggregateKeys(nil)
+	assert.Error(t, err)
+
+	_, keys := signers(2)
+	agg, err := AggregateKeys(keys)
+	assert.NoError(t, err)
+	swapped, err := AggregateKeys([]ristretto.Point{keys[1], keys[0]})
+	assert.NoError(t, err)
+	assert.False(t, agg.Key.Equals(&swapped.Key), "Key order should matter")
+
+	var sum ristretto.Point
+	sum.Add(&keys[0], &keys[1])
+	assert.False(t, agg.Key.Equals(&sum), "Keys should be weighted by their coefficients")
+}
@@ -0,0 +1,46 @@
+package notes
+
+import (
+	"pedersen-commitment-transfer/src/pedersen"
+
+	"github.com/bwesterb/go-ristretto"
+)
+
+// Domains of the Pedersen hashes used by notes
+const (
+	noteDomain      = "note-commitment"
+	nullifierDomain = "note-nullifier"
+	spendDomain     = "note-spend"
+)
+
+// Note is an unspent output of the note-based (UTXO) mode.
+// Value is a Pedersen commitment to the amount; only the owner knows its opening.
+type Note struct {
+	Owner ristretto.Point `json:"owner"`
+	Value ristretto.Point `json:"value"`
+	Rho   []byte          `json:"rho"`
+}
+
+// Note commitment, i.e. the leaf appended to the note tree
+func (n *Note) Commitment() ristretto.Point {
+	data := append(n.Owner.Bytes(), n.Value.Bytes()...)
+	return pedersen.Hash(noteDomain, append(data, n.Rho...))
+}
+
+// Nullifier revealed when the note is spent.
+// It only depends on the note, so the same note can never be spent twice.
+func (n *Note) Nullifier() ristretto.Point {
+	cm := n.Commitment()
+	return pedersen.Hash(nullifierDomain, cm.Bytes())
+}
+
+// Message the owner signs to spend a note into the given outputs
+func SpendMessage(nullifier *ristretto.Point, outputs []Note) []byte {
+	data := nullifier.Bytes()
+	for i := range outputs {
+		cm := outputs[i].Commitment()
+		data = append(data, cm.Bytes()...)
+	}
+	hash := pedersen.Hash(spendDomain, data)
+	return hash.Bytes()
+}
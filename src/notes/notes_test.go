@@ -0,0 +1,71 @@
+package notes
+
+import (
+	"pedersen-commitment-transfer/src/pedersen"
+	"testing"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNoteCommitmentAndNullifier(t *testing.T) {
+	note := randomNote()
+	cm1 := note.Commitment()
+	cm2 := note.Commitment()
+	assert.True(t, cm1.Equals(&cm2), "Commitment should be deterministic")
+
+	other := note
+	other.Rho = []byte("another rho")
+	cmOther := other.Commitment()
+	assert.False(t, cm1.Equals(&cmOther))
+
+	nf := note.Nullifier()
+	nfOther := other.Nullifier()
+	assert.False(t, nf.Equals(&nfOther))
+	assert.False(t, nf.Equals(&cm1), "Nullifier should not reveal the commitment")
+}
+
+func TestFrontierMatchesTree(t *testing.T) {
+	frontier := NewFrontier()
+	var tree Tree
+	emptyRoot := tree.Root()
+	assert.True(t, frontier.Root.Equals(&emptyRoot), "Empty roots should match")
+
+	leaves := make([]ristretto.Point, 5)
+	for i := range leaves {
+		note := randomNote()
+		leaves[i] = note.Commitment()
+
+		position, err := frontier.Append(&leaves[i])
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(i), position)
+		_, err = tree.Append(&leaves[i])
+		assert.NoError(t, err)
+
+		root := tree.Root()
+		assert.True(t, frontier.Root.Equals(&root), "Roots should match after %d appends", i+1)
+	}
+
+	for i := range leaves {
+		path, err := tree.Path(uint64(i))
+		assert.NoError(t, err)
+		assert.True(t, VerifyPath(&frontier.Root, &leaves[i], uint64(i), path), "Path %d should verify", i)
+		assert.False(t, VerifyPath(&frontier.Root, &leaves[i], uint64(i+1), path), "Path %d should not verify elsewhere", i)
+	}
+
+	_, err := tree.Path(5)
+	assert.Error(t, err)
+}
+
+func randomNote() Note {
+	var x, rho ristretto.Scalar
+	x.Rand()
+	rho.Rand()
+	H := pedersen.GenerateH()
+	var note Note
+	note.Owner.ScalarMultBase(&x)
+	value, _ := pedersen.Denomination{Bits: 64}.FromUint64(10)
+	note.Value = pedersen.CommitTo(&H, pedersen.RandomSecret(), value)
+	note.Rho = rho.Bytes()
+	return note
+}
@@ -0,0 +1,160 @@
+package notes
+
+import (
+	"errors"
+	"fmt"
+	"pedersen-commitment-transfer/src/pedersen"
+	"sync"
+
+	"github.com/bwesterb/go-ristretto"
+)
+
+// Depth of the note tree, which holds up to 2^Depth notes
+const Depth = 20
+
+// Domains of the Pedersen hashes used by the tree
+const (
+	emptyLeafDomain = "note-tree-empty"
+	nodeDomain      = "note-tree-node"
+)
+
+var (
+	zerosOnce sync.Once
+	zeros     [Depth + 1]ristretto.Point
+)
+
+// Frontier is the incremental form of the note tree kept on chain.
+// It stores the rightmost filled node of every level, which is all that is
+// needed to append a leaf and compute the new root.
+type Frontier struct {
+	NextIndex uint64            `json:"nextIndex"`
+	Filled    []ristretto.Point `json:"filled"`
+	Root      ristretto.Point   `json:"root"`
+}
+
+// Frontier of the empty tree
+func NewFrontier() *Frontier {
+	z := emptyNodes()
+	return &Frontier{
+		Filled: append([]ristretto.Point{}, z[:Depth]...),
+		Root:   z[Depth],
+	}
+}
+
+// Append a leaf and return its position
+func (f *Frontier) Append(leaf *ristretto.Point) (uint64, error) {
+	if f.NextIndex >= 1<<Depth {
+		return 0, errors.New("note tree is full")
+	}
+	if len(f.Filled) != Depth {
+		return 0, fmt.Errorf("frontier must have %d levels, got %d", Depth, len(f.Filled))
+	}
+	z := emptyNodes()
+
+	position := f.NextIndex
+	current := *leaf
+	index := position
+	for level := 0; level < Depth; level++ {
+		if index%2 == 0 {
+			f.Filled[level] = current
+			current = node(&current, &z[level])
+		} else {
+			current = node(&f.Filled[level], &current)
+		}
+		index /= 2
+	}
+	f.Root = current
+	f.NextIndex++
+	return position, nil
+}
+
+// Verify that leaf sits at position in the tree with the given root.
+// path lists the siblings from the leaf level up.
+func VerifyPath(root, leaf *ristretto.Point, position uint64, path []ristretto.Point) bool {
+	if len(path) != Depth || position >= 1<<Depth {
+		return false
+	}
+	current := *leaf
+	for level := 0; level < Depth; level++ {
+		if position%2 == 0 {
+			current = node(&current, &path[level])
+		} else {
+			current = node(&path[level], &current)
+		}
+		position /= 2
+	}
+	return current.Equals(root)
+}
+
+// Tree keeps every leaf, so that wallets can compute membership paths.
+// Its root always matches the on-chain Frontier after the same appends.
+type Tree struct {
+	leaves []ristretto.Point
+}
+
+// Append a leaf and return its position
+func (t *Tree) Append(leaf *ristretto.Point) (uint64, error) {
+	if uint64(len(t.leaves)) >= 1<<Depth {
+		return 0, errors.New("note tree is full")
+	}
+	t.leaves = append(t.leaves, *leaf)
+	return uint64(len(t.leaves) - 1), nil
+}
+
+// Root of the tree
+func (t *Tree) Root() ristretto.Point {
+	root, _ := t.walk(0)
+	return root
+}
+
+// Membership path of the leaf at position
+func (t *Tree) Path(position uint64) ([]ristretto.Point, error) {
+	if position >= uint64(len(t.leaves)) {
+		return nil, fmt.Errorf("no leaf at position %d", position)
+	}
+	_, path := t.walk(position)
+	return path, nil
+}
+
+// Compute the root, collecting the siblings of position on the way up
+func (t *Tree) walk(position uint64) (ristretto.Point, []ristretto.Point) {
+	z := emptyNodes()
+	level := append([]ristretto.Point{}, t.leaves...)
+	path := make([]ristretto.Point, Depth)
+	for depth := 0; depth < Depth; depth++ {
+		if len(level)%2 == 1 {
+			level = append(level, z[depth])
+		}
+		if sibling := position ^ 1; sibling < uint64(len(level)) {
+			path[depth] = level[sibling]
+		} else {
+			path[depth] = z[depth]
+		}
+
+		parents := make([]ristretto.Point, len(level)/2)
+		for i := range parents {
+			parents[i] = node(&level[2*i], &level[2*i+1])
+		}
+		if len(parents) == 0 {
+			parents = []ristretto.Point{z[depth+1]}
+		}
+		level = parents
+		position /= 2
+	}
+	return level[0], path
+}
+
+func node(left, right *ristretto.Point) ristretto.Point {
+	return pedersen.Hash(nodeDomain, append(left.Bytes(), right.Bytes()...))
+}
+
+// Roots of the empty subtrees of every height
+func emptyNodes() *[Depth + 1]ristretto.Point {
+	zerosOnce.Do(func() {
+		zeros[0] = pedersen.Hash(emptyLeafDomain, nil)
+		for i := 0; i < Depth; i++ {
+			zeros[i+1] = node(&zeros[i], &zeros[i])
+		}
+	})
+	return &zeros
+}
@@ -0,0 +1,143 @@
+package pedersen
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/bwesterb/go-ristretto"
+)
+
+// Largest bit width of an amount. It keeps amounts, and sums of many of them,
+// far below the group order so that they never wrap around.
+const MaxAmountBits = 128
+
+var ErrDenominationMismatch = errors.New("amounts have different denominations")
+
+// Denomination describes the amounts of a token: the number of decimals of
+// its display unit and the bit width every amount must fit in.
+type Denomination struct {
+	Decimals uint8
+	Bits     int
+}
+
+// Amount is a non-negative number of base units that fits in the bit width
+// of its denomination. 1.5 tokens with 2 decimals is 150 base units.
+// Amounts are immutable; arithmetic returns new values. The zero value is
+// an amount of zero without a denomination.
+type Amount struct {
+	units        *big.Int
+	denomination Denomination
+}
+
+// Check that the bit width is usable
+func (d Denomination) Validate() error {
+	if d.Bits <= 0 || d.Bits > MaxAmountBits {
+		return fmt.Errorf("bit width must be between 1 and %d, got %d", MaxAmountBits, d.Bits)
+	}
+	return nil
+}
+
+// Amount of the given number of base units
+func (d Denomination) FromUnits(units *big.Int) (Amount, error) {
+	err := d.Validate()
+	if err != nil {
+		return Amount{}, err
+	}
+	if units.Sign() < 0 {
+		return Amount{}, errors.New("amount must not be negative")
+	}
+	if units.BitLen() > d.Bits {
+		return Amount{}, fmt.Errorf("amount does not fit in %d bits", d.Bits)
+	}
+	return Amount{units: new(big.Int).Set(units), denomination: d}, nil
+}
+
+// Amount of the given number of base units
+func (d Denomination) FromUint64(units uint64) (Amount, error) {
+	return d.FromUnits(new(big.Int).SetUint64(units))
+}
+
+// Parse a decimal amount in display units, e.g. "12.5" with 2 decimals is
+// 1250 base units. More fractional digits than decimals is an error.
+func (d Denomination) Parse(s string) (Amount, error) {
+	whole, fraction, _ := strings.Cut(s, ".")
+	if whole == "" && fraction == "" {
+		return Amount{}, fmt.Errorf("invalid amount %q", s)
+	}
+	if len(fraction) > int(d.Decimals) {
+		return Amount{}, fmt.Errorf("amount %q has more than %d decimals", s, d.Decimals)
+	}
+	digits := whole + fraction + strings.Repeat("0", int(d.Decimals)-len(fraction))
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return Amount{}, fmt.Errorf("invalid amount %q", s)
+		}
+	}
+	units, _ := new(big.Int).SetString(digits, 10)
+	return d.FromUnits(units)
+}
+
+// Number of base units
+func (a Amount) Units() *big.Int {
+	if a.units == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(a.units)
+}
+
+func (a Amount) Denomination() Denomination {
+	return a.denomination
+}
+
+// Bit width the amount is guaranteed to fit in
+func (a Amount) Bits() int {
+	return a.denomination.Bits
+}
+
+func (a Amount) IsZero() bool {
+	return a.units == nil || a.units.Sign() == 0
+}
+
+// Compare the number of base units of two amounts
+func (a Amount) Cmp(b Amount) int {
+	return a.Units().Cmp(b.Units())
+}
+
+// Sum of two amounts of the same denomination; fails if it overflows the bit width
+func (a Amount) Add(b Amount) (Amount, error) {
+	if a.denomination != b.denomination {
+		return Amount{}, ErrDenominationMismatch
+	}
+	return a.denomination.FromUnits(new(big.Int).Add(a.Units(), b.Units()))
+}
+
+// Difference of two amounts of the same denomination; fails if it is negative
+func (a Amount) Sub(b Amount) (Amount, error) {
+	if a.denomination != b.denomination {
+		return Amount{}, ErrDenominationMismatch
+	}
+	return a.denomination.FromUnits(new(big.Int).Sub(a.Units(), b.Units()))
+}
+
+// Amount in display units, e.g. "12.50" for 1250 base units with 2 decimals
+func (a Amount) String() string {
+	digits := a.Units().String()
+	decimals := int(a.denomination.Decimals)
+	if decimals == 0 {
+		return digits
+	}
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+	return digits[:len(digits)-decimals] + "." + digits[len(digits)-decimals:]
+}
+
+// The amount as a scalar. It is smaller than 2^MaxAmountBits, so the
+// conversion never reduces modulo the group order.
+func (a Amount) secret() *Secret {
+	var inner ristretto.Scalar
+	inner.SetBigInt(a.Units())
+	return &Secret{s: &inner}
+}
@@ -0,0 +1,86 @@
+package pedersen
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var _TestParseAmounts = []struct {
+	name     string
+	input    string
+	decimals uint8
+	bits     int
+	units    string
+	display  string
+	isError  bool
+}{
+	{name: "Whole", input: "12", decimals: 2, bits: 64, units: "1200", display: "12.00"},
+	{name: "Fraction", input: "12.5", decimals: 2, bits: 64, units: "1250", display: "12.50"},
+	{name: "Below one", input: "0.07", decimals: 2, bits: 64, units: "7", display: "0.07"},
+	{name: "No decimals", input: "42", decimals: 0, bits: 64, units: "42", display: "42"},
+	{name: "128 bits", input: "340282366920938463463374607431768211455", decimals: 0, bits: 128, units: "340282366920938463463374607431768211455", display: "340282366920938463463374607431768211455"},
+	{name: "Too many decimals", input: "1.234", decimals: 2, bits: 64, isError: true},
+	{name: "Negative", input: "-1", decimals: 2, bits: 64, isError: true},
+	{name: "Not a number", input: "1e5", decimals: 2, bits: 64, isError: true},
+	{name: "Empty", input: "", decimals: 2, bits: 64, isError: true},
+	{name: "Overflow", input: "2.56", decimals: 2, bits: 8, isError: true},
+	{name: "Invalid bit width", input: "1", decimals: 0, bits: 129, isError: true},
+}
+
+func TestParseAmount(t *testing.T) {
+	for _, testcase := range _TestParseAmounts {
+		t.Run(testcase.name, func(t *testing.T) {
+			denomination := Denomination{Decimals: testcase.decimals, Bits: testcase.bits}
+			amount, err := denomination.Parse(testcase.input)
+			if testcase.isError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, testcase.units, amount.Units().String())
+			assert.Equal(t, testcase.display, amount.String())
+			assert.Equal(t, denomination, amount.Denomination())
+		})
+	}
+}
+
+func TestAmountArithmetic(t *testing.T) {
+	a := mustAmount(t, 150)
+	b := mustAmount(t, 50)
+
+	sum, err := a.Add(b)
+	assert.NoError(t, err)
+	assert.Equal(t, "2.00", sum.String())
+
+	dif, err := a.Sub(b)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, dif.Cmp(b))
+
+	_, err = b.Sub(a)
+	assert.Error(t, err)
+
+	assert.True(t, Amount{}.IsZero())
+	assert.False(t, a.IsZero())
+}
+
+// Values above the bit width used to be reduced modulo the group order
+func TestAmountNoWrapAround(t *testing.T) {
+	denomination := Denomination{Decimals: 0, Bits: MaxAmountBits}
+	_, err := denomination.FromUnits(new(big.Int).Add(n25519, big.NewInt(5)))
+	assert.Error(t, err)
+	_, err = denomination.FromUnits(big.NewInt(-5))
+	assert.Error(t, err)
+
+	largest := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), MaxAmountBits), big.NewInt(1))
+	amount, err := denomination.FromUnits(largest)
+	assert.NoError(t, err)
+
+	H := GenerateH()
+	r := RandomSecret()
+	committed := CommitTo(&H, r, amount)
+	assert.True(t, Validate(amount, committed, H, r))
+	other, _ := denomination.FromUnits(new(big.Int).Sub(largest, big.NewInt(1)))
+	assert.False(t, Validate(other, committed, H, r))
+}
@@ -0,0 +1,120 @@
+package pedersen
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/bwesterb/go-ristretto"
+)
+
+// Number of openings a worker commits to before checking for cancellation
+const batchChunkSize = 64
+
+// Params are the public parameters of the commitment scheme, with a
+// precomputed fixed-base table for H so that repeated commitments are cheaper.
+// B already uses the fixed-base table built into go-ristretto.
+type Params struct {
+	H      ristretto.Point
+	hTable ristretto.ScalarMultTable
+}
+
+// Opening of a commitment: the committed value and its blinding factor
+type Opening struct {
+	Value    Amount
+	Blinding *Secret
+}
+
+// Options of CommitBatch
+type BatchOption func(*batchConfig)
+
+type batchConfig struct {
+	workers int
+}
+
+// Precompute the parameters for the secondary point H
+func NewParams(H *ristretto.Point) *Params {
+	params := &Params{H: *H}
+	params.hTable.Compute(H)
+	return params
+}
+
+// Commit to x with blinding factor r; same result as CommitTo(&p.H, r, x)
+func (p *Params) Commit(r *Secret, x Amount) ristretto.Point {
+	value := x.secret()
+	defer value.Destroy()
+	var result, rPoint, xPoint ristretto.Point
+	rPoint.ScalarMultBase(r.Scalar())
+	xPoint.ScalarMultTable(&p.hTable, value.Scalar())
+	result.Add(&rPoint, &xPoint)
+	return result
+}
+
+// Run the batch on the given number of goroutines (default: GOMAXPROCS)
+func WithWorkers(workers int) BatchOption {
+	return func(config *batchConfig) {
+		config.workers = workers
+	}
+}
+
+// Commit to every opening, spreading the work over a pool of goroutines.
+// Results are returned in the order of the openings. If ctx is cancelled
+// before all the work is handed out, no results are returned and ctx.Err() is.
+//
+// go-ristretto has no multi-scalar multiplication, so every commitment is
+// computed with the fixed-base tables of B and H.
+func CommitBatch(ctx context.Context, params *Params, openings []Opening, options ...BatchOption) ([]ristretto.Point, error) {
+	config := batchConfig{workers: runtime.GOMAXPROCS(0)}
+	for _, option := range options {
+		option(&config)
+	}
+	if config.workers <= 0 {
+		return nil, fmt.Errorf("number of workers must be positive, got %d", config.workers)
+	}
+	for i := range openings {
+		if openings[i].Blinding == nil {
+			return nil, fmt.Errorf("opening %d is incomplete", i)
+		}
+	}
+
+	results := make([]ristretto.Point, len(openings))
+	chunks := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < config.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := range chunks {
+				end := start + batchChunkSize
+				if end > len(openings) {
+					end = len(openings)
+				}
+				for i := start; i < end; i++ {
+					results[i] = params.Commit(openings[i].Blinding, openings[i].Value)
+				}
+			}
+		}()
+	}
+
+	var err error
+dispatch:
+	for start := 0; start < len(openings); start += batchChunkSize {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		select {
+		case chunks <- start:
+		case <-ctx.Done():
+			err = ctx.Err()
+			break dispatch
+		}
+	}
+	close(chunks)
+	wg.Wait()
+
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
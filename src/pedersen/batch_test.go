@@ -0,0 +1,67 @@
+package pedersen
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var _TestBatchSizes = []struct {
+	name    string
+	size    int
+	workers int
+}{
+	{name: "Empty", size: 0, workers: 2},
+	{name: "Single worker", size: 100, workers: 1},
+	{name: "More workers than chunks", size: 10, workers: 8},
+	{name: "Several chunks", size: 500, workers: 4},
+}
+
+func TestCommitBatch(t *testing.T) {
+	H := GenerateH()
+	params := NewParams(&H)
+
+	for _, testcase := range _TestBatchSizes {
+		t.Run(testcase.name, func(t *testing.T) {
+			openings := make([]Opening, testcase.size)
+			for i := range openings {
+				openings[i] = Opening{Value: mustAmount(t, uint64(i)), Blinding: RandomSecret()}
+			}
+
+			results, err := CommitBatch(context.Background(), params, openings, WithWorkers(testcase.workers))
+			assert.NoError(t, err)
+			assert.Len(t, results, testcase.size)
+			for i := range openings {
+				expected := CommitTo(&H, openings[i].Blinding, openings[i].Value)
+				assert.True(t, results[i].Equals(&expected), "Commitment %d out of order", i)
+			}
+		})
+	}
+}
+
+func TestCommitBatchCancelled(t *testing.T) {
+	H := GenerateH()
+	params := NewParams(&H)
+	openings := make([]Opening, 1000)
+	for i := range openings {
+		openings[i] = Opening{Value: mustAmount(t, 1), Blinding: RandomSecret()}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err := CommitBatch(ctx, params, openings)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, results)
+}
+
+func TestCommitBatchErrors(t *testing.T) {
+	H := GenerateH()
+	params := NewParams(&H)
+
+	_, err := CommitBatch(context.Background(), params, []Opening{{Value: mustAmount(t, 1)}})
+	assert.EqualError(t, err, "opening 0 is incomplete")
+
+	_, err = CommitBatch(context.Background(), params, nil, WithWorkers(0))
+	assert.EqualError(t, err, "number of workers must be positive, got 0")
+}
@@ -0,0 +1,51 @@
+package pedersen
+
+import (
+	"encoding/binary"
+
+	"github.com/bwesterb/go-ristretto"
+)
+
+// Size of the chunks the input of Hash is split into. 31 bytes always fit
+// in a scalar without reduction, so distinct chunks give distinct scalars.
+const hashChunkSize = 31
+
+// Pedersen hash of data under the given domain.
+//
+// The data is split in 31-byte chunks m_1..m_k and hashed to
+// G_0 + len(data) G_1 + sum(m_i G_{i+1}), where the generators G_i are derived from
+// the domain and have no known discrete logarithm with respect to each other.
+// Finding a collision is as hard as computing such a discrete logarithm.
+func Hash(domain string, data []byte) ristretto.Point {
+	var result, term ristretto.Point
+	var length, chunk ristretto.Scalar
+
+	result = hashGenerator(domain, 0)
+	G := hashGenerator(domain, 1)
+	result.Add(&result, term.ScalarMult(&G, length.SetUint64(uint64(len(data)))))
+
+	for i := 0; i*hashChunkSize < len(data); i++ {
+		end := (i + 1) * hashChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		var buf [32]byte
+		copy(buf[:], data[i*hashChunkSize:end])
+		chunk.SetBytes(&buf)
+
+		G = hashGenerator(domain, i+2)
+		result.Add(&result, term.ScalarMult(&G, &chunk))
+	}
+	return result
+}
+
+func hashGenerator(domain string, index int) ristretto.Point {
+	seed := []byte("pedersen-hash-v1")
+	seed = binary.BigEndian.AppendUint64(seed, uint64(len(domain)))
+	seed = append(seed, domain...)
+	seed = binary.BigEndian.AppendUint64(seed, uint64(index))
+
+	var G ristretto.Point
+	G.Derive(seed)
+	return G
+}
@@ -0,0 +1,51 @@
+package pedersen
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var _TestHashInputs = []struct {
+	name  string
+	data  []byte
+	other []byte
+}{
+	{
+		name:  "Different content",
+		data:  []byte("note-1"),
+		other: []byte("note-2"),
+	},
+	{
+		name:  "Trailing zero",
+		data:  []byte{1, 2, 3},
+		other: []byte{1, 2, 3, 0},
+	},
+	{
+		name:  "Chunk boundary",
+		data:  bytes.Repeat([]byte{7}, 31),
+		other: bytes.Repeat([]byte{7}, 32),
+	},
+	{
+		name:  "Empty input",
+		data:  []byte{},
+		other: []byte{0},
+	},
+}
+
+func TestHash(t *testing.T) {
+	for _, testcase := range _TestHashInputs {
+		t.Run(testcase.name, func(t *testing.T) {
+			h1 := Hash("test", testcase.data)
+			h2 := Hash("test", testcase.data)
+			assert.True(t, h1.Equals(&h2), "Hash should be deterministic")
+
+			other := Hash("test", testcase.other)
+			assert.False(t, h1.Equals(&other), "Different inputs should not collide")
+
+			otherDomain := Hash("test2", testcase.data)
+			assert.False(t, h1.Equals(&otherDomain), "Domains should be separated")
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package pedersen
 
 import (
+	"encoding/binary"
 	"math/big"
 
 	"github.com/bwesterb/go-ristretto"
@@ -13,11 +14,13 @@ var n25519, _ = new(big.Int).SetString("7237005577332262213973186563042994240857
 // H - Random secondary point on the curve
 // r - Private key used as blinding factor
 // x - The value (number of tokens)
-func CommitTo(H *ristretto.Point, r, x *ristretto.Scalar) ristretto.Point {
+func CommitTo(H *ristretto.Point, r *Secret, x Amount) ristretto.Point {
 	//ec.g.mul(r).add(H.mul(x));
+	value := x.secret()
+	defer value.Destroy()
 	var result, rPoint, transferPoint ristretto.Point
-	rPoint.ScalarMultBase(r) //si genera r*rPoint -> r volte rPoint
-	transferPoint.ScalarMult(H, x)
+	rPoint.ScalarMultBase(r.Scalar()) //si genera r*rPoint -> r volte rPoint
+	transferPoint.ScalarMult(H, value.Scalar())
 	result.Add(&rPoint, &transferPoint)
 	return result
 }
@@ -31,6 +34,18 @@ func GenerateH() ristretto.Point {
 	return H
 }
 
+// Derive H from a domain such as the token name. Unlike GenerateH, nobody
+// knows the discrete logarithm of the result with respect to the base point.
+func DeriveH(domain string) ristretto.Point {
+	seed := []byte("pedersen-h-v1")
+	seed = binary.BigEndian.AppendUint64(seed, uint64(len(domain)))
+	seed = append(seed, domain...)
+
+	var H ristretto.Point
+	H.Derive(seed)
+	return H
+}
+
 // Subtract two commitments using homomorphic encryption
 func Sub(cX, cY *ristretto.Point) ristretto.Point {
 	var subPoint ristretto.Point
@@ -43,22 +58,20 @@ func Sub(cX, cY *ristretto.Point) ristretto.Point {
 //	and compute the committed value
 //	add rX - rY (blinding factor private keys)
 //	add vX - vY (hidden values)
-func SubPrivately(H *ristretto.Point, rX, rY *ristretto.Scalar, vX, vY *big.Int) ristretto.Point {
+//
+// It fails if vY is larger than vX.
+func SubPrivately(H *ristretto.Point, rX, rY *Secret, vX, vY Amount) (ristretto.Point, error) {
+	value, err := vX.Sub(vY)
+	if err != nil {
+		return ristretto.Point{}, err
+	}
 	var rDif ristretto.Scalar
-	var vDif big.Int
-	rDif.Sub(rY, rX)
-	vDif.Sub(vX, vY)
-	vDif.Mod(&vDif, n25519)
-
-	var vScalar ristretto.Scalar
-	var rPoint ristretto.Point
-	vScalar.SetBigInt(&vDif)
+	defer rDif.SetZero()
+	rDif.Sub(rY.Scalar(), rX.Scalar())
+	blinding := NewSecret(&rDif)
+	defer blinding.Destroy()
 
-	rPoint.ScalarMultBase(&rDif)
-	var vPoint, result ristretto.Point
-	vPoint.ScalarMult(H, &vScalar)
-	result.Add(&rPoint, &vPoint)
-	return result
+	return CommitTo(H, blinding, value), nil
 }
 
 // Add two commitments using homomorphic encryption
@@ -73,33 +86,25 @@ func Add(cX, cY *ristretto.Point) ristretto.Point {
 //	and compute the committed value
 //	add rX + rY (blinding factor private keys)
 //	add vX + vY (hidden values)
-func AddPrivately(H *ristretto.Point, rX, rY *ristretto.Scalar, vX, vY *big.Int) ristretto.Point {
+//
+// It fails if the sum does not fit in the bit width of the amounts.
+func AddPrivately(H *ristretto.Point, rX, rY *Secret, vX, vY Amount) (ristretto.Point, error) {
+	value, err := vX.Add(vY)
+	if err != nil {
+		return ristretto.Point{}, err
+	}
 	var rDif ristretto.Scalar
-	var vDif big.Int
-	rDif.Add(rY, rX)
-	vDif.Add(vX, vY)
-	vDif.Mod(&vDif, n25519)
-
-	var vScalar ristretto.Scalar
-	var rPoint ristretto.Point
-	vScalar.SetBigInt(&vDif)
+	defer rDif.SetZero()
+	rDif.Add(rY.Scalar(), rX.Scalar())
+	blinding := NewSecret(&rDif)
+	defer blinding.Destroy()
 
-	rPoint.ScalarMultBase(&rDif)
-	var vPoint, result ristretto.Point
-	vPoint.ScalarMult(H, &vScalar)
-	result.Add(&rPoint, &vPoint)
-	return result
+	return CommitTo(H, blinding, value), nil
 }
 
-func Validate(x int64, committedAmount ristretto.Point, H ristretto.Point, rX ristretto.Scalar) bool {
-	var vX ristretto.Scalar
-	value := big.NewInt(x)
-
-	committedValue := CommitTo(&H, &rX, vX.SetBigInt(value))
-
-	if committedAmount.Equals(&committedValue) {
-		return true
-	} else {
-		return false
-	}
+// Check that committedAmount opens to x with blinding factor rX.
+// The comparison runs in constant time.
+func Validate(x Amount, committedAmount ristretto.Point, H ristretto.Point, rX *Secret) bool {
+	committedValue := CommitTo(&H, rX, x)
+	return committedAmount.EqualsI(&committedValue) == 1
 }
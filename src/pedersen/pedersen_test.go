@@ -1,20 +1,19 @@
 package pedersen
 
 import (
-	"math/big"
 	"testing"
 
 	"github.com/bwesterb/go-ristretto"
 	"github.com/stretchr/testify/assert"
 )
 
-//TODO: this implementation of pedersen uses signed integers, hence we can have a negative commitment after subtraction
-//TODO: check if valid on wallet/client side, raise error there otherwise trigger smart contract method
+var testDenomination = Denomination{Decimals: 2, Bits: 64}
+
 var _TestCommittedValues = []struct {
 	name    string
 	H       ristretto.Point
-	amount1 int64
-	amount2 int64
+	amount1 uint64
+	amount2 uint64
 	isError bool
 }{
 	{
@@ -37,18 +36,17 @@ func TestAddCommittedValues(t *testing.T) {
 
 	for _, testcase := range _TestCommittedValues {
 
-		var rX, rY, vX, vY ristretto.Scalar
 		H1 := GenerateH() // Secondary point on the Curve
 
 		// Commit amount1
-		rX.Rand()
-		amount1 := big.NewInt(testcase.amount1)
-		amount1Committed := CommitTo(&H1, &rX, vX.SetBigInt(amount1))
+		rX := RandomSecret()
+		amount1 := mustAmount(t, testcase.amount1)
+		amount1Committed := CommitTo(&H1, rX, amount1)
 
 		// Commit amount2
-		rY.Rand()
-		amount2 := big.NewInt(testcase.amount2)
-		amount2Committed := CommitTo(&H1, &rY, vY.SetBigInt(amount2))
+		rY := RandomSecret()
+		amount2 := mustAmount(t, testcase.amount2)
+		amount2Committed := CommitTo(&H1, rY, amount2)
 
 		//Check committed values are different
 		assert.NotEqual(t, amount1Committed, amount2Committed, "Should not be equal")
@@ -62,11 +60,13 @@ func TestAddCommittedValues(t *testing.T) {
 		if testcase.isError {
 			H2 = testcase.H
 			//Check that sum was correct
-			checkSumCommitted := AddPrivately(&H2, &rY, &rX, amount1, amount2)
+			checkSumCommitted, err := AddPrivately(&H2, rY, rX, amount1, amount2)
+			assert.NoError(t, err)
 			assert.False(t, checkSumCommitted.Equals(&sumCommitted), "Should not be equal")
 		} else {
 			H2 = H1
-			checksumCommitted := AddPrivately(&H2, &rY, &rX, amount1, amount2)
+			checksumCommitted, err := AddPrivately(&H2, rY, rX, amount1, amount2)
+			assert.NoError(t, err)
 			assert.True(t, checksumCommitted.Equals(&sumCommitted), "Should be equal")
 		}
 	}
@@ -75,19 +75,18 @@ func TestAddCommittedValues(t *testing.T) {
 func TestSubCommittedValues(t *testing.T) {
 
 	for _, testcase := range _TestCommittedValues {
-		var rX, rY, vX, vY ristretto.Scalar
-		rX.Rand()
+		rX := RandomSecret()
 		H1 := GenerateH() // Secondary point on the Curve
 		var H2 ristretto.Point
 
-		amount1 := big.NewInt(testcase.amount1)
+		amount1 := mustAmount(t, testcase.amount1)
 
 		// Transfer amount of 5 tokens
-		amount1Committed := CommitTo(&H1, &rX, vX.SetBigInt(amount1)) //5 encrypted tokens
+		amount1Committed := CommitTo(&H1, rX, amount1) //5 encrypted tokens
 
-		rY.Rand()
-		amount2 := big.NewInt(testcase.amount2)
-		amount2Committed := CommitTo(&H1, &rY, vY.SetBigInt(amount2))
+		rY := RandomSecret()
+		amount2 := mustAmount(t, testcase.amount2)
+		amount2Committed := CommitTo(&H1, rY, amount2)
 		assert.NotEqual(t, amount1Committed, amount2Committed, "Should not be equal")
 
 		var difCommitted ristretto.Point
@@ -95,11 +94,13 @@ func TestSubCommittedValues(t *testing.T) {
 
 		if testcase.isError {
 			H2 = testcase.H
-			checkdifCommitted := SubPrivately(&H2, &rY, &rX, amount1, amount2)
+			checkdifCommitted, err := SubPrivately(&H2, rY, rX, amount1, amount2)
+			assert.NoError(t, err)
 			assert.False(t, checkdifCommitted.Equals(&difCommitted), "Should not be equal")
 		} else {
 			H2 = H1
-			checkdifCommitted := SubPrivately(&H2, &rY, &rX, amount1, amount2)
+			checkdifCommitted, err := SubPrivately(&H2, rY, rX, amount1, amount2)
+			assert.NoError(t, err)
 			assert.True(t, checkdifCommitted.Equals(&difCommitted), "Should be equal")
 		}
 	}
@@ -107,3 +108,38 @@ func TestSubCommittedValues(t *testing.T) {
 
 //Note that Add/SubPrivately are built so that the private keys in the signature are swapped out, i.e. rY,rX.
 //Addition is invariant to that, but subtraction is affected.
+
+func TestPrivateArithmeticBounds(t *testing.T) {
+	H := GenerateH()
+	rX := RandomSecret()
+	rY := RandomSecret()
+
+	_, err := SubPrivately(&H, rY, rX, mustAmount(t, 5), mustAmount(t, 10))
+	assert.Error(t, err, "Negative differences should not wrap around")
+
+	small := Denomination{Decimals: 0, Bits: 8}
+	a, _ := small.FromUint64(200)
+	b, _ := small.FromUint64(100)
+	_, err = AddPrivately(&H, rY, rX, a, b)
+	assert.Error(t, err, "Sums should not overflow the bit width")
+
+	_, err = AddPrivately(&H, rY, rX, a, mustAmount(t, 1))
+	assert.ErrorIs(t, err, ErrDenominationMismatch)
+}
+
+func mustAmount(t *testing.T, units uint64) Amount {
+	amount, err := testDenomination.FromUint64(units)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return amount
+}
+
+func TestDeriveH(t *testing.T) {
+	H := DeriveH("token")
+	other := DeriveH("token2")
+	again := DeriveH("token")
+	assert.True(t, H.Equals(&again), "Derivation should be deterministic")
+	assert.False(t, H.Equals(&other), "Domains should give different points")
+	assert.NoError(t, ValidateParams(&H))
+}
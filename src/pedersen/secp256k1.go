@@ -0,0 +1,265 @@
+package pedersen
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Pedersen commitments over secp256k1 in the format of libsecp256k1-zkp,
+// as used by Elements confidential transactions.
+//
+// A commitment to value v with blinding factor r under the generator H is
+// rG + vH. It is serialized as 33 bytes: 0x08 if the y coordinate is a
+// quadratic residue, 0x09 otherwise, followed by the big-endian x coordinate.
+// Generators use 0x0a and 0x0b the same way. Blinding factors are 32-byte
+// big-endian scalars and values are 64-bit, as in libsecp256k1-zkp.
+//
+// The arithmetic uses math/big and is not constant time. It is meant for
+// verifying commitments coming from other ledgers, not for handling
+// blinding factors that must stay secret on this host.
+
+var (
+	secpP, _  = new(big.Int).SetString("fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f", 16)
+	secpN, _  = new(big.Int).SetString("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141", 16)
+	secpGx, _ = new(big.Int).SetString("79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798", 16)
+	secpGy, _ = new(big.Int).SetString("483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8", 16)
+	secpHx, _ = new(big.Int).SetString("50929b74c1a04954b78b4b6035e97a5e078a5a0f28ec96d547bfee9ace803ac0", 16)
+	secpHy, _ = new(big.Int).SetString("31d3c6863973926e049e637cb1b5f40a36dac28af1766968c30c2313f3a38904", 16)
+)
+
+// Prefixes of the serialized commitments and generators
+const (
+	secpCommitmentPrefix = 0x08
+	secpGeneratorPrefix  = 0x0a
+)
+
+// Largest number of bits of a value committed to on secp256k1
+const SecpValueBits = 64
+
+// Affine point of secp256k1. The zero value is the point at infinity.
+type SecpPoint struct {
+	x, y *big.Int
+}
+
+// Pedersen commitment on secp256k1
+type SecpCommitment struct {
+	p SecpPoint
+}
+
+// The base point G of secp256k1
+func SecpG() SecpPoint {
+	return SecpPoint{new(big.Int).Set(secpGx), new(big.Int).Set(secpGy)}
+}
+
+// The generator H of libsecp256k1-zkp, whose x coordinate is the SHA-256 of the
+// uncompressed encoding of G. Elements uses it for explicit assets.
+func SecpH() SecpPoint {
+	return SecpPoint{new(big.Int).Set(secpHx), new(big.Int).Set(secpHy)}
+}
+
+func (P SecpPoint) IsInfinity() bool {
+	return P.x == nil
+}
+
+func (P SecpPoint) Equal(Q SecpPoint) bool {
+	if P.IsInfinity() || Q.IsInfinity() {
+		return P.IsInfinity() == Q.IsInfinity()
+	}
+	return P.x.Cmp(Q.x) == 0 && P.y.Cmp(Q.y) == 0
+}
+
+// Parse a generator in the 33-byte libsecp256k1-zkp format
+func ParseSecpGenerator(data []byte) (SecpPoint, error) {
+	return parseSecpPoint(data, secpGeneratorPrefix)
+}
+
+// Serialize a generator in the 33-byte libsecp256k1-zkp format
+func (P SecpPoint) GeneratorBytes() ([]byte, error) {
+	return serializeSecpPoint(P, secpGeneratorPrefix)
+}
+
+// Commit to value with the blinding factor blind under the generator H
+// As in libsecp256k1-zkp, blind must be below the group order and the value must fit in 64 bits.
+func SecpCommit(H SecpPoint, blind [32]byte, value Amount) (SecpCommitment, error) {
+	if H.IsInfinity() {
+		return SecpCommitment{}, errors.New("generator must not be the point at infinity")
+	}
+	units := value.Units()
+	if units.BitLen() > SecpValueBits {
+		return SecpCommitment{}, fmt.Errorf("value does not fit in %d bits", SecpValueBits)
+	}
+	r := new(big.Int).SetBytes(blind[:])
+	if r.Cmp(secpN) >= 0 {
+		return SecpCommitment{}, errors.New("blinding factor overflows the group order")
+	}
+
+	C := secpAdd(secpScalarMult(SecpG(), r), secpScalarMult(H, units))
+	if C.IsInfinity() {
+		return SecpCommitment{}, errors.New("commitment is the point at infinity")
+	}
+	return SecpCommitment{C}, nil
+}
+
+// Parse a commitment in the 33-byte libsecp256k1-zkp format
+func ParseSecpCommitment(data []byte) (SecpCommitment, error) {
+	P, err := parseSecpPoint(data, secpCommitmentPrefix)
+	if err != nil {
+		return SecpCommitment{}, err
+	}
+	return SecpCommitment{P}, nil
+}
+
+// Serialize the commitment in the 33-byte libsecp256k1-zkp format
+func (C SecpCommitment) Bytes() []byte {
+	data, _ := serializeSecpPoint(C.p, secpCommitmentPrefix)
+	return data
+}
+
+func (C SecpCommitment) Point() SecpPoint {
+	return C.p
+}
+
+func (C SecpCommitment) Equal(D SecpCommitment) bool {
+	return C.p.Equal(D.p)
+}
+
+// Add two commitments using homomorphic encryption
+func (C SecpCommitment) Add(D SecpCommitment) (SecpCommitment, error) {
+	return SecpCommitSum([]SecpCommitment{C, D}, nil)
+}
+
+// Subtract two commitments using homomorphic encryption
+func (C SecpCommitment) Sub(D SecpCommitment) (SecpCommitment, error) {
+	return SecpCommitSum([]SecpCommitment{C}, []SecpCommitment{D})
+}
+
+// Sum of the positive commitments minus the negative ones, as secp256k1_pedersen_commit_sum
+// A sum at infinity cannot be serialized and is an error.
+func SecpCommitSum(positives, negatives []SecpCommitment) (SecpCommitment, error) {
+	sum := secpTally(positives, negatives)
+	if sum.IsInfinity() {
+		return SecpCommitment{}, errors.New("sum of commitments is the point at infinity")
+	}
+	return SecpCommitment{sum}, nil
+}
+
+// Check that the positive and negative commitments balance, as secp256k1_pedersen_verify_tally
+func SecpVerifyTally(positives, negatives []SecpCommitment) bool {
+	return secpTally(positives, negatives).IsInfinity()
+}
+
+// Check that C opens to value with the blinding factor blind under H
+func SecpValidate(C SecpCommitment, H SecpPoint, blind [32]byte, value Amount) bool {
+	expected, err := SecpCommit(H, blind, value)
+	return err == nil && expected.Equal(C)
+}
+
+func secpTally(positives, negatives []SecpCommitment) SecpPoint {
+	var sum SecpPoint
+	for _, C := range positives {
+		sum = secpAdd(sum, C.p)
+	}
+	for _, C := range negatives {
+		sum = secpAdd(sum, secpNeg(C.p))
+	}
+	return sum
+}
+
+// 33-byte encoding: prefix ^ 1 if y is not a quadratic residue, then x
+func serializeSecpPoint(P SecpPoint, prefix byte) ([]byte, error) {
+	if P.IsInfinity() {
+		return nil, errors.New("cannot serialize the point at infinity")
+	}
+	data := make([]byte, 33)
+	data[0] = prefix
+	if !isQuadraticResidue(P.y) {
+		data[0] ^= 1
+	}
+	P.x.FillBytes(data[1:])
+	return data, nil
+}
+
+func parseSecpPoint(data []byte, prefix byte) (SecpPoint, error) {
+	if len(data) != 33 {
+		return SecpPoint{}, fmt.Errorf("%w: secp256k1 point must be 33 bytes, got %d", ErrNonCanonical, len(data))
+	}
+	if data[0]&^1 != prefix {
+		return SecpPoint{}, fmt.Errorf("%w: unexpected prefix 0x%02x", ErrNonCanonical, data[0])
+	}
+	x := new(big.Int).SetBytes(data[1:])
+	if x.Cmp(secpP) >= 0 {
+		return SecpPoint{}, fmt.Errorf("%w: x coordinate is not a field element", ErrNonCanonical)
+	}
+	// y^2 = x^3 + 7
+	y2 := new(big.Int).Exp(x, big.NewInt(3), secpP)
+	y2.Add(y2, big.NewInt(7))
+	y2.Mod(y2, secpP)
+	y := new(big.Int).ModSqrt(y2, secpP)
+	if y == nil {
+		return SecpPoint{}, errors.New("x coordinate is not on secp256k1")
+	}
+	// Exactly one of y and -y is a quadratic residue, as -1 is not one
+	if isQuadraticResidue(y) != (data[0] == prefix) {
+		y.Sub(secpP, y)
+	}
+	return SecpPoint{x, y}, nil
+}
+
+func isQuadraticResidue(y *big.Int) bool {
+	return big.Jacobi(y, secpP) >= 0
+}
+
+func secpNeg(P SecpPoint) SecpPoint {
+	if P.IsInfinity() {
+		return P
+	}
+	return SecpPoint{P.x, new(big.Int).Sub(secpP, P.y)}
+}
+
+func secpAdd(P, Q SecpPoint) SecpPoint {
+	if P.IsInfinity() {
+		return Q
+	}
+	if Q.IsInfinity() {
+		return P
+	}
+	var lambda *big.Int
+	if P.x.Cmp(Q.x) == 0 {
+		if P.y.Cmp(Q.y) != 0 {
+			return SecpPoint{}
+		}
+		// lambda = 3x^2 / 2y
+		lambda = new(big.Int).Mul(P.x, P.x)
+		lambda.Mul(lambda, big.NewInt(3))
+		lambda.Mul(lambda, new(big.Int).ModInverse(new(big.Int).Lsh(P.y, 1), secpP))
+	} else {
+		// lambda = (y2 - y1) / (x2 - x1)
+		lambda = new(big.Int).Sub(Q.y, P.y)
+		dx := new(big.Int).Sub(Q.x, P.x)
+		dx.Mod(dx, secpP)
+		lambda.Mul(lambda, dx.ModInverse(dx, secpP))
+	}
+	lambda.Mod(lambda, secpP)
+
+	x := new(big.Int).Mul(lambda, lambda)
+	x.Sub(x, P.x)
+	x.Sub(x, Q.x)
+	x.Mod(x, secpP)
+	y := new(big.Int).Sub(P.x, x)
+	y.Mul(y, lambda)
+	y.Sub(y, P.y)
+	y.Mod(y, secpP)
+	return SecpPoint{x, y}
+}
+
+func secpScalarMult(P SecpPoint, k *big.Int) SecpPoint {
+	var result SecpPoint
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		result = secpAdd(result, result)
+		if k.Bit(i) == 1 {
+			result = secpAdd(result, P)
+		}
+	}
+	return result
+}
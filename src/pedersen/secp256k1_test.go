@@ -0,0 +1,125 @@
+package pedersen
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var secpDenomination = Denomination{Bits: SecpValueBits}
+
+func secpBlind(x int64) [32]byte {
+	var blind [32]byte
+	big.NewInt(x).FillBytes(blind[:])
+	return blind
+}
+
+func secpAmount(units uint64) Amount {
+	amount, err := secpDenomination.FromUint64(units)
+	if err != nil {
+		panic(err)
+	}
+	return amount
+}
+
+func TestSecpGeneratorH(t *testing.T) {
+	G := SecpG()
+	uncompressed := append([]byte{4}, G.x.FillBytes(make([]byte, 32))...)
+	uncompressed = append(uncompressed, G.y.FillBytes(make([]byte, 32))...)
+	digest := sha256.Sum256(uncompressed)
+
+	encoded, err := SecpH().GeneratorBytes()
+	assert.NoError(t, err)
+	assert.Equal(t, "0b"+hex.EncodeToString(digest[:]), hex.EncodeToString(encoded))
+
+	H, err := ParseSecpGenerator(encoded)
+	assert.NoError(t, err)
+	assert.True(t, H.Equal(SecpH()))
+}
+
+func TestSecpCommitEncoding(t *testing.T) {
+	// 1 G + 0 H is G, whose y is a quadratic residue
+	C, err := SecpCommit(SecpH(), secpBlind(1), secpAmount(0))
+	assert.NoError(t, err)
+	assert.Equal(t, "08"+secpGx.Text(16), hex.EncodeToString(C.Bytes()))
+
+	// 0 G + 1 H is H, whose y is not one, as its generator prefix 0x0b shows
+	C, err = SecpCommit(SecpH(), secpBlind(0), secpAmount(1))
+	assert.NoError(t, err)
+	assert.Equal(t, "09"+secpHx.Text(16), hex.EncodeToString(C.Bytes()))
+
+	for _, units := range []uint64{0, 1, 1000, ^uint64(0)} {
+		C, err := SecpCommit(SecpH(), secpBlind(12345), secpAmount(units))
+		assert.NoError(t, err)
+		parsed, err := ParseSecpCommitment(C.Bytes())
+		assert.NoError(t, err)
+		assert.True(t, parsed.Equal(C), "Commitment to %d should round-trip", units)
+		assert.True(t, SecpValidate(parsed, SecpH(), secpBlind(12345), secpAmount(units)))
+		assert.False(t, SecpValidate(parsed, SecpH(), secpBlind(12346), secpAmount(units)))
+	}
+}
+
+func TestSecpCommitErrors(t *testing.T) {
+	_, err := SecpCommit(SecpPoint{}, secpBlind(1), secpAmount(1))
+	assert.Error(t, err)
+
+	var overflow [32]byte
+	secpN.FillBytes(overflow[:])
+	_, err = SecpCommit(SecpH(), overflow, secpAmount(1))
+	assert.EqualError(t, err, "blinding factor overflows the group order")
+
+	wide, err := Denomination{Bits: 65}.FromUnits(new(big.Int).Lsh(big.NewInt(1), 64))
+	assert.NoError(t, err)
+	_, err = SecpCommit(SecpH(), secpBlind(1), wide)
+	assert.EqualError(t, err, "value does not fit in 64 bits")
+
+	_, err = SecpCommit(SecpH(), secpBlind(0), secpAmount(0))
+	assert.Error(t, err, "A commitment at infinity cannot be serialized")
+}
+
+var _TestSecpParseInputs = []struct {
+	name    string
+	encoded string
+}{
+	{"Short", "08" + secpGx.Text(16)[2:]},
+	{"Generator prefix", "0a" + secpGx.Text(16)},
+	{"Compressed key prefix", "02" + secpGx.Text(16)},
+	{"Not a field element", "08" + secpP.Text(16)},
+	// x = 5 is not on the curve: 5^3 + 7 is not a square
+	{"Not on the curve", "08" + "0000000000000000000000000000000000000000000000000000000000000005"},
+}
+
+func TestSecpParseErrors(t *testing.T) {
+	for _, testcase := range _TestSecpParseInputs {
+		t.Run(testcase.name, func(t *testing.T) {
+			data, err := hex.DecodeString(testcase.encoded)
+			assert.NoError(t, err)
+			_, err = ParseSecpCommitment(data)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSecpHomomorphism(t *testing.T) {
+	H := SecpH()
+	c1, _ := SecpCommit(H, secpBlind(100), secpAmount(30))
+	c2, _ := SecpCommit(H, secpBlind(23), secpAmount(12))
+	sum, _ := SecpCommit(H, secpBlind(123), secpAmount(42))
+	difference, _ := SecpCommit(H, secpBlind(77), secpAmount(18))
+
+	actual, err := c1.Add(c2)
+	assert.NoError(t, err)
+	assert.True(t, actual.Equal(sum))
+	actual, err = c1.Sub(c2)
+	assert.NoError(t, err)
+	assert.True(t, actual.Equal(difference))
+
+	_, err = c1.Sub(c1)
+	assert.Error(t, err)
+
+	assert.True(t, SecpVerifyTally([]SecpCommitment{sum}, []SecpCommitment{c1, c2}))
+	assert.False(t, SecpVerifyTally([]SecpCommitment{sum}, []SecpCommitment{c1}))
+}
@@ -0,0 +1,99 @@
+package pedersen
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/bwesterb/go-ristretto"
+)
+
+const redacted = "[REDACTED]"
+
+// Secret holds a scalar that must not leak, such as a blinding factor or a
+// hidden amount.
+//
+// It never prints its contents through fmt or log, refuses to be marshalled,
+// and is zeroized by Destroy. The scalar is kept behind a pointer so that a
+// Secret nested in another struct prints as an address, not as its limbs.
+type Secret struct {
+	s *ristretto.Scalar
+}
+
+// Wrap a copy of s. The caller should clear s once it is no longer needed.
+func NewSecret(s *ristretto.Scalar) *Secret {
+	var inner ristretto.Scalar
+	inner.Set(s)
+	return &Secret{s: &inner}
+}
+
+// Wrap x reduced modulo the group order, so negative values wrap around
+func NewSecretFromBigInt(x *big.Int) *Secret {
+	var reduced big.Int
+	reduced.Mod(x, n25519)
+	var inner ristretto.Scalar
+	inner.SetBigInt(&reduced)
+	reduced.SetInt64(0)
+	return &Secret{s: &inner}
+}
+
+// Wrap a small unsigned value
+func NewSecretFromUint64(x uint64) *Secret {
+	var inner ristretto.Scalar
+	inner.SetUint64(x)
+	return &Secret{s: &inner}
+}
+
+// Uniformly random secret, e.g. a fresh blinding factor
+func RandomSecret() *Secret {
+	var inner ristretto.Scalar
+	inner.Rand()
+	return &Secret{s: &inner}
+}
+
+// Scalar gives access to the wrapped value for arithmetic.
+// The pointer must not be retained; it is zeroized by Destroy.
+// A destroyed or zero-value Secret reads as zero.
+func (s *Secret) Scalar() *ristretto.Scalar {
+	if s.s == nil {
+		s.s = new(ristretto.Scalar)
+	}
+	return s.s
+}
+
+// Overwrite the wrapped value with zeros
+func (s *Secret) Destroy() {
+	if s.s != nil {
+		s.s.SetZero()
+	}
+}
+
+// Constant-time equality
+func (s *Secret) Equal(other *Secret) bool {
+	return s.Scalar().EqualsI(other.Scalar()) == 1
+}
+
+func (s Secret) String() string {
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return redacted
+}
+
+// Format prints the redaction marker for every verb, including %d and %x
+func (s Secret) Format(f fmt.State, verb rune) {
+	fmt.Fprint(f, redacted)
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return nil, errors.New("pedersen: secrets cannot be marshalled")
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return nil, errors.New("pedersen: secrets cannot be marshalled")
+}
+
+func (s Secret) MarshalBinary() ([]byte, error) {
+	return nil, errors.New("pedersen: secrets cannot be marshalled")
+}
@@ -0,0 +1,80 @@
+package pedersen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretIsNeverPrinted(t *testing.T) {
+	secret := NewSecretFromBigInt(big.NewInt(123456789))
+	digits := secret.Scalar().BigInt().String()
+
+	nested := struct {
+		Name   string
+		Secret *Secret
+		Value  Secret
+	}{"nested", secret, *secret}
+
+	for _, format := range []string{"%v", "%+v", "%#v", "%d", "%x", "%s"} {
+		for _, operand := range []interface{}{secret, *secret, nested} {
+			out := fmt.Sprintf(format, operand)
+			assert.NotContains(t, out, digits, "format %s leaked the secret", format)
+		}
+	}
+	assert.Equal(t, redacted, fmt.Sprint(secret))
+
+	var buf bytes.Buffer
+	logger := log.New(&buf, "", 0)
+	logger.Printf("blinding factor %d", secret)
+	assert.Equal(t, "blinding factor "+redacted, strings.TrimSpace(buf.String()))
+
+	_, err := json.Marshal(secret)
+	assert.Error(t, err)
+	_, err = json.Marshal(nested)
+	assert.Error(t, err)
+}
+
+func TestSecretDestroy(t *testing.T) {
+	var s ristretto.Scalar
+	s.Rand()
+	secret := NewSecret(&s)
+	assert.True(t, secret.Scalar().Equals(&s), "Secret should wrap a copy of the scalar")
+
+	secret.Destroy()
+	var zero ristretto.Scalar
+	assert.True(t, secret.Scalar().Equals(zero.SetZero()), "Destroy should zeroize the secret")
+	assert.False(t, s.Equals(&zero), "Destroy should not touch the original scalar")
+}
+
+func TestSecretEqual(t *testing.T) {
+	a := NewSecretFromUint64(42)
+	b := NewSecretFromBigInt(big.NewInt(42))
+	c := NewSecretFromUint64(43)
+	assert.True(t, a.Equal(b))
+	assert.False(t, a.Equal(c))
+
+	// Negative values wrap around the group order
+	minusOne := NewSecretFromBigInt(big.NewInt(-1))
+	var sum ristretto.Scalar
+	sum.Add(minusOne.Scalar(), NewSecretFromUint64(1).Scalar())
+	assert.True(t, sum.Equals(new(ristretto.Scalar).SetZero()))
+}
+
+func TestValidate(t *testing.T) {
+	H := GenerateH()
+	r := RandomSecret()
+	amount := mustAmount(t, 100)
+	committed := CommitTo(&H, r, amount)
+
+	assert.True(t, Validate(amount, committed, H, r))
+	assert.False(t, Validate(mustAmount(t, 99), committed, H, r))
+	assert.False(t, Validate(amount, committed, H, RandomSecret()))
+}
@@ -0,0 +1,86 @@
+package pedersen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/bwesterb/go-ristretto"
+)
+
+// Errors returned by the validation functions
+var (
+	ErrIdentityPoint = errors.New("pedersen: point is the identity")
+	ErrZeroScalar    = errors.New("pedersen: scalar is zero")
+	ErrNonCanonical  = errors.New("pedersen: non-canonical encoding")
+	ErrDegenerateH   = errors.New("pedersen: H must be independent of the base point")
+)
+
+// Check the secondary point H. It must not be the identity, nor the base
+// point B or its inverse, otherwise commitments are not binding.
+func ValidateParams(H *ristretto.Point) error {
+	if err := ValidatePoint(H); err != nil {
+		return fmt.Errorf("invalid H: %w", err)
+	}
+	var B, minusB ristretto.Point
+	B.SetBase()
+	minusB.Neg(&B)
+	if H.Equals(&B) || H.Equals(&minusB) {
+		return ErrDegenerateH
+	}
+	return nil
+}
+
+// Check a commitment received from a client. The identity is rejected: it
+// only opens with a zero blinding factor, which hides nothing.
+func ValidateCommitment(C *ristretto.Point) error {
+	if err := ValidatePoint(C); err != nil {
+		return fmt.Errorf("invalid commitment: %w", err)
+	}
+	return nil
+}
+
+// Check a point such as a public key or a proof nonce
+func ValidatePoint(P *ristretto.Point) error {
+	var identity ristretto.Point
+	identity.SetZero()
+	if P.Equals(&identity) {
+		return ErrIdentityPoint
+	}
+	return nil
+}
+
+// Check a scalar such as a blinding factor
+func ValidateScalar(s *ristretto.Scalar) error {
+	if s.IsNonZeroI() == 0 {
+		return ErrZeroScalar
+	}
+	return nil
+}
+
+// Decode a point, rejecting anything but its 32-byte canonical encoding
+func DecodePoint(data []byte) (ristretto.Point, error) {
+	var P ristretto.Point
+	if len(data) != 32 {
+		return P, fmt.Errorf("%w: point must be 32 bytes, got %d", ErrNonCanonical, len(data))
+	}
+	if err := P.UnmarshalBinary(data); err != nil {
+		return P, fmt.Errorf("%w: %v", ErrNonCanonical, err)
+	}
+	return P, nil
+}
+
+// Decode a scalar, rejecting encodings of values outside [0, l)
+func DecodeScalar(data []byte) (ristretto.Scalar, error) {
+	var s ristretto.Scalar
+	if len(data) != 32 {
+		return s, fmt.Errorf("%w: scalar must be 32 bytes, got %d", ErrNonCanonical, len(data))
+	}
+	var buf [32]byte
+	copy(buf[:], data)
+	s.SetBytes(&buf)
+	if !bytes.Equal(s.Bytes(), data) {
+		return ristretto.Scalar{}, ErrNonCanonical
+	}
+	return s, nil
+}
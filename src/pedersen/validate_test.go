@@ -0,0 +1,82 @@
+package pedersen
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateParams(t *testing.T) {
+	var identity, B, minusB ristretto.Point
+	identity.SetZero()
+	B.SetBase()
+	minusB.Neg(&B)
+	H := GenerateH()
+
+	assert.NoError(t, ValidateParams(&H))
+	assert.ErrorIs(t, ValidateParams(&identity), ErrIdentityPoint)
+	assert.ErrorIs(t, ValidateParams(&B), ErrDegenerateH)
+	assert.ErrorIs(t, ValidateParams(&minusB), ErrDegenerateH)
+}
+
+func TestValidateCommitment(t *testing.T) {
+	H := GenerateH()
+	C := CommitTo(&H, RandomSecret(), mustAmount(t, 5))
+	assert.NoError(t, ValidateCommitment(&C))
+
+	// Committing to zero with a zero blinding factor gives the identity
+	zero := CommitTo(&H, NewSecretFromUint64(0), mustAmount(t, 0))
+	assert.ErrorIs(t, ValidateCommitment(&zero), ErrIdentityPoint)
+}
+
+func TestValidateScalar(t *testing.T) {
+	var s ristretto.Scalar
+	assert.ErrorIs(t, ValidateScalar(s.SetZero()), ErrZeroScalar)
+	assert.NoError(t, ValidateScalar(s.Rand()))
+}
+
+func TestDecodeScalar(t *testing.T) {
+	lMinusOne := new(big.Int).Sub(n25519, big.NewInt(1))
+
+	s, err := DecodeScalar(littleEndian(lMinusOne))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, s.BigInt().Cmp(lMinusOne))
+
+	_, err = DecodeScalar(littleEndian(n25519))
+	assert.ErrorIs(t, err, ErrNonCanonical, "l itself is not canonical")
+
+	high := make([]byte, 32)
+	high[31] = 0xe0
+	_, err = DecodeScalar(high)
+	assert.ErrorIs(t, err, ErrNonCanonical, "Top bits must be clear")
+
+	_, err = DecodeScalar(make([]byte, 31))
+	assert.ErrorIs(t, err, ErrNonCanonical)
+}
+
+func TestDecodePoint(t *testing.T) {
+	H := GenerateH()
+	decoded, err := DecodePoint(H.Bytes())
+	assert.NoError(t, err)
+	assert.True(t, decoded.Equals(&H))
+
+	// Ristretto encodings must be non-negative field elements
+	negative := H.Bytes()
+	negative[0] |= 1
+	_, err = DecodePoint(negative)
+	assert.ErrorIs(t, err, ErrNonCanonical)
+
+	_, err = DecodePoint(H.Bytes()[:31])
+	assert.ErrorIs(t, err, ErrNonCanonical)
+}
+
+func littleEndian(x *big.Int) []byte {
+	be := x.FillBytes(make([]byte, 32))
+	le := make([]byte, 32)
+	for i := range be {
+		le[i] = be[31-i]
+	}
+	return le
+}
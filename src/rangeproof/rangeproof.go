@@ -0,0 +1,206 @@
+package rangeproof
+
+import (
+	"errors"
+	"fmt"
+	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/transcript"
+
+	"github.com/bwesterb/go-ristretto"
+)
+
+// Largest bit width accepted by Prove and Verify
+const MaxBits = 128
+
+const transcriptLabel = "pedersen-rangeproof-v1"
+
+// Proof that a commitment C = rB + vH hides a value 0 <= v < 2^n.
+//
+// The value is split in bits b_i, each committed to separately as
+// C_i = r_i B + b_i H with the blinding factors chosen so that
+// sum(2^i C_i) = C. Every C_i carries an OR proof showing that it opens
+// either to 0 or to 1, without revealing which one.
+type Proof struct {
+	Bits []BitProof `json:"bits"`
+}
+
+// OR proof that Commitment is either r B or r B + H
+type BitProof struct {
+	Commitment ristretto.Point  `json:"commitment"`
+	E0         ristretto.Scalar `json:"e0"`
+	Z0         ristretto.Scalar `json:"z0"`
+	E1         ristretto.Scalar `json:"e1"`
+	Z1         ristretto.Scalar `json:"z1"`
+}
+
+// Denomination of the value committed to by each bit commitment
+var bitDenomination = pedersen.Denomination{Bits: 1}
+
+// Prove that CommitTo(H, r, v) hides a value in [0, 2^bits), where bits is
+// the bit width of v
+func Prove(H *ristretto.Point, v pedersen.Amount, r *pedersen.Secret) (Proof, error) {
+	bits := v.Bits()
+	if bits <= 0 || bits > MaxBits {
+		return Proof{}, fmt.Errorf("bit width must be between 1 and %d, got %d", MaxBits, bits)
+	}
+
+	commitment := pedersen.CommitTo(H, r, v)
+	units := v.Units()
+	t := newTranscript(H, &commitment, bits)
+
+	// r = sum(2^i r_i): pick all but the last blinding factor at random and
+	// solve for the last one.
+	blindings := make([]ristretto.Scalar, bits)
+	defer zeroize(blindings)
+	var acc, weight ristretto.Scalar
+	weight.SetOne()
+	for i := 0; i < bits-1; i++ {
+		blindings[i].Rand()
+		var term ristretto.Scalar
+		acc.Add(&acc, term.Mul(&blindings[i], &weight))
+		weight.Add(&weight, &weight)
+	}
+	var rest, inv ristretto.Scalar
+	defer rest.SetZero()
+	defer acc.SetZero()
+	rest.Sub(r.Scalar(), &acc)
+	blindings[bits-1].Mul(&rest, inv.Inverse(&weight))
+
+	proof := Proof{Bits: make([]BitProof, bits)}
+	for i := 0; i < bits; i++ {
+		proof.Bits[i] = proveBit(t, H, units.Bit(i), &blindings[i])
+	}
+	return proof, nil
+}
+
+// Verify that commitment hides a value in [0, 2^bits)
+func Verify(H *ristretto.Point, commitment *ristretto.Point, bits int, proof Proof) bool {
+	if bits <= 0 || bits > MaxBits || len(proof.Bits) != bits {
+		return false
+	}
+	t := newTranscript(H, commitment, bits)
+
+	var sum, weighted ristretto.Point
+	var weight ristretto.Scalar
+	sum.SetZero()
+	weight.SetOne()
+	for i := range proof.Bits {
+		if !verifyBit(t, H, &proof.Bits[i]) {
+			return false
+		}
+		sum.Add(&sum, weighted.ScalarMult(&proof.Bits[i].Commitment, &weight))
+		weight.Add(&weight, &weight)
+	}
+	return sum.Equals(commitment)
+}
+
+// Encode the proof as the concatenation of its points and scalars
+func (p Proof) MarshalBinary() ([]byte, error) {
+	out := make([]byte, 0, len(p.Bits)*5*32)
+	for i := range p.Bits {
+		b := &p.Bits[i]
+		out = append(out, b.Commitment.Bytes()...)
+		out = append(out, b.E0.Bytes()...)
+		out = append(out, b.Z0.Bytes()...)
+		out = append(out, b.E1.Bytes()...)
+		out = append(out, b.Z1.Bytes()...)
+	}
+	return out, nil
+}
+
+// Decode a proof produced by MarshalBinary
+func (p *Proof) UnmarshalBinary(data []byte) error {
+	const bitProofSize = 5 * 32
+	if len(data) == 0 || len(data)%bitProofSize != 0 || len(data)/bitProofSize > MaxBits {
+		return errors.New("invalid range proof length")
+	}
+	bits := make([]BitProof, len(data)/bitProofSize)
+	for i := range bits {
+		chunk := data[i*bitProofSize : (i+1)*bitProofSize]
+		if err := bits[i].Commitment.UnmarshalBinary(chunk[:32]); err != nil {
+			return fmt.Errorf("failed to unmarshal bit commitment %d: %v", i, err)
+		}
+		scalars := []*ristretto.Scalar{&bits[i].E0, &bits[i].Z0, &bits[i].E1, &bits[i].Z1}
+		for j, s := range scalars {
+			if err := s.UnmarshalBinary(chunk[32*(j+1) : 32*(j+2)]); err != nil {
+				return err
+			}
+		}
+	}
+	p.Bits = bits
+	return nil
+}
+
+func newTranscript(H, commitment *ristretto.Point, bits int) *transcript.Transcript {
+	return transcript.New(transcriptLabel).AppendPoints(H, commitment).AppendUint64(uint64(bits))
+}
+
+// Commitment to a bit: C = rB + bH. The branch for the real bit is proven
+// honestly, the other one is simulated from a random challenge and response.
+func proveBit(t *transcript.Transcript, H *ristretto.Point, bit uint, r *ristretto.Scalar) BitProof {
+	blinding := pedersen.NewSecret(r)
+	defer blinding.Destroy()
+	var proof BitProof
+	value, _ := bitDenomination.FromUint64(uint64(bit))
+	proof.Commitment = pedersen.CommitTo(H, blinding, value)
+
+	targets := bitTargets(H, &proof.Commitment)
+	honest, simulated := int(bit), 1-int(bit)
+
+	var nonces [2]ristretto.Point
+	var k ristretto.Scalar
+	defer k.SetZero()
+	k.Rand()
+	nonces[honest].ScalarMultBase(&k)
+
+	var eFake, zFake ristretto.Scalar
+	eFake.Rand()
+	zFake.Rand()
+	nonces[simulated] = simulate(&targets[simulated], &eFake, &zFake)
+
+	e := t.AppendPoints(&proof.Commitment, &nonces[0], &nonces[1]).Challenge()
+	var eReal, zReal ristretto.Scalar
+	eReal.Sub(&e, &eFake)
+	zReal.MulAdd(&eReal, r, &k)
+
+	if honest == 0 {
+		proof.E0, proof.Z0, proof.E1, proof.Z1 = eReal, zReal, eFake, zFake
+	} else {
+		proof.E0, proof.Z0, proof.E1, proof.Z1 = eFake, zFake, eReal, zReal
+	}
+	return proof
+}
+
+func verifyBit(t *transcript.Transcript, H *ristretto.Point, proof *BitProof) bool {
+	targets := bitTargets(H, &proof.Commitment)
+	nonce0 := simulate(&targets[0], &proof.E0, &proof.Z0)
+	nonce1 := simulate(&targets[1], &proof.E1, &proof.Z1)
+
+	e := t.AppendPoints(&proof.Commitment, &nonce0, &nonce1).Challenge()
+	var sum ristretto.Scalar
+	sum.Add(&proof.E0, &proof.E1)
+	return sum.Equals(&e)
+}
+
+// The points that must be multiples of B if the bit is 0 or 1 respectively
+func bitTargets(H, commitment *ristretto.Point) [2]ristretto.Point {
+	var targets [2]ristretto.Point
+	targets[0].Set(commitment)
+	targets[1].Sub(commitment, H)
+	return targets
+}
+
+// Nonce of a Schnorr proof for target = xB with challenge e and response z
+func simulate(target *ristretto.Point, e, z *ristretto.Scalar) ristretto.Point {
+	var zB, eT, nonce ristretto.Point
+	zB.ScalarMultBase(z)
+	eT.ScalarMult(target, e)
+	nonce.Sub(&zB, &eT)
+	return nonce
+}
+
+func zeroize(scalars []ristretto.Scalar) {
+	for i := range scalars {
+		scalars[i].SetZero()
+	}
+}
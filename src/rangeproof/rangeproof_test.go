@@ -0,0 +1,92 @@
+package rangeproof
+
+import (
+	"math/big"
+	"pedersen-commitment-transfer/src/pedersen"
+	"testing"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/stretchr/testify/assert"
+)
+
+var _TestRangeProofs = []struct {
+	name  string
+	value *big.Int
+	bits  int
+}{
+	{
+		name:  "Zero",
+		value: big.NewInt(0),
+		bits:  8,
+	},
+	{
+		name:  "Max 8 bits",
+		value: big.NewInt(255),
+		bits:  8,
+	},
+	{
+		name:  "64 bits",
+		value: new(big.Int).SetUint64(1<<63 + 12345),
+		bits:  64,
+	},
+	{
+		name:  "128 bits",
+		value: new(big.Int).Lsh(big.NewInt(1), 127),
+		bits:  128,
+	},
+}
+
+func TestProveVerify(t *testing.T) {
+	H := pedersen.GenerateH()
+
+	for _, testcase := range _TestRangeProofs {
+		t.Run(testcase.name, func(t *testing.T) {
+			r := pedersen.RandomSecret()
+			value, err := pedersen.Denomination{Bits: testcase.bits}.FromUnits(testcase.value)
+			assert.NoError(t, err)
+			proof, err := Prove(&H, value, r)
+			assert.NoError(t, err)
+
+			commitment := pedersen.CommitTo(&H, r, value)
+			assert.True(t, Verify(&H, &commitment, testcase.bits, proof), "Proof should verify")
+
+			// A proof is bound to its commitment and bit width
+			var other ristretto.Point
+			other.Rand()
+			assert.False(t, Verify(&H, &other, testcase.bits, proof), "Proof should not verify for another commitment")
+			assert.False(t, Verify(&H, &commitment, testcase.bits+1, proof), "Proof should not verify for another width")
+		})
+	}
+}
+
+func TestTamperedProof(t *testing.T) {
+	H := pedersen.GenerateH()
+	r := pedersen.RandomSecret()
+	value, _ := pedersen.Denomination{Bits: 8}.FromUint64(42)
+	commitment := pedersen.CommitTo(&H, r, value)
+
+	proof, err := Prove(&H, value, r)
+	assert.NoError(t, err)
+
+	proof.Bits[3].Z0.Rand()
+	assert.False(t, Verify(&H, &commitment, 8, proof))
+}
+
+func TestMarshalling(t *testing.T) {
+	H := pedersen.GenerateH()
+	r := pedersen.RandomSecret()
+	value, _ := pedersen.Denomination{Bits: 16}.FromUint64(1000)
+	commitment := pedersen.CommitTo(&H, r, value)
+
+	proof, err := Prove(&H, value, r)
+	assert.NoError(t, err)
+
+	data, err := proof.MarshalBinary()
+	assert.NoError(t, err)
+
+	var decoded Proof
+	assert.NoError(t, decoded.UnmarshalBinary(data))
+	assert.True(t, Verify(&H, &commitment, 16, decoded))
+
+	assert.Error(t, decoded.UnmarshalBinary(data[:len(data)-1]))
+}
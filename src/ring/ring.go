@@ -0,0 +1,187 @@
+package ring
+
+import (
+	"errors"
+	"fmt"
+	"pedersen-commitment-transfer/src/transcript"
+
+	"github.com/bwesterb/go-ristretto"
+)
+
+// Domain separation labels
+const (
+	hashToPointLabel = "pedersen-ring-hp-v1"
+	aggregateLabel   = "pedersen-ring-agg-v1"
+	roundLabel       = "pedersen-ring-round-v1"
+)
+
+// Member of a ring: an account public key P = xB and the commitment C
+// holding its balance.
+type Member struct {
+	PublicKey  ristretto.Point `json:"publicKey"`
+	Commitment ristretto.Point `json:"commitment"`
+}
+
+// CLSAG-style linkable ring signature.
+//
+// The signer proves knowledge of the secret key x of one ring member and of
+// the blinding difference z between that member's commitment and the pseudo
+// commitment C' (C_i - C' = zB), without revealing which member it is.
+// KeyImage = x Hp(P) is the same for every signature made with the same key,
+// so a spent key can be recognized.
+type Signature struct {
+	C0        ristretto.Scalar   `json:"c0"`
+	Responses []ristretto.Scalar `json:"responses"`
+	KeyImage  ristretto.Point    `json:"keyImage"`
+	// Auxiliary image z Hp(P) that links the commitment part to the key image
+	Auxiliary ristretto.Point `json:"auxiliary"`
+}
+
+// Compute the key image x Hp(P) of a secret key
+func KeyImage(x *ristretto.Scalar) ristretto.Point {
+	var P, image ristretto.Point
+	P.ScalarMultBase(x)
+	hp := hashToPoint(&P)
+	image.ScalarMult(&hp, x)
+	return image
+}
+
+// Sign message as the ring member at index, which must hold P = xB and
+// C - pseudoCommitment = zB.
+func Sign(message []byte, members []Member, pseudoCommitment *ristretto.Point, index int, x, z *ristretto.Scalar) (Signature, error) {
+	n := len(members)
+	if n == 0 {
+		return Signature{}, errors.New("ring must not be empty")
+	}
+	if index < 0 || index >= n {
+		return Signature{}, fmt.Errorf("signer index %d out of range", index)
+	}
+
+	var P, zB, diff ristretto.Point
+	P.ScalarMultBase(x)
+	if !P.Equals(&members[index].PublicKey) {
+		return Signature{}, errors.New("secret key does not match the signer public key")
+	}
+	diff.Sub(&members[index].Commitment, pseudoCommitment)
+	if !zB.ScalarMultBase(z).Equals(&diff) {
+		return Signature{}, errors.New("blinding difference does not open the signer commitment")
+	}
+
+	hp := hashToPoint(&P)
+	var sig Signature
+	sig.KeyImage.ScalarMult(&hp, x)
+	sig.Auxiliary.ScalarMult(&hp, z)
+	sig.Responses = make([]ristretto.Scalar, n)
+
+	muP, muC := aggregationCoefficients(members, pseudoCommitment, &sig.KeyImage, &sig.Auxiliary)
+	images := aggregateImages(&muP, &muC, &sig.KeyImage, &sig.Auxiliary)
+
+	var alpha ristretto.Scalar
+	alpha.Rand()
+	var L, R ristretto.Point
+	L.ScalarMultBase(&alpha)
+	R.ScalarMult(&hp, &alpha)
+
+	c := roundChallenge(message, members, pseudoCommitment, &L, &R)
+	for step := 1; step < n; step++ {
+		i := (index + step) % n
+		if i == 0 {
+			sig.C0 = c
+		}
+		sig.Responses[i].Rand()
+		c = round(message, members, pseudoCommitment, &muP, &muC, &images, i, &sig.Responses[i], &c)
+	}
+	if index == 0 {
+		sig.C0 = c
+	}
+
+	// s = alpha - c (muP x + muC z)
+	var w, t ristretto.Scalar
+	w.Mul(&muP, x)
+	w.Add(&w, t.Mul(&muC, z))
+	sig.Responses[index].Sub(&alpha, t.Mul(&c, &w))
+	return sig, nil
+}
+
+// Verify a ring signature on message for the given ring and pseudo commitment
+func Verify(message []byte, members []Member, pseudoCommitment *ristretto.Point, sig Signature) bool {
+	n := len(members)
+	if n == 0 || len(sig.Responses) != n {
+		return false
+	}
+	var identity ristretto.Point
+	identity.SetZero()
+	if sig.KeyImage.Equals(&identity) {
+		return false
+	}
+
+	muP, muC := aggregationCoefficients(members, pseudoCommitment, &sig.KeyImage, &sig.Auxiliary)
+	images := aggregateImages(&muP, &muC, &sig.KeyImage, &sig.Auxiliary)
+
+	c := sig.C0
+	for i := 0; i < n; i++ {
+		c = round(message, members, pseudoCommitment, &muP, &muC, &images, i, &sig.Responses[i], &c)
+	}
+	return c.Equals(&sig.C0)
+}
+
+// Whether two signatures were produced with the same secret key
+func Linked(a, b *Signature) bool {
+	return a.KeyImage.Equals(&b.KeyImage)
+}
+
+// Compute the next challenge from member i's response s and challenge c
+func round(message []byte, members []Member, pseudoCommitment *ristretto.Point, muP, muC *ristretto.Scalar, images *ristretto.Point, i int, s, c *ristretto.Scalar) ristretto.Scalar {
+	// W_i = muP P_i + muC (C_i - C')
+	var W, diff, t ristretto.Point
+	W.ScalarMult(&members[i].PublicKey, muP)
+	diff.Sub(&members[i].Commitment, pseudoCommitment)
+	W.Add(&W, t.ScalarMult(&diff, muC))
+
+	// L = sB + cW, R = s Hp(P_i) + c (muP I + muC D)
+	var L, R ristretto.Point
+	L.ScalarMultBase(s)
+	L.Add(&L, t.ScalarMult(&W, c))
+	hp := hashToPoint(&members[i].PublicKey)
+	R.ScalarMult(&hp, s)
+	R.Add(&R, t.ScalarMult(images, c))
+
+	return roundChallenge(message, members, pseudoCommitment, &L, &R)
+}
+
+func roundChallenge(message []byte, members []Member, pseudoCommitment, L, R *ristretto.Point) ristretto.Scalar {
+	t := transcript.New(roundLabel)
+	appendRing(t, members, pseudoCommitment)
+	t.AppendBytes(message).AppendPoints(L, R)
+	return t.Challenge()
+}
+
+func aggregationCoefficients(members []Member, pseudoCommitment, keyImage, auxiliary *ristretto.Point) (ristretto.Scalar, ristretto.Scalar) {
+	t := transcript.New(aggregateLabel)
+	appendRing(t, members, pseudoCommitment)
+	t.AppendPoints(keyImage, auxiliary)
+	muP := t.Challenge()
+	muC := t.Challenge()
+	return muP, muC
+}
+
+func aggregateImages(muP, muC *ristretto.Scalar, keyImage, auxiliary *ristretto.Point) ristretto.Point {
+	var images, t ristretto.Point
+	images.ScalarMult(keyImage, muP)
+	images.Add(&images, t.ScalarMult(auxiliary, muC))
+	return images
+}
+
+func appendRing(t *transcript.Transcript, members []Member, pseudoCommitment *ristretto.Point) {
+	t.AppendUint64(uint64(len(members)))
+	for i := range members {
+		t.AppendPoints(&members[i].PublicKey, &members[i].Commitment)
+	}
+	t.AppendPoints(pseudoCommitment)
+}
+
+func hashToPoint(P *ristretto.Point) ristretto.Point {
+	var hp ristretto.Point
+	hp.Derive(append([]byte(hashToPointLabel), P.Bytes()...))
+	return hp
+}
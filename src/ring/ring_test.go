@@ -0,0 +1,120 @@
+package ring
+
+import (
+	"pedersen-commitment-transfer/src/pedersen"
+	"testing"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/stretchr/testify/assert"
+)
+
+var testDenomination = pedersen.Denomination{Bits: 64}
+
+var _TestRings = []struct {
+	name  string
+	size  int
+	index int
+}{
+	{name: "Single member", size: 1, index: 0},
+	{name: "First member", size: 5, index: 0},
+	{name: "Middle member", size: 5, index: 2},
+	{name: "Last member", size: 5, index: 4},
+}
+
+func TestSignVerify(t *testing.T) {
+	H := pedersen.GenerateH()
+	message := []byte("transfer")
+
+	for _, testcase := range _TestRings {
+		t.Run(testcase.name, func(t *testing.T) {
+			members, x, z, pseudo := generateRing(&H, testcase.size, testcase.index, 250)
+
+			sig, err := Sign(message, members, &pseudo, testcase.index, &x, &z)
+			assert.NoError(t, err)
+			assert.True(t, Verify(message, members, &pseudo, sig), "Signature should verify")
+
+			expectedImage := KeyImage(&x)
+			assert.True(t, sig.KeyImage.Equals(&expectedImage))
+
+			assert.False(t, Verify([]byte("other"), members, &pseudo, sig), "Signature is bound to the message")
+
+			var otherPseudo ristretto.Point
+			otherPseudo.Rand()
+			assert.False(t, Verify(message, members, &otherPseudo, sig), "Signature is bound to the pseudo commitment")
+		})
+	}
+}
+
+func TestLinkability(t *testing.T) {
+	H := pedersen.GenerateH()
+	members, x, z, pseudo := generateRing(&H, 4, 1, 10)
+
+	sig1, err := Sign([]byte("first"), members, &pseudo, 1, &x, &z)
+	assert.NoError(t, err)
+
+	// Same key in a different ring and with a different message
+	members[3] = members[1]
+	members[1] = randomMember(&H)
+	sig2, err := Sign([]byte("second"), members, &pseudo, 3, &x, &z)
+	assert.NoError(t, err)
+
+	assert.True(t, Linked(&sig1, &sig2), "Signatures with the same key should be linked")
+
+	other, y, w, otherPseudo := generateRing(&H, 4, 2, 10)
+	sig3, err := Sign([]byte("first"), other, &otherPseudo, 2, &y, &w)
+	assert.NoError(t, err)
+	assert.False(t, Linked(&sig1, &sig3))
+}
+
+func TestSignErrors(t *testing.T) {
+	H := pedersen.GenerateH()
+	members, x, z, pseudo := generateRing(&H, 3, 0, 10)
+
+	_, err := Sign(nil, members, &pseudo, 1, &x, &z)
+	assert.Error(t, err, "Key of another member")
+
+	// A pseudo commitment to another value cannot be opened with z
+	var v ristretto.Scalar
+	inflated := pedersen.Add(&pseudo, pointOf(&H, v.SetUint64(1)))
+	_, err = Sign(nil, members, &inflated, 0, &x, &z)
+	assert.Error(t, err, "Pseudo commitment to another value")
+
+	_, err = Sign(nil, members, &pseudo, 3, &x, &z)
+	assert.Error(t, err, "Index out of range")
+}
+
+// Ring where the member at index holds amount, with a pseudo commitment
+// to the same amount under a fresh blinding factor.
+func generateRing(H *ristretto.Point, size, index int, amount uint64) ([]Member, ristretto.Scalar, ristretto.Scalar, ristretto.Point) {
+	members := make([]Member, size)
+	for i := range members {
+		members[i] = randomMember(H)
+	}
+
+	var x, z ristretto.Scalar
+	x.Rand()
+	r := pedersen.RandomSecret()
+	rPseudo := pedersen.RandomSecret()
+	v, _ := testDenomination.FromUint64(amount)
+	members[index].PublicKey.ScalarMultBase(&x)
+	members[index].Commitment = pedersen.CommitTo(H, r, v)
+
+	pseudo := pedersen.CommitTo(H, rPseudo, v)
+	z.Sub(r.Scalar(), rPseudo.Scalar())
+	return members, x, z, pseudo
+}
+
+func randomMember(H *ristretto.Point) Member {
+	var key ristretto.Scalar
+	key.Rand()
+	var member Member
+	member.PublicKey.ScalarMultBase(&key)
+	v, _ := testDenomination.FromUint64(7)
+	member.Commitment = pedersen.CommitTo(H, pedersen.RandomSecret(), v)
+	return member
+}
+
+func pointOf(H *ristretto.Point, v *ristretto.Scalar) *ristretto.Point {
+	var p ristretto.Point
+	return p.ScalarMult(H, v)
+}
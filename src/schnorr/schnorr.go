@@ -0,0 +1,49 @@
+package schnorr
+
+import (
+	"pedersen-commitment-transfer/src/transcript"
+
+	"github.com/bwesterb/go-ristretto"
+)
+
+const challengeLabel = "pedersen-schnorr-v1"
+
+// Schnorr signature (R, s) with sB = R + cX and c = Challenge(R, X, message)
+type Signature struct {
+	R ristretto.Point  `json:"r"`
+	S ristretto.Scalar `json:"s"`
+}
+
+// Public key of the secret key x
+func PublicKey(x *ristretto.Scalar) ristretto.Point {
+	var X ristretto.Point
+	X.ScalarMultBase(x)
+	return X
+}
+
+// Challenge binding the nonce commitment R, the public key X and the message
+func Challenge(R, X *ristretto.Point, message []byte) ristretto.Scalar {
+	return transcript.New(challengeLabel).AppendPoints(R, X).AppendBytes(message).Challenge()
+}
+
+// Sign message with the secret key x
+func Sign(x *ristretto.Scalar, message []byte) Signature {
+	X := PublicKey(x)
+	var k ristretto.Scalar
+	k.Rand()
+
+	var sig Signature
+	sig.R.ScalarMultBase(&k)
+	c := Challenge(&sig.R, &X, message)
+	sig.S.MulAdd(&c, x, &k)
+	return sig
+}
+
+// Verify a signature on message under the public key X
+func Verify(X *ristretto.Point, message []byte, sig Signature) bool {
+	c := Challenge(&sig.R, X, message)
+	var lhs, rhs, cX ristretto.Point
+	lhs.ScalarMultBase(&sig.S)
+	rhs.Add(&sig.R, cX.ScalarMult(X, &c))
+	return lhs.Equals(&rhs)
+}
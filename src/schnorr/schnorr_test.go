@@ -0,0 +1,26 @@
+package schnorr
+
+import (
+	"testing"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignVerify(t *testing.T) {
+	var x, y ristretto.Scalar
+	x.Rand()
+	y.Rand()
+	X := PublicKey(&x)
+	Y := PublicKey(&y)
+	message := []byte("message")
+
+	sig := Sign(&x, message)
+	assert.True(t, Verify(&X, message, sig), "Signature should verify")
+	assert.False(t, Verify(&Y, message, sig), "Signature should not verify under another key")
+	assert.False(t, Verify(&X, []byte("other"), sig), "Signature should not verify for another message")
+
+	tampered := sig
+	tampered.S.Add(&tampered.S, new(ristretto.Scalar).SetOne())
+	assert.False(t, Verify(&X, message, tampered))
+}
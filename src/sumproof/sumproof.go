@@ -0,0 +1,76 @@
+package sumproof
+
+import (
+	"errors"
+	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/transcript"
+
+	"github.com/bwesterb/go-ristretto"
+)
+
+const transcriptLabel = "pedersen-sum-v1"
+
+// Proof that commitments C_i = r_i B + v_i H add up to a public total v.
+//
+// If they do, D = Sum(C_i) - v H = (Sum r_i) B has no H component, and the
+// prover shows knowledge of its discrete log over B with a Schnorr proof:
+// R = k B and S = k + c Sum(r_i). Without knowing log_B(H), nobody can
+// produce this for a wrong total. The individual values stay hidden.
+type Proof struct {
+	R ristretto.Point  `json:"r"`
+	S ristretto.Scalar `json:"s"`
+}
+
+// Prove that commitments add up to total, given the sum of their blinding factors
+func Prove(H *ristretto.Point, commitments []ristretto.Point, total pedersen.Amount, blinding *pedersen.Secret) (Proof, error) {
+	D := difference(H, commitments, total)
+	var expected ristretto.Point
+	if !expected.ScalarMultBase(blinding.Scalar()).Equals(&D) {
+		return Proof{}, errors.New("commitments do not add up to the total with this blinding factor")
+	}
+
+	var k ristretto.Scalar
+	defer k.SetZero()
+	k.Rand()
+
+	var proof Proof
+	proof.R.ScalarMultBase(&k)
+	c := challenge(H, commitments, total, &proof.R)
+	proof.S.MulAdd(&c, blinding.Scalar(), &k)
+	return proof, nil
+}
+
+// Verify that commitments add up to total
+func Verify(H *ristretto.Point, commitments []ristretto.Point, total pedersen.Amount, proof Proof) bool {
+	if len(commitments) == 0 {
+		return false
+	}
+	D := difference(H, commitments, total)
+	c := challenge(H, commitments, total, &proof.R)
+
+	// S B == R + c D
+	var lhs, rhs, cD ristretto.Point
+	lhs.ScalarMultBase(&proof.S)
+	rhs.Add(&proof.R, cD.ScalarMult(&D, &c))
+	return lhs.Equals(&rhs)
+}
+
+// Sum(C_i) - v H
+func difference(H *ristretto.Point, commitments []ristretto.Point, total pedersen.Amount) ristretto.Point {
+	var sum, vH ristretto.Point
+	var v ristretto.Scalar
+	sum.SetZero()
+	for i := range commitments {
+		sum.Add(&sum, &commitments[i])
+	}
+	v.SetBigInt(total.Units())
+	return *sum.Sub(&sum, vH.ScalarMult(H, &v))
+}
+
+func challenge(H *ristretto.Point, commitments []ristretto.Point, total pedersen.Amount, R *ristretto.Point) ristretto.Scalar {
+	t := transcript.New(transcriptLabel).AppendPoints(H).AppendUint64(uint64(len(commitments)))
+	for i := range commitments {
+		t.AppendPoints(&commitments[i])
+	}
+	return t.AppendBytes(total.Units().Bytes()).AppendPoints(R).Challenge()
+}
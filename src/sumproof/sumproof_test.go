@@ -0,0 +1,53 @@
+package sumproof
+
+import (
+	"pedersen-commitment-transfer/src/pedersen"
+	"testing"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/stretchr/testify/assert"
+)
+
+var testDenomination = pedersen.Denomination{Decimals: 2, Bits: 64}
+
+func TestProveVerify(t *testing.T) {
+	H := pedersen.GenerateH()
+	commitments, blinding := commitAll(&H, 1200, 3400, 500)
+	total, _ := testDenomination.FromUint64(5100)
+
+	proof, err := Prove(&H, commitments, total, blinding)
+	assert.NoError(t, err)
+	assert.True(t, Verify(&H, commitments, total, proof), "Proof should verify")
+
+	other, _ := testDenomination.FromUint64(5101)
+	assert.False(t, Verify(&H, commitments, other, proof), "Proof is bound to the total")
+	assert.False(t, Verify(&H, commitments[:2], total, proof), "Proof is bound to the commitments")
+	assert.False(t, Verify(&H, nil, total, proof))
+}
+
+func TestWrongTotal(t *testing.T) {
+	H := pedersen.GenerateH()
+	commitments, blinding := commitAll(&H, 10, 20)
+	total, _ := testDenomination.FromUint64(31)
+
+	_, err := Prove(&H, commitments, total, blinding)
+	assert.Error(t, err)
+
+	// A proof for the real total does not carry over to a forged one
+	actual, _ := testDenomination.FromUint64(30)
+	proof, err := Prove(&H, commitments, actual, blinding)
+	assert.NoError(t, err)
+	assert.False(t, Verify(&H, commitments, total, proof))
+}
+
+func commitAll(H *ristretto.Point, values ...uint64) ([]ristretto.Point, *pedersen.Secret) {
+	commitments := make([]ristretto.Point, len(values))
+	blinding := pedersen.NewSecretFromUint64(0)
+	for i, value := range values {
+		amount, _ := testDenomination.FromUint64(value)
+		r := pedersen.RandomSecret()
+		commitments[i] = pedersen.CommitTo(H, r, amount)
+		blinding.Scalar().Add(blinding.Scalar(), r.Scalar())
+	}
+	return commitments, blinding
+}
@@ -0,0 +1,187 @@
+package sumtree
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/rangeproof"
+
+	"github.com/bwesterb/go-ristretto"
+)
+
+// Domain separation tags for the node hashes
+const (
+	leafTag    = 0x00
+	nodeTag    = 0x01
+	paddingTag = 0x02
+)
+
+// Leaf of a Merkle-sum tree: the balance commitment of one user, together
+// with a range proof showing that the committed balance is not negative.
+type Leaf struct {
+	ID         string           `json:"id"`
+	Commitment ristretto.Point  `json:"commitment"`
+	RangeProof rangeproof.Proof `json:"rangeProof"`
+}
+
+// Node of the tree. Sum is the homomorphic sum of the commitments below it.
+type Node struct {
+	Hash []byte          `json:"hash"`
+	Sum  ristretto.Point `json:"sum"`
+}
+
+// Root is everything a verifier needs to check an inclusion proof.
+// Root.Sum commits to the total liabilities of the published tree.
+type Root struct {
+	Node
+	Size int             `json:"size"`
+	Bits int             `json:"bits"`
+	H    ristretto.Point `json:"h"`
+}
+
+// InclusionProof shows that a leaf is counted in the root sum.
+// Path holds the siblings from the leaf level up to the children of the root.
+// Marshal proofs through a pointer so that points use their text encoding.
+type InclusionProof struct {
+	Index int    `json:"index"`
+	Leaf  Leaf   `json:"leaf"`
+	Path  []Node `json:"path"`
+}
+
+// Tree is a Merkle-sum tree of balance commitments
+type Tree struct {
+	root   Root
+	leaves []Leaf
+	levels [][]Node
+}
+
+// Build a tree over the given leaves.
+// Every leaf range proof must verify for the given H and bit width.
+func New(H *ristretto.Point, bits int, leaves []Leaf) (*Tree, error) {
+	if len(leaves) == 0 {
+		return nil, errors.New("cannot build a tree without leaves")
+	}
+
+	level := make([]Node, len(leaves))
+	for i := range leaves {
+		if !rangeproof.Verify(H, &leaves[i].Commitment, bits, leaves[i].RangeProof) {
+			return nil, fmt.Errorf("range proof of leaf %d (%s) is not valid", i, leaves[i].ID)
+		}
+		level[i] = leafNode(&leaves[i])
+	}
+
+	levels := [][]Node{level}
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, paddingNode())
+			levels[len(levels)-1] = level
+		}
+		parents := make([]Node, len(level)/2)
+		for i := range parents {
+			parents[i] = parentNode(&level[2*i], &level[2*i+1])
+		}
+		levels = append(levels, parents)
+		level = parents
+	}
+
+	tree := &Tree{
+		leaves: leaves,
+		levels: levels,
+		root: Root{
+			Node: level[0],
+			Size: len(leaves),
+			Bits: bits,
+			H:    *H,
+		},
+	}
+	return tree, nil
+}
+
+// Root of the tree, to be published
+func (t *Tree) Root() Root {
+	return t.root
+}
+
+// Inclusion proof for the leaf at the given index
+func (t *Tree) Prove(index int) (InclusionProof, error) {
+	if index < 0 || index >= len(t.leaves) {
+		return InclusionProof{}, fmt.Errorf("leaf index %d out of range", index)
+	}
+
+	proof := InclusionProof{
+		Index: index,
+		Leaf:  t.leaves[index],
+		Path:  make([]Node, 0, len(t.levels)-1),
+	}
+	position := index
+	for _, level := range t.levels[:len(t.levels)-1] {
+		proof.Path = append(proof.Path, level[position^1])
+		position /= 2
+	}
+	return proof, nil
+}
+
+// Verify an inclusion proof against a published root.
+// The leaf range proof, the hashes and the sums along the path must all be
+// consistent with the root.
+func Verify(root Root, proof InclusionProof) bool {
+	if proof.Index < 0 || proof.Index >= root.Size || len(proof.Path) != depth(root.Size) {
+		return false
+	}
+	if !rangeproof.Verify(&root.H, &proof.Leaf.Commitment, root.Bits, proof.Leaf.RangeProof) {
+		return false
+	}
+
+	node := leafNode(&proof.Leaf)
+	position := proof.Index
+	for i := range proof.Path {
+		if position%2 == 0 {
+			node = parentNode(&node, &proof.Path[i])
+		} else {
+			node = parentNode(&proof.Path[i], &node)
+		}
+		position /= 2
+	}
+	return string(node.Hash) == string(root.Hash) && node.Sum.Equals(&root.Sum)
+}
+
+// Number of levels between the leaves and the root
+func depth(size int) int {
+	d := 0
+	for width := size; width > 1; width = (width + 1) / 2 {
+		d++
+	}
+	return d
+}
+
+func leafNode(leaf *Leaf) Node {
+	var length [8]byte
+	binary.BigEndian.PutUint64(length[:], uint64(len(leaf.ID)))
+
+	h := sha256.New()
+	h.Write([]byte{leafTag})
+	h.Write(length[:])
+	h.Write([]byte(leaf.ID))
+	h.Write(leaf.Commitment.Bytes())
+	return Node{Hash: h.Sum(nil), Sum: leaf.Commitment}
+}
+
+func parentNode(left, right *Node) Node {
+	h := sha256.New()
+	h.Write([]byte{nodeTag})
+	h.Write(left.Hash)
+	h.Write(left.Sum.Bytes())
+	h.Write(right.Hash)
+	h.Write(right.Sum.Bytes())
+	return Node{Hash: h.Sum(nil), Sum: pedersen.Add(&left.Sum, &right.Sum)}
+}
+
+// Filler for odd-sized levels; it commits to zero with a zero blinding factor
+func paddingNode() Node {
+	hash := sha256.Sum256([]byte{paddingTag})
+	var zero ristretto.Point
+	zero.SetZero()
+	return Node{Hash: hash[:], Sum: zero}
+}
@@ -0,0 +1,135 @@
+package sumtree
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/rangeproof"
+	"testing"
+
+	"github.com/bwesterb/go-ristretto"
+	"github.com/stretchr/testify/assert"
+)
+
+const testBits = 16
+
+var testDenomination = pedersen.Denomination{Bits: testBits}
+
+var _TestTreeSizes = []struct {
+	name string
+	size int
+}{
+	{name: "Single leaf", size: 1},
+	{name: "Power of two", size: 4},
+	{name: "Odd size", size: 5},
+	{name: "Unbalanced", size: 11},
+}
+
+func TestInclusionProofs(t *testing.T) {
+	H := pedersen.GenerateH()
+
+	for _, testcase := range _TestTreeSizes {
+		t.Run(testcase.name, func(t *testing.T) {
+			leaves, total, blinding := generateLeaves(t, &H, testcase.size)
+
+			tree, err := New(&H, testBits, leaves)
+			assert.NoError(t, err)
+			root := tree.Root()
+
+			// The root sum opens to the total of all balances, which may need more bits than a single one
+			totalAmount, err := pedersen.Denomination{Bits: pedersen.MaxAmountBits}.FromUnits(total)
+			assert.NoError(t, err)
+			expected := pedersen.CommitTo(&H, blinding, totalAmount)
+			assert.True(t, root.Sum.Equals(&expected), "Root sum should commit to the total")
+
+			for i := range leaves {
+				proof, err := tree.Prove(i)
+				assert.NoError(t, err)
+				assert.True(t, Verify(root, proof), "Proof for leaf %d should verify", i)
+			}
+		})
+	}
+}
+
+func TestInvalidProofs(t *testing.T) {
+	H := pedersen.GenerateH()
+	leaves, _, _ := generateLeaves(t, &H, 6)
+	tree, err := New(&H, testBits, leaves)
+	assert.NoError(t, err)
+	root := tree.Root()
+
+	proof, err := tree.Prove(2)
+	assert.NoError(t, err)
+
+	// Claiming another position
+	moved := proof
+	moved.Index = 3
+	assert.False(t, Verify(root, moved))
+
+	// Replacing the leaf commitment with another one
+	swapped := proof
+	swapped.Leaf = leaves[4]
+	assert.False(t, Verify(root, swapped))
+
+	// Lowering a sibling sum to hide liabilities
+	lowered := proof
+	lowered.Path = append([]Node{}, proof.Path...)
+	lowered.Path[1].Sum = pedersen.Sub(&lowered.Path[1].Sum, &H)
+	assert.False(t, Verify(root, lowered))
+
+	_, err = tree.Prove(6)
+	assert.Error(t, err)
+}
+
+func TestRejectsInvalidLeafRangeProof(t *testing.T) {
+	H := pedersen.GenerateH()
+	leaves, _, _ := generateLeaves(t, &H, 3)
+	leaves[1].RangeProof = leaves[0].RangeProof
+
+	_, err := New(&H, testBits, leaves)
+	assert.Error(t, err)
+}
+
+func TestProofSerialization(t *testing.T) {
+	H := pedersen.GenerateH()
+	leaves, _, _ := generateLeaves(t, &H, 3)
+	tree, err := New(&H, testBits, leaves)
+	assert.NoError(t, err)
+
+	proof, err := tree.Prove(1)
+	assert.NoError(t, err)
+	published := tree.Root()
+	rootJSON, err := json.Marshal(&published)
+	assert.NoError(t, err)
+	proofJSON, err := json.Marshal(&proof)
+	assert.NoError(t, err)
+
+	var root Root
+	var decoded InclusionProof
+	assert.NoError(t, json.Unmarshal(rootJSON, &root))
+	assert.NoError(t, json.Unmarshal(proofJSON, &decoded))
+	assert.True(t, Verify(root, decoded))
+}
+
+func generateLeaves(t *testing.T, H *ristretto.Point, size int) ([]Leaf, *big.Int, *pedersen.Secret) {
+	leaves := make([]Leaf, size)
+	total := new(big.Int)
+	blinding := pedersen.NewSecretFromUint64(0)
+	for i := range leaves {
+		r := pedersen.RandomSecret()
+		amount, err := testDenomination.FromUint64(uint64(100 * (i + 1)))
+		assert.NoError(t, err)
+		proof, err := rangeproof.Prove(H, amount, r)
+		assert.NoError(t, err)
+
+		leaves[i] = Leaf{
+			ID:         fmt.Sprintf("user%d", i),
+			Commitment: pedersen.CommitTo(H, r, amount),
+			RangeProof: proof,
+		}
+		total.Add(total, amount.Units())
+		blinding.Scalar().Add(blinding.Scalar(), r.Scalar())
+	}
+	return leaves, total, blinding
+}
@@ -0,0 +1,68 @@
+package transcript
+
+import (
+	"crypto/sha512"
+	"encoding/binary"
+	"hash"
+
+	"github.com/bwesterb/go-ristretto"
+)
+
+// Transcript accumulates the public values of a sigma protocol so that the
+// verifier challenge can be derived non-interactively (Fiat-Shamir).
+// Every value is length-prefixed, and the transcript is bound to a label so
+// that challenges of different proof systems never collide.
+type Transcript struct {
+	h hash.Hash
+}
+
+// Start a new transcript for the proof system identified by label
+func New(label string) *Transcript {
+	t := &Transcript{h: sha512.New()}
+	t.AppendBytes([]byte(label))
+	return t
+}
+
+// Append an arbitrary byte string
+func (t *Transcript) AppendBytes(data []byte) *Transcript {
+	var length [8]byte
+	binary.BigEndian.PutUint64(length[:], uint64(len(data)))
+	t.h.Write(length[:])
+	t.h.Write(data)
+	return t
+}
+
+// Append an unsigned integer, e.g. an index or a bit width
+func (t *Transcript) AppendUint64(x uint64) *Transcript {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], x)
+	return t.AppendBytes(buf[:])
+}
+
+// Append one or more points using their canonical encoding
+func (t *Transcript) AppendPoints(points ...*ristretto.Point) *Transcript {
+	for _, p := range points {
+		t.AppendBytes(p.Bytes())
+	}
+	return t
+}
+
+// Append one or more scalars using their canonical encoding
+func (t *Transcript) AppendScalars(scalars ...*ristretto.Scalar) *Transcript {
+	for _, s := range scalars {
+		t.AppendBytes(s.Bytes())
+	}
+	return t
+}
+
+// Derive the challenge scalar from everything appended so far.
+// The transcript can keep being used afterwards; later challenges depend on
+// earlier ones.
+func (t *Transcript) Challenge() ristretto.Scalar {
+	var digest [64]byte
+	copy(digest[:], t.h.Sum(nil))
+	var c ristretto.Scalar
+	c.SetReduced(&digest)
+	t.AppendScalars(&c)
+	return c
+}
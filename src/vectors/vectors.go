@@ -0,0 +1,632 @@
+// Package vectors defines known-answer test vectors for the pedersen
+// primitives, so that other implementations can check they agree with this one.
+//
+// Points and scalars are hex encoded in their canonical 32-byte form,
+// amounts are decimal numbers of base units, and proofs use the JSON
+// encoding the chaincode accepts. Range proofs are randomized: Generate
+// emits fresh proof bytes every time, and their vectors only check whether
+// the proof verifies. Every other vector is fully determined by the seed.
+package vectors
+
+import (
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"pedersen-commitment-transfer/src/pedersen"
+	"pedersen-commitment-transfer/src/rangeproof"
+	"strconv"
+
+	"github.com/bwesterb/go-ristretto"
+)
+
+// Kinds of vectors
+const (
+	KindDeriveH      = "deriveH"
+	KindHash         = "hash"
+	KindCommit       = "commit"
+	KindAdd          = "add"
+	KindSub          = "sub"
+	KindDecodePoint  = "decodePoint"
+	KindDecodeScalar = "decodeScalar"
+	KindAmount       = "amount"
+	KindRangeProof   = "rangeProof"
+
+	KindAddPrivately       = "addPrivately"
+	KindSubPrivately       = "subPrivately"
+	KindValidate           = "validate"
+	KindValidateParams     = "validateParams"
+	KindValidateCommitment = "validateCommitment"
+)
+
+// File is a set of vectors generated from one seed
+type File struct {
+	Seed    string   `json:"seed"`
+	Vectors []Vector `json:"vectors"`
+}
+
+// Vector is one known-answer test
+// Input and Output hold the named values of each kind, see Check.
+// Valid tells whether the input must be accepted; rejected inputs have no output.
+type Vector struct {
+	Kind   string            `json:"kind"`
+	Name   string            `json:"name"`
+	Input  map[string]string `json:"input"`
+	Proof  json.RawMessage   `json:"proof,omitempty"`
+	Valid  bool              `json:"valid"`
+	Output map[string]string `json:"output,omitempty"`
+}
+
+// Check every vector of the file
+func (f File) Check() error {
+	var errs []error
+	for _, v := range f.Vectors {
+		err := v.Check()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s/%s: %w", v.Kind, v.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Check the vector against this implementation
+//
+//	deriveH:      domain -> h
+//	hash:         domain, data -> point
+//	commit:       h, blinding, units -> commitment
+//	add, sub:     a, b -> result
+//	decodePoint:  bytes -> valid
+//	decodeScalar: bytes -> valid
+//	amount:       decimals, bits, text -> valid, units, text
+//	rangeProof:   h, commitment, bits, proof -> valid
+//	addPrivately, subPrivately:
+//	              h, bits, blindingX, unitsX, blindingY, unitsY -> valid, commitment
+//	validate:     h, commitment, blinding, units -> valid
+//	validateParams:     h -> valid
+//	validateCommitment: commitment -> valid
+func (v Vector) Check() error {
+	switch v.Kind {
+	case KindDeriveH:
+		H := pedersen.DeriveH(v.Input["domain"])
+		return v.expect("h", encodePoint(&H))
+
+	case KindHash:
+		data, err := hex.DecodeString(v.Input["data"])
+		if err != nil {
+			return fmt.Errorf("failed to decode data: %v", err)
+		}
+		P := pedersen.Hash(v.Input["domain"], data)
+		return v.expect("point", encodePoint(&P))
+
+	case KindCommit:
+		H, err := decodePoint(v.Input["h"])
+		if err != nil {
+			return err
+		}
+		r, err := decodeScalar(v.Input["blinding"])
+		if err != nil {
+			return err
+		}
+		amount, err := parseUnits(v.Input["units"])
+		if err != nil {
+			return err
+		}
+		C := pedersen.CommitTo(&H, pedersen.NewSecret(&r), amount)
+		return v.expect("commitment", encodePoint(&C))
+
+	case KindAdd, KindSub:
+		a, err := decodePoint(v.Input["a"])
+		if err != nil {
+			return err
+		}
+		b, err := decodePoint(v.Input["b"])
+		if err != nil {
+			return err
+		}
+		var result ristretto.Point
+		if v.Kind == KindAdd {
+			result = pedersen.Add(&a, &b)
+		} else {
+			result = pedersen.Sub(&a, &b)
+		}
+		return v.expect("result", encodePoint(&result))
+
+	case KindDecodePoint, KindDecodeScalar:
+		data, err := hex.DecodeString(v.Input["bytes"])
+		if err != nil {
+			return fmt.Errorf("failed to decode bytes: %v", err)
+		}
+		if v.Kind == KindDecodePoint {
+			_, err = pedersen.DecodePoint(data)
+		} else {
+			_, err = pedersen.DecodeScalar(data)
+		}
+		return v.expectValid(err == nil)
+
+	case KindAmount:
+		decimals, err := strconv.ParseUint(v.Input["decimals"], 10, 8)
+		if err != nil {
+			return fmt.Errorf("failed to parse decimals: %v", err)
+		}
+		bits, err := strconv.Atoi(v.Input["bits"])
+		if err != nil {
+			return fmt.Errorf("failed to parse bits: %v", err)
+		}
+		denomination := pedersen.Denomination{Decimals: uint8(decimals), Bits: bits}
+		amount, parseErr := denomination.Parse(v.Input["text"])
+		err = v.expectValid(parseErr == nil)
+		if err != nil || !v.Valid {
+			return err
+		}
+		if err = v.expect("units", amount.Units().String()); err != nil {
+			return err
+		}
+		return v.expect("text", amount.String())
+
+	case KindRangeProof:
+		H, err := decodePoint(v.Input["h"])
+		if err != nil {
+			return err
+		}
+		C, err := decodePoint(v.Input["commitment"])
+		if err != nil {
+			return err
+		}
+		bits, err := strconv.Atoi(v.Input["bits"])
+		if err != nil {
+			return fmt.Errorf("failed to parse bits: %v", err)
+		}
+		var proof rangeproof.Proof
+		err = json.Unmarshal(v.Proof, &proof)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal proof: %v", err)
+		}
+		return v.expectValid(rangeproof.Verify(&H, &C, bits, proof))
+
+	case KindAddPrivately, KindSubPrivately:
+		H, err := decodePoint(v.Input["h"])
+		if err != nil {
+			return err
+		}
+		bits, err := strconv.Atoi(v.Input["bits"])
+		if err != nil {
+			return fmt.Errorf("failed to parse bits: %v", err)
+		}
+		rX, err := decodeScalar(v.Input["blindingX"])
+		if err != nil {
+			return err
+		}
+		rY, err := decodeScalar(v.Input["blindingY"])
+		if err != nil {
+			return err
+		}
+		vX, err := parseAmount(bits, v.Input["unitsX"])
+		if err != nil {
+			return err
+		}
+		vY, err := parseAmount(bits, v.Input["unitsY"])
+		if err != nil {
+			return err
+		}
+		var C ristretto.Point
+		if v.Kind == KindAddPrivately {
+			C, err = pedersen.AddPrivately(&H, pedersen.NewSecret(&rX), pedersen.NewSecret(&rY), vX, vY)
+		} else {
+			C, err = pedersen.SubPrivately(&H, pedersen.NewSecret(&rX), pedersen.NewSecret(&rY), vX, vY)
+		}
+		if err != nil || !v.Valid {
+			return v.expectValid(err == nil)
+		}
+		return v.expect("commitment", encodePoint(&C))
+
+	case KindValidate:
+		H, err := decodePoint(v.Input["h"])
+		if err != nil {
+			return err
+		}
+		C, err := decodePoint(v.Input["commitment"])
+		if err != nil {
+			return err
+		}
+		r, err := decodeScalar(v.Input["blinding"])
+		if err != nil {
+			return err
+		}
+		amount, err := parseUnits(v.Input["units"])
+		if err != nil {
+			return err
+		}
+		return v.expectValid(pedersen.Validate(amount, C, H, pedersen.NewSecret(&r)))
+
+	case KindValidateParams, KindValidateCommitment:
+		var P ristretto.Point
+		var err error
+		if v.Kind == KindValidateParams {
+			P, err = decodePoint(v.Input["h"])
+		} else {
+			P, err = decodePoint(v.Input["commitment"])
+		}
+		if err != nil {
+			return err
+		}
+		if v.Kind == KindValidateParams {
+			err = pedersen.ValidateParams(&P)
+		} else {
+			err = pedersen.ValidateCommitment(&P)
+		}
+		return v.expectValid(err == nil)
+
+	default:
+		return fmt.Errorf("unknown kind %q", v.Kind)
+	}
+}
+
+func (v Vector) expect(name string, actual string) error {
+	if !v.Valid {
+		return errors.New("expected a rejection, but the input is accepted")
+	}
+	if v.Output[name] != actual {
+		return fmt.Errorf("%s is %s, expected %s", name, actual, v.Output[name])
+	}
+	return nil
+}
+
+func (v Vector) expectValid(valid bool) error {
+	if valid != v.Valid {
+		return fmt.Errorf("valid is %t, expected %t", valid, v.Valid)
+	}
+	return nil
+}
+
+// Generate the vectors for seed
+func Generate(seed string) (File, error) {
+	g := generator{seed: seed}
+	H := pedersen.DeriveH(seed)
+	file := File{Seed: seed}
+	add := func(v Vector) {
+		file.Vectors = append(file.Vectors, v)
+	}
+
+	for _, domain := range []string{"", "Token", "pedersen-commitment-transfer", seed} {
+		P := pedersen.DeriveH(domain)
+		add(Vector{Kind: KindDeriveH, Name: fmt.Sprintf("domain %q", domain), Input: map[string]string{"domain": domain}, Valid: true, Output: map[string]string{"h": encodePoint(&P)}})
+	}
+
+	for _, size := range []int{0, 1, 31, 32, 100} {
+		data := g.bytes(fmt.Sprintf("hash %d", size), size)
+		P := pedersen.Hash("note", data)
+		add(Vector{Kind: KindHash, Name: fmt.Sprintf("%d bytes", size), Input: map[string]string{"domain": "note", "data": hex.EncodeToString(data)}, Valid: true, Output: map[string]string{"point": encodePoint(&P)}})
+	}
+
+	maxUint64 := new(big.Int).SetUint64(^uint64(0))
+	maxAmount := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), pedersen.MaxAmountBits), big.NewInt(1))
+	var one ristretto.Scalar
+	one.SetOne()
+	commits := []struct {
+		name     string
+		blinding ristretto.Scalar
+		units    *big.Int
+	}{
+		{"zero", g.scalar("commit zero"), new(big.Int)},
+		{"one", g.scalar("commit one"), big.NewInt(1)},
+		{"unit blinding", one, big.NewInt(1000)},
+		{"random", g.scalar("commit random"), new(big.Int).SetUint64(g.uint64("commit random value"))},
+		{"max uint64", g.scalar("commit max uint64"), maxUint64},
+		{"max amount", g.scalar("commit max amount"), maxAmount},
+	}
+	for _, c := range commits {
+		amount, err := parseUnits(c.units.String())
+		if err != nil {
+			return File{}, err
+		}
+		C := pedersen.CommitTo(&H, pedersen.NewSecret(&c.blinding), amount)
+		add(Vector{Kind: KindCommit, Name: c.name, Input: map[string]string{"h": encodePoint(&H), "blinding": encodeScalar(&c.blinding), "units": c.units.String()}, Valid: true, Output: map[string]string{"commitment": encodePoint(&C)}})
+	}
+
+	for i := 0; i < 2; i++ {
+		a := g.point(fmt.Sprintf("add a %d", i))
+		b := g.point(fmt.Sprintf("add b %d", i))
+		sum := pedersen.Add(&a, &b)
+		difference := pedersen.Sub(&a, &b)
+		input := map[string]string{"a": encodePoint(&a), "b": encodePoint(&b)}
+		add(Vector{Kind: KindAdd, Name: fmt.Sprintf("random %d", i), Input: input, Valid: true, Output: map[string]string{"result": encodePoint(&sum)}})
+		add(Vector{Kind: KindSub, Name: fmt.Sprintf("random %d", i), Input: input, Valid: true, Output: map[string]string{"result": encodePoint(&difference)}})
+	}
+
+	var B ristretto.Point
+	B.SetBase()
+	randomPoint := g.point("decode point")
+	highBit := B.Bytes()
+	highBit[31] |= 0x80
+	points := []struct {
+		name  string
+		data  []byte
+		valid bool
+	}{
+		{"identity", make([]byte, 32), true},
+		{"base point", B.Bytes(), true},
+		{"random", randomPoint.Bytes(), true},
+		{"negative field element", append([]byte{1}, make([]byte, 31)...), false},
+		{"high bit set", highBit, false},
+		{"all ones", repeat(0xff, 32), false},
+		{"short", B.Bytes()[:31], false},
+		{"long", append(B.Bytes(), 0), false},
+	}
+	for _, p := range points {
+		add(Vector{Kind: KindDecodePoint, Name: p.name, Input: map[string]string{"bytes": hex.EncodeToString(p.data)}, Valid: p.valid})
+	}
+
+	// l = 2^252 + 27742317777372353535851937790883648493, little endian
+	l, _ := hex.DecodeString("edd3f55c1a631258d69cf7a2def9de1400000000000000000000000000000010")
+	var lMinusOne ristretto.Scalar
+	lMinusOne.Sub(new(ristretto.Scalar).SetZero(), &one)
+	randomScalar := g.scalar("decode scalar")
+	scalars := []struct {
+		name  string
+		data  []byte
+		valid bool
+	}{
+		{"zero", make([]byte, 32), true},
+		{"one", one.Bytes(), true},
+		{"order minus one", lMinusOne.Bytes(), true},
+		{"random", randomScalar.Bytes(), true},
+		{"order", l, false},
+		{"all ones", repeat(0xff, 32), false},
+		{"short", one.Bytes()[:31], false},
+	}
+	for _, s := range scalars {
+		add(Vector{Kind: KindDecodeScalar, Name: s.name, Input: map[string]string{"bytes": hex.EncodeToString(s.data)}, Valid: s.valid})
+	}
+
+	amounts := []struct {
+		name     string
+		decimals uint8
+		bits     int
+		text     string
+	}{
+		{"fraction", 2, 64, "12.5"},
+		{"whole", 2, 64, "7"},
+		{"no whole part", 2, 64, ".05"},
+		{"no decimals", 0, 64, "18446744073709551615"},
+		{"overflow", 0, 64, "18446744073709551616"},
+		{"too many decimals", 2, 64, "1.234"},
+		{"negative", 2, 64, "-1"},
+		{"exponent", 2, 64, "1e3"},
+		{"empty", 2, 64, ""},
+		{"max bits", 18, pedersen.MaxAmountBits, "1.5"},
+	}
+	for _, a := range amounts {
+		v := Vector{Kind: KindAmount, Name: a.name, Input: map[string]string{"decimals": strconv.Itoa(int(a.decimals)), "bits": strconv.Itoa(a.bits), "text": a.text}}
+		amount, err := pedersen.Denomination{Decimals: a.decimals, Bits: a.bits}.Parse(a.text)
+		if err == nil {
+			v.Valid = true
+			v.Output = map[string]string{"units": amount.Units().String(), "text": amount.String()}
+		}
+		add(v)
+	}
+
+	randomUnits := g.uint64("range proof value")
+	proofs := []struct {
+		name  string
+		units uint64
+		bits  int
+		// Verify against a commitment to another value, or with another bit width
+		otherUnits uint64
+		otherBits  int
+	}{
+		{"zero", 0, 8, 0, 8},
+		{"max of 8 bits", 255, 8, 255, 8},
+		{"random", randomUnits, 64, randomUnits, 64},
+		{"other commitment", 5, 8, 6, 8},
+		{"other bit width", 5, 8, 5, 16},
+	}
+	for _, p := range proofs {
+		amount, err := pedersen.Denomination{Bits: p.bits}.FromUint64(p.units)
+		if err != nil {
+			return File{}, err
+		}
+		blinding := g.scalar("range proof " + p.name)
+		r := pedersen.NewSecret(&blinding)
+		proof, err := rangeproof.Prove(&H, amount, r)
+		if err != nil {
+			return File{}, err
+		}
+		proofJSON, err := json.Marshal(&proof)
+		if err != nil {
+			return File{}, fmt.Errorf("failed to obtain JSON encoding: %v", err)
+		}
+		other, err := pedersen.Denomination{Bits: p.otherBits}.FromUint64(p.otherUnits)
+		if err != nil {
+			return File{}, err
+		}
+		C := pedersen.CommitTo(&H, r, other)
+		add(Vector{
+			Kind:  KindRangeProof,
+			Name:  p.name,
+			Input: map[string]string{"h": encodePoint(&H), "commitment": encodePoint(&C), "bits": strconv.Itoa(p.otherBits)},
+			Proof: proofJSON,
+			Valid: p.otherUnits == p.units && p.otherBits == p.bits,
+		})
+	}
+
+	maxOfBits := func(bits int) string {
+		return new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(bits)), big.NewInt(1)).String()
+	}
+	arithmetic := []struct {
+		name           string
+		bits           int
+		unitsX, unitsY string
+	}{
+		{"random", 64, strconv.FormatUint(g.uint64("arithmetic x")>>1, 10), strconv.FormatUint(g.uint64("arithmetic y")>>1, 10)},
+		{"zero", 64, "0", "0"},
+		{"equal", 8, "200", "200"},
+		{"max of 8 bits", 8, "255", "1"},
+		{"max amount", pedersen.MaxAmountBits, maxOfBits(pedersen.MaxAmountBits), "0"},
+	}
+	for _, a := range arithmetic {
+		rX := g.scalar("arithmetic " + a.name + " x")
+		rY := g.scalar("arithmetic " + a.name + " y")
+		vX, err := parseAmount(a.bits, a.unitsX)
+		if err != nil {
+			return File{}, err
+		}
+		vY, err := parseAmount(a.bits, a.unitsY)
+		if err != nil {
+			return File{}, err
+		}
+		input := map[string]string{"h": encodePoint(&H), "bits": strconv.Itoa(a.bits), "blindingX": encodeScalar(&rX), "unitsX": a.unitsX, "blindingY": encodeScalar(&rY), "unitsY": a.unitsY}
+		for _, kind := range []string{KindAddPrivately, KindSubPrivately} {
+			v := Vector{Kind: kind, Name: a.name, Input: input}
+			var C ristretto.Point
+			if kind == KindAddPrivately {
+				C, err = pedersen.AddPrivately(&H, pedersen.NewSecret(&rX), pedersen.NewSecret(&rY), vX, vY)
+			} else {
+				// The operands are swapped so that the difference is negative when it is not zero
+				v.Input = map[string]string{"h": input["h"], "bits": input["bits"], "blindingX": input["blindingY"], "unitsX": a.unitsY, "blindingY": input["blindingX"], "unitsY": a.unitsX}
+				C, err = pedersen.SubPrivately(&H, pedersen.NewSecret(&rY), pedersen.NewSecret(&rX), vY, vX)
+			}
+			if err == nil {
+				v.Valid = true
+				v.Output = map[string]string{"commitment": encodePoint(&C)}
+			}
+			add(v)
+		}
+	}
+
+	openingBlinding := g.scalar("validate")
+	openingUnits := g.uint64("validate value")
+	opening, err := parseUnits(strconv.FormatUint(openingUnits, 10))
+	if err != nil {
+		return File{}, err
+	}
+	opened := pedersen.CommitTo(&H, pedersen.NewSecret(&openingBlinding), opening)
+	otherBlinding := g.scalar("validate other")
+	openings := []struct {
+		name     string
+		blinding ristretto.Scalar
+		units    uint64
+	}{
+		{"opening", openingBlinding, openingUnits},
+		{"other value", openingBlinding, openingUnits + 1},
+		{"other blinding", otherBlinding, openingUnits},
+	}
+	for _, o := range openings {
+		add(Vector{
+			Kind:  KindValidate,
+			Name:  o.name,
+			Input: map[string]string{"h": encodePoint(&H), "commitment": encodePoint(&opened), "blinding": encodeScalar(&o.blinding), "units": strconv.FormatUint(o.units, 10)},
+			Valid: o.blinding.Equals(&openingBlinding) && o.units == openingUnits,
+		})
+	}
+
+	var identity, minusB ristretto.Point
+	identity.SetZero()
+	minusB.Neg(&B)
+	checked := []struct {
+		name       string
+		point      ristretto.Point
+		params     bool
+		commitment bool
+	}{
+		{"identity", identity, false, false},
+		{"base point", B, false, true},
+		{"negated base point", minusB, false, true},
+		{"derived", H, true, true},
+		{"random", g.point("validate point"), true, true},
+	}
+	for _, c := range checked {
+		add(Vector{Kind: KindValidateParams, Name: c.name, Input: map[string]string{"h": encodePoint(&c.point)}, Valid: c.params})
+		add(Vector{Kind: KindValidateCommitment, Name: c.name, Input: map[string]string{"commitment": encodePoint(&c.point)}, Valid: c.commitment})
+	}
+
+	return file, nil
+}
+
+// generator derives the values of the vectors from the seed
+type generator struct {
+	seed string
+}
+
+func (g generator) hash(label string, counter uint64) [64]byte {
+	data := binary.BigEndian.AppendUint64(nil, uint64(len(g.seed)))
+	data = append(data, g.seed...)
+	data = binary.BigEndian.AppendUint64(data, counter)
+	return sha512.Sum512(append(data, label...))
+}
+
+func (g generator) scalar(label string) ristretto.Scalar {
+	var s ristretto.Scalar
+	h := g.hash(label, 0)
+	s.SetReduced(&h)
+	return s
+}
+
+func (g generator) point(label string) ristretto.Point {
+	s := g.scalar(label)
+	var P ristretto.Point
+	P.ScalarMultBase(&s)
+	return P
+}
+
+func (g generator) uint64(label string) uint64 {
+	h := g.hash(label, 0)
+	return binary.BigEndian.Uint64(h[:8])
+}
+
+func (g generator) bytes(label string, n int) []byte {
+	var data []byte
+	for counter := uint64(0); len(data) < n; counter++ {
+		h := g.hash(label, counter)
+		data = append(data, h[:]...)
+	}
+	return data[:n]
+}
+
+func repeat(b byte, n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = b
+	}
+	return data
+}
+
+// parseUnits returns an amount of the widest denomination
+func parseUnits(units string) (pedersen.Amount, error) {
+	return parseAmount(pedersen.MaxAmountBits, units)
+}
+
+// parseAmount returns an amount of the given bit width
+func parseAmount(bits int, units string) (pedersen.Amount, error) {
+	value, ok := new(big.Int).SetString(units, 10)
+	if !ok {
+		return pedersen.Amount{}, fmt.Errorf("invalid units %q", units)
+	}
+	return pedersen.Denomination{Bits: bits}.FromUnits(value)
+}
+
+func encodePoint(P *ristretto.Point) string {
+	return hex.EncodeToString(P.Bytes())
+}
+
+func encodeScalar(s *ristretto.Scalar) string {
+	return hex.EncodeToString(s.Bytes())
+}
+
+func decodePoint(encoded string) (ristretto.Point, error) {
+	data, err := hex.DecodeString(encoded)
+	if err != nil {
+		return ristretto.Point{}, fmt.Errorf("failed to decode point: %v", err)
+	}
+	return pedersen.DecodePoint(data)
+}
+
+func decodeScalar(encoded string) (ristretto.Scalar, error) {
+	data, err := hex.DecodeString(encoded)
+	if err != nil {
+		return ristretto.Scalar{}, fmt.Errorf("failed to decode scalar: %v", err)
+	}
+	return pedersen.DecodeScalar(data)
+}
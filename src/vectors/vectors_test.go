@@ -0,0 +1,90 @@
+package vectors
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Regenerate the checked-in vectors with go test ./src/vectors -update
+var update = flag.Bool("update", false, "regenerate "+vectorsPath)
+
+const vectorsPath = "testdata/vectors.json"
+
+const vectorsSeed = "pedersen-commitment-transfer vectors v1"
+
+func readVectors(t *testing.T) File {
+	data, err := os.ReadFile(vectorsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file File
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestVectors(t *testing.T) {
+	if *update {
+		file, err := Generate(vectorsSeed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := json.MarshalIndent(file, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(vectorsPath, append(data, '\n'), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, v := range readVectors(t).Vectors {
+		t.Run(v.Kind+"/"+v.Name, func(t *testing.T) {
+			assert.NoError(t, v.Check())
+		})
+	}
+}
+
+// The checked-in vectors must be what the generator emits for their seed
+func TestGenerateMatchesCheckedIn(t *testing.T) {
+	checkedIn := readVectors(t)
+	generated, err := Generate(checkedIn.Seed)
+	assert.NoError(t, err)
+	assert.Len(t, generated.Vectors, len(checkedIn.Vectors))
+	for i := range generated.Vectors {
+		if i >= len(checkedIn.Vectors) {
+			break
+		}
+		expected := checkedIn.Vectors[i]
+		actual := generated.Vectors[i]
+		if actual.Kind == KindRangeProof {
+			// Proofs are randomized
+			expected.Proof, actual.Proof = nil, nil
+		}
+		assert.Equal(t, expected, actual)
+	}
+}
+
+func TestCheckDetectsMismatch(t *testing.T) {
+	file, err := Generate("mismatch")
+	assert.NoError(t, err)
+	assert.NoError(t, file.Check())
+
+	for i, v := range file.Vectors {
+		tampered := v
+		tampered.Valid = !v.Valid
+		assert.Error(t, tampered.Check(), "Flipping the validity of vector %d should be detected", i)
+	}
+
+	tampered := file.Vectors[0]
+	tampered.Output = map[string]string{"h": "00"}
+	assert.Error(t, tampered.Check())
+	assert.Error(t, Vector{Kind: "unknown"}.Check())
+}